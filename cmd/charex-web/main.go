@@ -1,39 +1,48 @@
 package main
 
 import (
-	"charex/internal/extractors"
+	"charex/internal/config"
 	"charex/internal/web"
-	"log"
-	"net/http"
+	"context"
+	"flag"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 )
 
 func main() {
-	hub := web.NewHub()
-	go hub.Run()
-
-	dataDir := os.Getenv("DATA_DIR")
-	if dataDir == "" {
-		dataDir = "output"
+	configFlags := config.AddFlags(flag.CommandLine)
+	staticDir := flag.String("static-dir", "", "Serve the web UI from this directory instead of the embedded copy (default server.static_dir).")
+	flag.Parse()
+	cfg, err := configFlags.Load()
+	if err != nil {
+		fatal("Invalid configuration", err)
+	}
+	if err := cfg.SetupLogging(); err != nil {
+		fatal("Invalid logging configuration", err)
+	}
+	if *staticDir != "" {
+		cfg.Server.StaticDir = *staticDir
 	}
 
-	// Instantiate the extractors.
-	sakuraExtractor := extractors.NewSakuraFMExtractor()
-	janitorExtractor := extractors.NewJanitorAIExtractor()
-
-	server := web.NewServer(hub, dataDir, sakuraExtractor, janitorExtractor)
-
-	http.HandleFunc("/ws", server.ServeWs)
-	http.HandleFunc("/api/cards", server.GetCards)
-	http.Handle("/", http.FileServer(http.Dir("./web/static")))
-
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "9111"
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// Restore default signal handling so a second signal kills a stuck shutdown.
+		<-ctx.Done()
+		stop()
+	}()
+	if err := web.Run(ctx, cfg); err != nil {
+		fatal("Server failed", err)
 	}
+}
 
-	log.Printf("Server starting on :%s", port)
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		log.Fatalf("could not listen on port %s %v", port, err)
+// fatal logs an error and exits.
+func fatal(msg string, err error, args ...any) {
+	if err != nil {
+		args = append(args, "error", err)
 	}
-}
\ No newline at end of file
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"charex/internal/extractors"
+	"charex/internal/fsutil"
+	"charex/internal/logging"
+	"charex/internal/saver"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Outcomes of a batch item.
+const (
+	batchSaved   = "saved"
+	batchSkipped = "skipped"
+	batchFailed  = "failed"
+)
+
+// batchItem is one input of a batch extraction and its outcome.
+type batchItem struct {
+	Input    string       `json:"input"` // The URL or payload file.
+	Source   string       `json:"source,omitempty"`
+	Status   string       `json:"status"`
+	Card     *cardSummary `json:"card,omitempty"`
+	Error    string       `json:"error,omitempty"`
+	Duration float64      `json:"duration_seconds"`
+}
+
+// batchReport is the JSON report of a batch extraction.
+type batchReport struct {
+	StartedAt  time.Time   `json:"started_at"`
+	FinishedAt time.Time   `json:"finished_at"`
+	Workers    int         `json:"workers"`
+	Total      int         `json:"total"`
+	Saved      int         `json:"saved"`
+	Skipped    int         `json:"skipped"`
+	Failed     int         `json:"failed"`
+	Items      []batchItem `json:"items"`
+}
+
+// batchOptions configures runBatch.
+type batchOptions struct {
+	source  string // Forces an extractor; "" detects it per input.
+	workers int
+	force   bool // Re-extract inputs already in the library.
+	report  string
+}
+
+// readBatchList returns the inputs listed in path, or stdin for "-", one URL
+// or payload file per line. Blank lines and lines starting with '#' are ignored.
+func readBatchList(path string) ([]string, error) {
+	r := io.Reader(os.Stdin)
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open batch list: %w", err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var inputs []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line != "" && !strings.HasPrefix(line, "#") {
+			inputs = append(inputs, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read batch list: %w", err)
+	}
+	return inputs, nil
+}
+
+// readBatchDir returns every payload file under dir, skipping hidden files and directories.
+func readBatchDir(dir string) ([]string, error) {
+	var inputs []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if path != dir && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			inputs = append(inputs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	return inputs, nil
+}
+
+// runBatch extracts every input with a pool of workers and reports the outcome
+// of each. Interrupting the batch lets running extractions finish and marks
+// the remaining inputs as failed.
+func (a *app) runBatch(inputs []string, opts batchOptions) error {
+	ctx, stop := signalContext()
+	defer stop()
+
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	report := batchReport{StartedAt: time.Now().UTC(), Workers: opts.workers, Total: len(inputs), Items: make([]batchItem, len(inputs))}
+	slog.Info("Starting batch extraction", "inputs", len(inputs), "workers", opts.workers)
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				report.Items[i] = a.extractOne(ctx, library, inputs[i], opts)
+			}
+		}()
+	}
+	for i := range inputs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	// 1. Tally the outcomes.
+	report.FinishedAt = time.Now().UTC()
+	for _, item := range report.Items {
+		switch item.Status {
+		case batchSaved:
+			report.Saved++
+		case batchSkipped:
+			report.Skipped++
+		default:
+			report.Failed++
+		}
+	}
+
+	// 2. Write the JSON report file.
+	if opts.report != "" {
+		var buf strings.Builder
+		if err := writeJSON(&buf, report); err != nil {
+			return err
+		}
+		if err := fsutil.WriteFileAtomic(opts.report, []byte(buf.String()), 0644); err != nil {
+			return fmt.Errorf("failed to write report: %w", err)
+		}
+	}
+
+	// 3. Print the summary.
+	if err := a.output(report, func(w io.Writer) {
+		printBatchSummary(w, &report)
+		if opts.report != "" {
+			fmt.Fprintf(w, "Report written to %s\n", opts.report)
+		}
+	}); err != nil {
+		return err
+	}
+	if report.Failed > 0 {
+		return a.reported(exitFailure, fmt.Errorf("%d of %d inputs failed", report.Failed, report.Total))
+	}
+	return nil
+}
+
+// extractOne extracts and saves a single batch input.
+func (a *app) extractOne(ctx context.Context, library *saver.Library, input string, opts batchOptions) (item batchItem) {
+	item = batchItem{Input: input, Source: opts.source}
+	start := time.Now()
+	defer func() { item.Duration = time.Since(start).Seconds() }()
+	fail := func(err error) batchItem {
+		item.Status, item.Error = batchFailed, err.Error()
+		return item
+	}
+
+	if err := ctx.Err(); err != nil {
+		return fail(errors.New("batch interrupted"))
+	}
+	data, err := readExtractInput(input)
+	if err != nil {
+		return fail(err)
+	}
+	if item.Source == "" {
+		if item.Source = extractors.DetectSource(data); item.Source == "" {
+			return fail(errors.New("cannot tell the source of this input"))
+		}
+	}
+
+	// Inputs are identified like single extractions, so a card already saved
+	// from this input is found by its ID.
+	if !opts.force {
+		if rec, err := library.Get(saver.CardID(item.Source, data)); err == nil {
+			summary := summarize(rec)
+			item.Status, item.Card = batchSkipped, &summary
+			return item
+		}
+	}
+
+	extractor, err := extractors.New(item.Source, a.cfg.ExtractorOptions())
+	if err != nil {
+		return fail(err)
+	}
+	itemCtx := logging.WithID(context.WithoutCancel(ctx), logging.NewID())
+	slog.InfoContext(itemCtx, "Running extractor", "source", item.Source, "input", input)
+	card, rawData, cardImage, err := extractor.Extract(itemCtx, data)
+	if err != nil {
+		slog.WarnContext(itemCtx, "Extraction failed", "input", input, "error", err)
+		return fail(fmt.Errorf("extraction failed: %w", err))
+	}
+
+	rec, err := library.Save(itemCtx, card, rawData, cardImage, item.Source, data)
+	if err != nil {
+		return fail(fmt.Errorf("failed to save card: %w", err))
+	}
+	summary := summarize(rec)
+	item.Status, item.Card = batchSaved, &summary
+	return item
+}
+
+func printBatchSummary(w io.Writer, report *batchReport) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STATUS\tSOURCE\tINPUT\tCARD\tDETAIL")
+	for _, item := range report.Items {
+		card, detail := "-", item.Error
+		if item.Card != nil {
+			card = item.Card.ID
+			detail = item.Card.Name
+		}
+		source := item.Source
+		if source == "" {
+			source = "-"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", item.Status, source, item.Input, card, firstLine(detail))
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d inputs: %d saved, %d skipped, %d failed in %s\n", report.Total, report.Saved, report.Skipped, report.Failed,
+		report.FinishedAt.Sub(report.StartedAt).Round(time.Millisecond))
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
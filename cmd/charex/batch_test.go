@@ -0,0 +1,88 @@
+package main
+
+import (
+	"charex/internal/config"
+	"charex/internal/core"
+	"charex/internal/saver"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestExtractOneSkipsSavedPayloads(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	a := &app{cfg: config.Default()}
+	library := saver.NewLibrary(filepath.Join(dir, "library"))
+	payload := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+	original := payload("mira.json", `[{"role":"system","content":"<Mira's Persona>Mira maps the isles.</Mira's Persona>"},{"role":"assistant","content":"Hello."}]`)
+	// The same character captured in another chat is another card; dedup
+	// flags the two as likely duplicates.
+	other := payload("mira-2.json", `[{"role":"system","content":"<Mira's Persona>Mira maps the isles.</Mira's Persona>"},{"role":"assistant","content":"Welcome back."}]`)
+
+	tests := []struct {
+		input       string
+		force       bool
+		wantStatus  string
+		wantVersion int
+	}{
+		{original, false, batchSaved, 1},
+		{original, false, batchSkipped, 1},
+		{other, false, batchSaved, 1},
+		{other, false, batchSkipped, 1},
+		{original, true, batchSaved, 1},
+		{original, false, batchSkipped, 1},
+	}
+	ids := make(map[string]string)
+	for i, tt := range tests {
+		item := a.extractOne(ctx, library, tt.input, batchOptions{force: tt.force})
+		if item.Status != tt.wantStatus {
+			t.Fatalf("run %d (%s, force %v): status %s (%s), want %s", i+1, filepath.Base(tt.input), tt.force, item.Status, item.Error, tt.wantStatus)
+		}
+		if item.Source != "JanitorAI" || item.Card == nil {
+			t.Fatalf("run %d: source %q, card %v", i+1, item.Source, item.Card)
+		}
+		if ids[tt.input] == "" {
+			ids[tt.input] = item.Card.ID
+		}
+		if item.Card.ID != ids[tt.input] || item.Card.Version != tt.wantVersion {
+			t.Errorf("run %d: card %s version %d, want %s version %d", i+1, item.Card.ID, item.Card.Version, ids[tt.input], tt.wantVersion)
+		}
+	}
+	if ids[original] == ids[other] {
+		t.Error("two payloads were saved as one card")
+	}
+}
+
+func TestExtractOneSkipsSavedURLs(t *testing.T) {
+	ctx := context.Background()
+	a := &app{cfg: config.Default()}
+	library := saver.NewLibrary(t.TempDir())
+	url := "https://www.sakura.fm/chat/mira"
+	card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira"}}
+	rec, err := library.Save(ctx, card, []byte("{}"), nil, "SakuraFM", []byte(url))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A saved URL is skipped before anything is fetched.
+	for _, input := range []string{url, url + "?ref=home"} {
+		item := a.extractOne(ctx, library, input, batchOptions{})
+		if item.Status != batchSkipped || item.Card == nil || item.Card.ID != rec.ID {
+			t.Errorf("extractOne(%s) = %s %v (%s), want skipped %s", input, item.Status, item.Card, item.Error, rec.ID)
+		}
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if item := a.extractOne(canceled, library, url, batchOptions{force: true}); item.Status != batchFailed {
+		t.Errorf("extractOne after interrupt = %s, want failed", item.Status)
+	}
+}
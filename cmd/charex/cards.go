@@ -0,0 +1,43 @@
+package main
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/saver"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+)
+
+// openCard reads the card named by arg: a card file if one exists at that
+// path, otherwise the library card with that ID. rec is nil for files.
+func (a *app) openCard(arg string) (f *cardfile.File, rec *saver.CardRecord, err error) {
+	if _, statErr := os.Stat(arg); statErr == nil {
+		f, err = cardfile.ReadFile(arg)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %w", arg, err)
+		}
+		return f, nil, nil
+	} else if !errors.Is(statErr, fs.ErrNotExist) {
+		return nil, nil, statErr
+	}
+
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	rec, err = library.Get(arg)
+	if errors.Is(err, saver.ErrNotFound) {
+		return nil, nil, fmt.Errorf("%s: no such file or library card", arg)
+	} else if err != nil {
+		return nil, nil, err
+	}
+
+	// Prefer the PNG, which carries the avatar along with the card.
+	path := rec.PNGPath()
+	if _, err := os.Stat(path); err != nil {
+		path = rec.V2Path()
+	}
+	f, err = cardfile.ReadFile(path)
+	if err != nil {
+		return nil, nil, fmt.Errorf("card %s: %w", rec.ID, err)
+	}
+	return f, rec, nil
+}
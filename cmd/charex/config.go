@@ -0,0 +1,23 @@
+package main
+
+import (
+	"fmt"
+	"io"
+)
+
+// runConfig implements "charex config validate", which loads the config like
+// charex and charex-web do and prints the effective settings. Settings are
+// read from the config file, then the environment, then --set.
+func runConfig(a *app, args []string) error {
+	fs := a.flagSet()
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 || args[0] != "validate" {
+		return usageError("expected 'validate'")
+	}
+	return a.output(a.cfg, func(w io.Writer) {
+		fmt.Fprint(w, a.cfg)
+	})
+}
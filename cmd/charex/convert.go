@@ -0,0 +1,101 @@
+package main
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/core"
+	"charex/internal/fsutil"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// convertResult describes a finished conversion.
+type convertResult struct {
+	Input  string `json:"input"`
+	Output string `json:"output"`
+	From   string `json:"from"` // Format and spec of the input, e.g. "png/v2".
+	To     string `json:"to"`
+	Bytes  int    `json:"bytes"`
+
+	// Losses lists what the target could not represent.
+	Losses []core.ConversionLoss `json:"losses"`
+}
+
+// runConvert implements "charex convert", which rewrites a card file or
+// library card in another format or specification and reports any content
+// the target cannot represent.
+func runConvert(a *app, args []string) error {
+	fs := a.flagSet()
+	to := fs.String("to", "", "Target format: "+strings.Join(cardfile.Targets, ", ")+".")
+	out := fs.String("out", "", "Output file, or '-' for stdout (default the input name with the target's extension).")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError("expected one card file or card ID, got %d arguments", len(args))
+	}
+	if *to == "" {
+		return usageError("--to is required")
+	}
+
+	f, rec, err := a.openCard(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := f.Encode(*to)
+	if err != nil {
+		return fmt.Errorf("failed to convert to %s: %w", *to, err)
+	}
+	losses := f.Losses(*to)
+	if losses == nil {
+		losses = []core.ConversionLoss{}
+	}
+
+	// Write next to the input by default; library cards are written to the
+	// working directory under their name.
+	output := *out
+	if output == "" {
+		if rec != nil {
+			output = filepath.Base(rec.Dir)
+		} else {
+			output = strings.TrimSuffix(args[0], filepath.Ext(args[0]))
+			output = strings.TrimSuffix(strings.TrimSuffix(output, ".v2"), ".v3")
+		}
+		output += cardfile.Ext(*to)
+	}
+	if output == "-" {
+		if a.json {
+			return usageError("--json cannot be combined with --out=-")
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			return err
+		}
+		printLosses(os.Stderr, losses)
+		return nil
+	}
+	if filepath.Clean(output) == filepath.Clean(args[0]) {
+		return usageError("refusing to overwrite the input %s; pass --out", args[0])
+	}
+	if err := fsutil.WriteFileAtomic(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", output, err)
+	}
+
+	result := convertResult{Input: args[0], Output: output, From: f.Format + "/" + f.Spec, To: *to, Bytes: len(data), Losses: losses}
+	return a.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Converted %s (%s) to %s (%s)\n", result.Input, result.From, result.Output, result.To)
+		printLosses(w, losses)
+	})
+}
+
+func printLosses(w io.Writer, losses []core.ConversionLoss) {
+	if len(losses) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "Not converted (%d):\n", len(losses))
+	for _, l := range losses {
+		fmt.Fprintf(w, "  %s: %s\n", l.Field, l.Detail)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/core"
+	"charex/internal/saver"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// runDiff implements "charex diff", which compares two versions of a library card
+// or two card files and prints the changed fields.
+func runDiff(a *app, args []string) error {
+	fs := a.flagSet()
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+
+	var oldCard, newCard *core.TavernCardV2
+	switch {
+	case len(args) == 2 && isFile(args[0]) && isFile(args[1]):
+		if oldCard, err = readCardFile(args[0]); err != nil {
+			return err
+		}
+		if newCard, err = readCardFile(args[1]); err != nil {
+			return err
+		}
+	case len(args) >= 1 && len(args) <= 3:
+		if oldCard, newCard, err = loadVersionPair(saver.NewLibrary(a.cfg.Storage.DataDir), args); err != nil {
+			return err
+		}
+	default:
+		return usageError("expected a card ID and versions, or two card files")
+	}
+
+	changes := core.Diff(oldCard, newCard)
+	if changes == nil {
+		changes = []core.FieldChange{}
+	}
+	return a.output(changes, func(w io.Writer) {
+		if len(changes) == 0 {
+			fmt.Fprintln(w, "No differences.")
+			return
+		}
+		for _, c := range changes {
+			fmt.Fprintf(w, "%s (%s)\n", c.Field, c.Kind)
+			if c.Old != "" {
+				fmt.Fprintln(w, indentLines(c.Old, "  - "))
+			}
+			if c.New != "" {
+				fmt.Fprintln(w, indentLines(c.New, "  + "))
+			}
+		}
+	})
+}
+
+// loadVersionPair resolves "<id> [from [to]]" to two cards, defaulting to the
+// previous and current versions.
+func loadVersionPair(library *saver.Library, args []string) (*core.TavernCardV2, *core.TavernCardV2, error) {
+	rec, err := library.Get(args[0])
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to find card %s: %w", args[0], err)
+	}
+
+	to := rec.Version
+	if to < 1 {
+		to = 1
+	}
+	if len(args) == 3 {
+		if to, err = strconv.Atoi(args[2]); err != nil {
+			return nil, nil, usageError("invalid version %q", args[2])
+		}
+	}
+	from := to - 1
+	if len(args) >= 2 {
+		if from, err = strconv.Atoi(args[1]); err != nil {
+			return nil, nil, usageError("invalid version %q", args[1])
+		}
+	}
+	if from < 1 {
+		return nil, nil, fmt.Errorf("card %s has no earlier version to compare against", rec.ID)
+	}
+
+	oldCard, err := library.LoadVersion(rec, from)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load version %d: %w", from, err)
+	}
+	newCard, err := library.LoadVersion(rec, to)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load version %d: %w", to, err)
+	}
+	return oldCard, newCard, nil
+}
+
+// isFile reports whether path names an existing regular file.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// readCardFile reads a card file of any format as V2.
+func readCardFile(path string) (*core.TavernCardV2, error) {
+	f, err := cardfile.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return f.Card, nil
+}
+
+func indentLines(s, prefix string) string {
+	return prefix + strings.ReplaceAll(s, "\n", "\n"+prefix)
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"charex/internal/export"
+	"charex/internal/saver"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// exportResult summarizes a written archive.
+type exportResult struct {
+	File  string `json:"file"`
+	Cards int    `json:"cards"`
+	*export.Manifest
+}
+
+// runExport implements "charex export", which writes selected library cards to a zip archive.
+func runExport(a *app, args []string) error {
+	fs := a.flagSet()
+	source := fs.String("source", "", "Only export cards from this source.")
+	tag := fs.String("tag", "", "Only export cards with this card or user tag.")
+	collection := fs.String("collection", "", "Only export cards in this collection.")
+	userTags := fs.Bool("user-tags", false, "Write user tags into the exported cards.")
+	format := fs.String("format", export.FormatPNG, "Card format inside the archive: png, json or charx.")
+	file := fs.String("file", "charex-export.zip", "Path of the zip archive to write, or '-' for stdout.")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if err := export.ValidateFormat(*format); err != nil {
+		return &cliError{exitUsage, err}
+	}
+	if *file == "-" && a.json {
+		return usageError("--json cannot be combined with --file=-")
+	}
+
+	out := os.Stdout
+	if *file != "-" {
+		f, err := os.Create(*file)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", *file, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	manifest, err := export.WriteZip(out, library, export.Options{
+		Source:     *source,
+		Tag:        *tag,
+		Collection: *collection,
+		Format:     *format,
+		UserTags:   *userTags,
+	})
+	if err != nil {
+		if *file != "-" {
+			os.Remove(*file)
+		}
+		return fmt.Errorf("export failed: %w", err)
+	}
+	if *file == "-" {
+		slog.Info("Exported cards", "cards", len(manifest.Cards))
+		return nil
+	}
+
+	result := exportResult{File: *file, Cards: len(manifest.Cards), Manifest: manifest}
+	return a.output(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Exported %d cards to %s\n", result.Cards, result.File)
+	})
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/extractors"
+	"charex/internal/logging"
+	"charex/internal/saver"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+)
+
+// cardSummary describes a saved library card in command output.
+type cardSummary struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Dir       string    `json:"dir"`
+}
+
+func summarize(rec *saver.CardRecord) cardSummary {
+	return cardSummary{ID: rec.ID, Source: rec.Source, Name: rec.Name, Version: rec.Version, UpdatedAt: rec.UpdatedAt, Dir: rec.Dir}
+}
+
+// runExtract implements "charex extract", which runs an extractor on a URL or
+// an input file and saves the card to the library. With --batch or --dir it
+// extracts many inputs concurrently instead.
+func runExtract(a *app, args []string) error {
+	fs := a.flagSet()
+	source := fs.String("source", "", "Extractor to use: SakuraFM or JanitorAI (default detected from each input).")
+	batch := fs.String("batch", "", "Extract every URL or payload file listed in this file, one per line.")
+	dir := fs.String("dir", "", "Extract every payload file in this directory.")
+	workers := fs.Int("workers", 4, "Number of concurrent extractions for --batch and --dir.")
+	force := fs.Bool("force", false, "With --batch or --dir, re-extract inputs already in the library.")
+	report := fs.String("report", "", "With --batch or --dir, also write a JSON report to this file.")
+	stdout := fs.String("stdout", "", "Write the card to stdout as json or png instead of saving it to the library.")
+	origin := fs.String("origin", "", "The character's URL, which identifies a card extracted from a payload file instead of the file's content, so that re-extracting an edited character records a new version.")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	target, err := stdoutTarget(*stdout)
+	if err != nil {
+		return &cliError{exitUsage, err}
+	}
+	if target != "" && (a.json || *batch != "" || *dir != "") {
+		return usageError("--stdout cannot be combined with --json, --batch or --dir")
+	}
+	if *origin != "" && (*batch != "" || *dir != "") {
+		return usageError("--origin cannot be combined with --batch or --dir")
+	}
+	if *origin != "" && !strings.HasPrefix(*origin, "http://") && !strings.HasPrefix(*origin, "https://") {
+		return usageError("--origin must be an http or https URL")
+	}
+
+	if *batch != "" || *dir != "" {
+		if len(args) != 0 || (*batch != "" && *dir != "") {
+			return usageError("--batch, --dir and an input argument are mutually exclusive")
+		}
+		if *workers < 1 {
+			return usageError("--workers must be at least 1")
+		}
+		var inputs []string
+		if *batch != "" {
+			inputs, err = readBatchList(*batch)
+		} else {
+			inputs, err = readBatchDir(*dir)
+		}
+		if err != nil {
+			return err
+		}
+		if len(inputs) == 0 {
+			return errors.New("no inputs to extract")
+		}
+		return a.runBatch(inputs, batchOptions{source: *source, workers: *workers, force: *force, report: *report})
+	}
+
+	if len(args) != 1 {
+		return usageError("expected one URL or input file, got %d arguments", len(args))
+	}
+
+	// 1. Read the input: a URL is used as-is, "-" is stdin and anything else names a file.
+	input, err := readExtractInput(args[0])
+	if err != nil {
+		return err
+	}
+
+	// 2. Pick the extractor.
+	if *source == "" {
+		if *source = extractors.DetectSource(input); *source == "" {
+			return usageError("cannot tell the source of %s; pass --source", args[0])
+		}
+	}
+	extractor, err := extractors.New(*source, a.cfg.ExtractorOptions())
+	if err != nil {
+		return &cliError{exitUsage, err}
+	}
+
+	// 3. Extract the card.
+	ctx := logging.WithID(context.Background(), logging.NewID())
+	slog.InfoContext(ctx, "Running extractor", "source", *source)
+	card, rawData, cardImage, err := extractor.Extract(ctx, input)
+	if err != nil {
+		return fmt.Errorf("extraction failed: %w", err)
+	}
+
+	// 4. Write it to stdout, or save it to the library.
+	if target != "" {
+		f := &cardfile.File{Card: card, Image: cardImage}
+		data, err := f.Encode(target)
+		if err != nil {
+			return fmt.Errorf("failed to encode card: %w", err)
+		}
+		if _, err := os.Stdout.Write(data); err != nil {
+			return fmt.Errorf("failed to write card: %w", err)
+		}
+		return nil
+	}
+	cardOrigin := input
+	if *origin != "" {
+		cardOrigin = []byte(*origin)
+	}
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	rec, err := library.Save(ctx, card, rawData, cardImage, *source, cardOrigin)
+	if err != nil {
+		return fmt.Errorf("failed to save card: %w", err)
+	}
+
+	summary := summarize(rec)
+	return a.output(summary, func(w io.Writer) {
+		fmt.Fprintf(w, "Saved %s (%s, version %d) to %s\n", summary.Name, summary.ID, summary.Version, summary.Dir)
+	})
+}
+
+// stdoutTarget maps a --stdout value to a conversion target. "json" is V2
+// JSON, which every frontend reads; "" means the card is saved instead.
+func stdoutTarget(format string) (string, error) {
+	switch format {
+	case "":
+		return "", nil
+	case "json":
+		return cardfile.TargetV2JSON, nil
+	case "png":
+		return cardfile.TargetPNG, nil
+	default:
+		return "", fmt.Errorf("unknown --stdout format %q (want json or png)", format)
+	}
+}
+
+// readExtractInput returns the extractor input named by arg: URLs are passed
+// through, "-" reads stdin and files are read, with surrounding whitespace
+// trimmed from URLs.
+func readExtractInput(arg string) ([]byte, error) {
+	if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+		return []byte(arg), nil
+	}
+	var data []byte
+	var err error
+	if arg == "-" {
+		data, err = io.ReadAll(os.Stdin)
+	} else {
+		data, err = os.ReadFile(arg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+	if extractors.DetectSource(data) == extractors.SourceSakuraFM {
+		data = []byte(strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/logging"
+	"charex/internal/saver"
+	"context"
+	"fmt"
+	"io"
+)
+
+// importResult is the outcome of importing one file.
+type importResult struct {
+	File  string       `json:"file"`
+	Card  *cardSummary `json:"card,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// runImport implements "charex import", which saves card files to the library.
+// The card JSON is the card's origin, so importing the same card twice updates
+// one library entry.
+func runImport(a *app, args []string) error {
+	fs := a.flagSet()
+	source := fs.String("source", saver.ImportSource, "Library source to save the cards under.")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageError("expected at least one card file")
+	}
+	if *source == "" {
+		return usageError("--source must not be empty")
+	}
+
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	ctx := logging.WithID(context.Background(), logging.NewID())
+	results := make([]importResult, 0, len(args))
+	failed := 0
+	for _, path := range args {
+		result := importResult{File: path}
+		f, err := cardfile.ReadFile(path)
+		if err == nil {
+			var rec *saver.CardRecord
+			if rec, err = library.Save(ctx, f.Card, f.CardJSON, f.Image, *source, f.CardJSON); err == nil {
+				summary := summarize(rec)
+				result.Card = &summary
+			}
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	if err := a.output(results, func(w io.Writer) {
+		for _, r := range results {
+			if r.Error != "" {
+				fmt.Fprintf(w, "%s: %s\n", r.File, r.Error)
+				continue
+			}
+			fmt.Fprintf(w, "%s: saved %s (%s, version %d)\n", r.File, r.Card.Name, r.Card.ID, r.Card.Version)
+		}
+	}); err != nil {
+		return err
+	}
+	if failed > 0 {
+		return a.reported(exitFailure, fmt.Errorf("%d of %d files failed to import", failed, len(args)))
+	}
+	return nil
+}
@@ -0,0 +1,378 @@
+package main
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/core"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// inspectReport describes a card for "charex inspect".
+type inspectReport struct {
+	Source      string `json:"source"` // The file path or card ID inspected.
+	Format      string `json:"format"`
+	Spec        string `json:"spec"`
+	SpecVersion string `json:"spec_version"`
+	Name        string `json:"name"`
+	Creator     string `json:"creator,omitempty"`
+	Version     string `json:"character_version,omitempty"`
+	HasImage    bool   `json:"has_image"`
+	ImageSize   int    `json:"image_bytes,omitempty"`
+
+	Tags               []string     `json:"tags"`
+	Fields             []fieldStats `json:"fields"` // Non-empty text fields.
+	Tokens             int          `json:"tokens"`
+	PermanentTokens    int          `json:"permanent_tokens"` // Sent with every prompt.
+	AlternateGreetings int          `json:"alternate_greetings"`
+
+	Lorebook *lorebookSummary       `json:"lorebook,omitempty"`
+	Parts    []cardfile.Part        `json:"parts"`
+	Issues   []core.ValidationIssue `json:"issues"`
+
+	Error string `json:"error,omitempty"` // Why the card could not be read.
+}
+
+// fieldStats is the size of one text field. Token counts are estimates.
+type fieldStats struct {
+	Name   string `json:"name"`
+	Chars  int    `json:"chars"`
+	Tokens int    `json:"tokens"`
+}
+
+// lorebookSummary describes a card's character book.
+type lorebookSummary struct {
+	Name        string          `json:"name,omitempty"`
+	Entries     int             `json:"entries"`
+	Enabled     int             `json:"enabled"`
+	Constant    int             `json:"constant"`
+	Tokens      int             `json:"tokens"`
+	TokenBudget int             `json:"token_budget,omitempty"`
+	ScanDepth   int             `json:"scan_depth,omitempty"`
+	Items       []lorebookEntry `json:"items"`
+}
+
+type lorebookEntry struct {
+	Name     string   `json:"name"`
+	Keys     []string `json:"keys"`
+	Tokens   int      `json:"tokens"`
+	Enabled  bool     `json:"enabled"`
+	Constant bool     `json:"constant,omitempty"`
+}
+
+// permanentFields are sent with every prompt, unlike greetings and examples.
+var permanentFields = map[string]bool{
+	"description":               true,
+	"personality":               true,
+	"scenario":                  true,
+	"system_prompt":             true,
+	"post_history_instructions": true,
+}
+
+// runInspect implements "charex inspect", which describes a card file or
+// library card, or prints one of its fields.
+func runInspect(a *app, args []string) error {
+	fs := a.flagSet()
+	field := fs.String("field", "", "Print only this data field, e.g. description or character_book.")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 1 {
+		return usageError("expected one card file or card ID, got %d arguments", len(args))
+	}
+
+	f, _, err := a.openCard(args[0])
+	if err != nil {
+		// A damaged container is still listed part by part, to help find what is wrong.
+		report := inspectDamaged(args[0], err)
+		if report == nil || *field != "" {
+			return err
+		}
+		if err := a.output(report, func(w io.Writer) { printInspectReport(w, report) }); err != nil {
+			return err
+		}
+		return errSilent(exitFailure) // The report shows the error.
+	}
+	if *field != "" {
+		return a.printField(f, *field)
+	}
+
+	report, err := inspect(args[0], f)
+	if err != nil {
+		return err
+	}
+	return a.output(report, func(w io.Writer) { printInspectReport(w, report) })
+}
+
+func inspect(source string, f *cardfile.File) (*inspectReport, error) {
+	data := f.Card.Data
+	report := &inspectReport{
+		Source:             source,
+		Format:             f.Format,
+		Spec:               f.Spec,
+		SpecVersion:        f.Card.SpecVersion,
+		Name:               data.Name,
+		Creator:            data.Creator,
+		Version:            data.CharacterVersion,
+		HasImage:           f.Image != nil,
+		ImageSize:          len(f.Image),
+		Tags:               data.Tags,
+		Fields:             []fieldStats{},
+		AlternateGreetings: len(data.AlternateGreetings),
+		Parts:              []cardfile.Part{},
+		Issues:             core.Validate(f.Card),
+	}
+	if f.V3 != nil {
+		report.SpecVersion = f.V3.SpecVersion
+	}
+	if f.Spec == cardfile.SpecV1 {
+		report.SpecVersion = ""
+	}
+	if report.Tags == nil {
+		report.Tags = []string{}
+	}
+	if report.Issues == nil {
+		report.Issues = []core.ValidationIssue{}
+	}
+
+	// 1. Field sizes and token estimates.
+	for _, tf := range textFields(&data) {
+		if tf.value == "" {
+			continue
+		}
+		stats := fieldStats{Name: tf.name, Chars: utf8.RuneCountInString(tf.value), Tokens: core.EstimateTokens(tf.value)}
+		report.Fields = append(report.Fields, stats)
+		report.Tokens += stats.Tokens
+		if permanentFields[tf.name] {
+			report.PermanentTokens += stats.Tokens
+		}
+	}
+	for _, greeting := range data.AlternateGreetings {
+		report.Tokens += core.EstimateTokens(greeting)
+	}
+
+	// 2. Lorebook.
+	if book := data.CharacterBook; book != nil {
+		lb := &lorebookSummary{Name: book.Name, Entries: len(book.Entries), TokenBudget: book.TokenBudget, ScanDepth: book.ScanDepth, Items: []lorebookEntry{}}
+		for i, e := range book.Entries {
+			entry := lorebookEntry{Name: e.Name, Keys: e.Keys, Tokens: core.EstimateTokens(e.Content), Enabled: e.Enabled, Constant: e.Constant}
+			if entry.Name == "" {
+				entry.Name = e.Comment
+			}
+			if entry.Name == "" {
+				entry.Name = fmt.Sprintf("#%d", i+1)
+			}
+			if entry.Keys == nil {
+				entry.Keys = []string{}
+			}
+			if e.Enabled {
+				lb.Enabled++
+			}
+			if e.Constant {
+				lb.Constant++
+			}
+			lb.Tokens += entry.Tokens
+			lb.Items = append(lb.Items, entry)
+		}
+		report.Lorebook = lb
+	}
+
+	// 3. Container parts.
+	parts, err := cardfile.Parts(f.Raw)
+	if err != nil {
+		return nil, err
+	}
+	if parts != nil {
+		report.Parts = parts
+	}
+	return report, nil
+}
+
+// inspectDamaged describes the parts of a card file that could not be read, or
+// returns nil when it is not a readable PNG or CHARX file.
+func inspectDamaged(path string, readErr error) *inspectReport {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	format := cardfile.DetectFormat(data)
+	if format != cardfile.FormatPNG && format != cardfile.FormatCHARX {
+		return nil
+	}
+	parts, err := cardfile.Parts(data)
+	if len(parts) == 0 {
+		return nil
+	}
+	report := &inspectReport{
+		Source: path,
+		Format: format,
+		Tags:   []string{},
+		Fields: []fieldStats{},
+		Parts:  parts,
+		Issues: []core.ValidationIssue{},
+		Error:  readErr.Error(),
+	}
+	if err != nil {
+		report.Error += "; " + err.Error()
+	}
+	return report
+}
+
+func printInspectReport(w io.Writer, r *inspectReport) {
+	if r.Error != "" {
+		fmt.Fprintf(w, "%s\n", r.Source)
+		fmt.Fprintf(w, "  Format:    %s\n", r.Format)
+		fmt.Fprintf(w, "  Error:     %s\n", r.Error)
+		printParts(w, r.Parts)
+		return
+	}
+	spec := r.Spec
+	if r.SpecVersion != "" {
+		spec += " (" + r.SpecVersion + ")"
+	}
+	fmt.Fprintf(w, "%s\n", r.Source)
+	fmt.Fprintf(w, "  Format:    %s, spec %s\n", r.Format, spec)
+	fmt.Fprintf(w, "  Name:      %s\n", r.Name)
+	if r.Creator != "" {
+		fmt.Fprintf(w, "  Creator:   %s\n", r.Creator)
+	}
+	if r.Version != "" {
+		fmt.Fprintf(w, "  Version:   %s\n", r.Version)
+	}
+	if r.HasImage {
+		fmt.Fprintf(w, "  Image:     %d bytes\n", r.ImageSize)
+	} else {
+		fmt.Fprintln(w, "  Image:     none")
+	}
+	if len(r.Tags) > 0 {
+		fmt.Fprintf(w, "  Tags:      %s\n", strings.Join(r.Tags, ", "))
+	}
+	fmt.Fprintf(w, "  Greetings: %d alternate\n", r.AlternateGreetings)
+	fmt.Fprintf(w, "  Tokens:    ~%d total, ~%d permanent\n", r.Tokens, r.PermanentTokens)
+
+	fmt.Fprintf(w, "\n  %-26s %7s %8s\n", "FIELD", "CHARS", "~TOKENS")
+	for _, f := range r.Fields {
+		fmt.Fprintf(w, "  %-26s %7d %8d\n", f.Name, f.Chars, f.Tokens)
+	}
+
+	if lb := r.Lorebook; lb != nil {
+		fmt.Fprintf(w, "\nLorebook%s: %d entries (%d enabled, %d constant), ~%d tokens", optionalName(lb.Name), lb.Entries, lb.Enabled, lb.Constant, lb.Tokens)
+		if lb.TokenBudget > 0 {
+			fmt.Fprintf(w, ", budget %d", lb.TokenBudget)
+		}
+		fmt.Fprintln(w)
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, e := range lb.Items {
+			state := "on"
+			switch {
+			case !e.Enabled:
+				state = "off"
+			case e.Constant:
+				state = "constant"
+			}
+			fmt.Fprintf(tw, "  %s\t%s\t~%d tokens\t%s\n", e.Name, state, e.Tokens, strings.Join(e.Keys, ", "))
+		}
+		tw.Flush()
+	}
+
+	printParts(w, r.Parts)
+
+	if len(r.Issues) > 0 {
+		fmt.Fprintln(w, "\nIssues:")
+		for _, issue := range r.Issues {
+			fmt.Fprintf(w, "  %s\n", issue)
+		}
+	}
+}
+
+func printParts(w io.Writer, parts []cardfile.Part) {
+	if len(parts) == 0 {
+		return
+	}
+	fmt.Fprintln(w, "\nParts:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, p := range parts {
+		note := p.Note
+		if p.Error != "" {
+			note = "error: " + p.Error
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%d bytes\t%s\n", p.Name, p.Keyword, p.Size, note)
+	}
+	tw.Flush()
+}
+
+func optionalName(name string) string {
+	if name == "" {
+		return ""
+	}
+	return fmt.Sprintf(" %q", name)
+}
+
+// printField prints one field of the card's data: strings as-is, anything
+// else as JSON. V3 cards expose their V3-only fields as well.
+func (a *app) printField(f *cardfile.File, name string) error {
+	var data interface{} = f.Card.Data
+	if f.V3 != nil {
+		data = f.V3.Data
+	}
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal card data: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return fmt.Errorf("failed to read card data: %w", err)
+	}
+	raw, ok := fields[name]
+	if !ok {
+		names := make([]string, 0, len(fields))
+		for n := range fields {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return usageError("unknown field %q (fields: %s)", name, strings.Join(names, ", "))
+	}
+
+	if a.json {
+		return writeJSON(os.Stdout, map[string]json.RawMessage{"field": mustJSON(name), "value": raw})
+	}
+	var text string
+	if err := json.Unmarshal(raw, &text); err != nil {
+		// Not a string: print the JSON, indented.
+		var v interface{}
+		json.Unmarshal(raw, &v)
+		return writeJSON(os.Stdout, v)
+	}
+	fmt.Fprintln(os.Stdout, text)
+	return nil
+}
+
+func mustJSON(v interface{}) json.RawMessage {
+	data, _ := json.Marshal(v)
+	return data
+}
+
+type textField struct {
+	name  string
+	value string
+}
+
+// textFields returns the card's free-text fields in specification order.
+func textFields(data *core.TavernCardData) []textField {
+	return []textField{
+		{"description", data.Description},
+		{"personality", data.Personality},
+		{"scenario", data.Scenario},
+		{"first_mes", data.FirstMes},
+		{"mes_example", data.MesExample},
+		{"creator_notes", data.CreatorNotes},
+		{"system_prompt", data.SystemPrompt},
+		{"post_history_instructions", data.PostHistoryInstructions},
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"charex/internal/saver"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// listEntry is one library card in "charex list" output.
+type listEntry struct {
+	cardSummary
+	Tags []string `json:"tags"`
+}
+
+// runList implements "charex list", which lists the library's cards.
+func runList(a *app, args []string) error {
+	fs := a.flagSet()
+	source := fs.String("source", "", "Only list cards from this source.")
+	tag := fs.String("tag", "", "Only list cards with this card or user tag.")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError("unexpected arguments: %s", strings.Join(args, " "))
+	}
+
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	records, err := library.List(*source)
+	if err != nil {
+		return fmt.Errorf("failed to list cards: %w", err)
+	}
+
+	entries := []listEntry{}
+	for _, rec := range records {
+		card, err := library.LoadCard(rec)
+		if err != nil {
+			return fmt.Errorf("failed to load card %s: %w", rec.ID, err)
+		}
+		tags := saver.CardTags(rec, card.Data.Tags)
+		if *tag != "" && !containsFold(tags, *tag) {
+			continue
+		}
+		if tags == nil {
+			tags = []string{}
+		}
+		entries = append(entries, listEntry{summarize(rec), tags})
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		if entries[i].Source != entries[j].Source {
+			return entries[i].Source < entries[j].Source
+		}
+		return strings.ToLower(entries[i].Name) < strings.ToLower(entries[j].Name)
+	})
+
+	return a.output(entries, func(w io.Writer) {
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tSOURCE\tNAME\tVERSION\tUPDATED\tTAGS")
+		for _, e := range entries {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", e.ID, e.Source, e.Name, e.Version,
+				e.UpdatedAt.Local().Format("2006-01-02 15:04"), strings.Join(e.Tags, ", "))
+		}
+		tw.Flush()
+	})
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -1,59 +1,264 @@
+// Command charex extracts, converts and manages character cards from the
+// command line.
 package main
 
 import (
-	"charex/internal/extractors"
-	"charex/internal/saver"
+	"charex/internal/config"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"io"
 	"os"
+	"strings"
 )
 
+// Exit codes shared by every command.
+const (
+	exitOK      = 0
+	exitFailure = 1 // The command failed.
+	exitUsage   = 2 // The command line was invalid.
+	exitInvalid = 3 // Cards were read but failed validation.
+)
+
+// command is a charex subcommand.
+type command struct {
+	name    string
+	args    string // Argument synopsis shown in usage messages.
+	summary string
+	run     func(a *app, args []string) error
+}
+
+// commands returns the subcommands in the order they are listed in the help.
+func commands() []command {
+	return []command{
+		{"extract", "[--source=<name>] [--stdout=json|png] <url|file|-> | --batch=<list> | --dir=<dir>", "Extract a card and save it to the library", runExtract},
+		{"import", "[--source=<name>] <card-file>...", "Save PNG, JSON or CHARX cards to the library", runImport},
+		{"export", "[--source] [--tag] [--collection] [--format] [--file=<zip>]", "Write library cards to a zip archive", runExport},
+		{"convert", "--to=<format> [--out=<file>] <card-file>", "Convert a card between formats and specifications", runConvert},
+		{"inspect", "<card-file|card-id>", "Describe a card file or library card", runInspect},
+		{"validate", "<card-file|card-id>...", "Check cards against the specification", runValidate},
+		{"list", "[--source=<name>] [--tag=<tag>]", "List library cards", runList},
+		{"watch", "[--settle=<duration>] [dir]", "Extract or import files dropped into a folder", runWatch},
+		{"serve", "[--static-dir=<dir>] [--watch=<dir>]", "Run the web UI and API server", runServe},
+		{"diff", "<card-id> [from [to]] | <old.json> <new.json>", "Compare two versions of a card", runDiff},
+		{"merge", "[--strategy=<spec>] <base> <other>", "Combine two extractions of the same character", runMerge},
+		{"user", "[--file=<users.json>] <add|passwd|token|revoke|remove|list> [name]", "Manage the users of the web server", runUser},
+		{"config", "validate", "Print the effective configuration", runConfig},
+	}
+}
+
 func main() {
-	// Define command-line flags.
-	extractorType := flag.String("type", "", "The type of extractor to use ('SakuraFM' or 'JanitorAI').")
-	inputFile := flag.String("input", "", "Path to the input file (containing a URL for sakura, or JSON for janitor).")
-	outputDir := flag.String("output", "output", "Directory to save the output files.")
-	flag.Parse()
+	os.Exit(run(os.Args[1:]))
+}
 
-	// Validate flags.
-	if *extractorType == "" || *inputFile == "" {
-		fmt.Println("Usage: go run cmd/charex/main.go --type=<SakuraFM|JanitorAI> --input=<filepath>")
-		flag.PrintDefaults()
-		os.Exit(1)
+// run executes the command line and returns the process exit code.
+func run(args []string) int {
+	a := &app{}
+
+	// Global flags may come before the command name as well as after it.
+	root := flag.NewFlagSet("charex", flag.ContinueOnError)
+	root.SetOutput(io.Discard)
+	a.registerGlobals(root)
+	if err := root.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			printUsage(os.Stdout)
+			return exitOK
+		}
+		return a.fail(&cliError{exitUsage, err})
+	}
+	if root.NArg() == 0 {
+		printUsage(os.Stderr)
+		return exitUsage
 	}
 
-	// Read the input file.
-	inputData, err := ioutil.ReadFile(*inputFile)
-	if err != nil {
-		log.Fatalf("Failed to read input file: %v", err)
+	name := root.Arg(0)
+	if name == "help" {
+		printUsage(os.Stdout)
+		return exitOK
+	}
+	for _, cmd := range commands() {
+		if cmd.name == name {
+			a.cmd = cmd
+			if err := cmd.run(a, root.Args()[1:]); err != nil {
+				return a.fail(err)
+			}
+			return exitOK
+		}
 	}
+	return a.fail(usageError("unknown command %q", name))
+}
 
-	// Select the extractor based on the type flag.
-	var extractor extractors.Extractor
-	switch *extractorType {
-	case "SakuraFM":
-		extractor = extractors.NewSakuraFMExtractor()
-	case "JanitorAI":
-		extractor = extractors.NewJanitorAIExtractor()
-	default:
-		log.Fatalf("Unknown extractor type: %s", *extractorType)
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: charex [global flags] <command> [flags] [arguments]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	for _, cmd := range commands() {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
 	}
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	fs := flag.NewFlagSet("charex", flag.ContinueOnError)
+	fs.SetOutput(w)
+	(&app{}).registerGlobals(fs)
+	fs.PrintDefaults()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Exit codes: 0 success, 1 failure, 2 invalid usage, 3 validation failed.")
+	fmt.Fprintln(w, "Run 'charex <command> -h' for the flags of a command.")
+}
+
+// cliError carries the exit code of a failed command.
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+
+func (e *cliError) Unwrap() error { return e.err }
+
+// usageError reports an invalid command line.
+func usageError(format string, args ...interface{}) error {
+	return &cliError{exitUsage, fmt.Errorf(format, args...)}
+}
+
+// errSilent exits with its code without printing an error, for -h and for
+// commands that have already reported their outcome.
+type errSilent int
+
+func (e errSilent) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+
+// app holds the global flags and the state shared by a command's run.
+type app struct {
+	cmd         command
+	configFlags config.Flags
+	dataDir     string
+	json        bool
+
+	// cfg is loaded by parse.
+	cfg *config.Config
+}
 
-	// Run the extraction process.
-	log.Printf("Running %s extractor...", *extractorType)
-	card, rawData, cardImage, err := extractor.Extract(inputData)
+// registerGlobals registers the flags every command accepts on fs. The current
+// values become the defaults, so flags given before the command name are kept.
+func (a *app) registerGlobals(fs *flag.FlagSet) {
+	a.configFlags.Register(fs)
+	fs.StringVar(&a.dataDir, "data-dir", a.dataDir, "Library directory (default storage.data_dir).")
+	fs.BoolVar(&a.json, "json", a.json, "Print machine-readable JSON to stdout.")
+}
+
+// flagSet returns a flag set for the current command with the global flags
+// registered. Parse errors are reported by fail, not by the flag package.
+func (a *app) flagSet() *flag.FlagSet {
+	fs := flag.NewFlagSet(a.cmd.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	fs.Usage = func() {}
+	a.registerGlobals(fs)
+	return fs
+}
+
+// printUsage prints the usage of the current command and its flags.
+func (a *app) printUsage(fs *flag.FlagSet, w io.Writer) {
+	fmt.Fprintf(w, "Usage: charex %s [flags] %s\n%s.\n\nFlags:\n", a.cmd.name, a.cmd.args, a.cmd.summary)
+	fs.SetOutput(w)
+	fs.PrintDefaults()
+}
+
+// parse parses args, allowing flags after positional arguments, then loads
+// the config and sets up logging. It returns the positional arguments.
+func (a *app) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				a.printUsage(fs, os.Stdout)
+				return nil, errSilent(exitOK)
+			}
+			return nil, &cliError{exitUsage, err}
+		}
+		rest := fs.Args()
+		if len(rest) == 0 {
+			break
+		}
+		// Everything after "--" is positional.
+		if consumed := len(args) - len(rest); consumed > 0 && args[consumed-1] == "--" {
+			positional = append(positional, rest...)
+			break
+		}
+		positional = append(positional, rest[0])
+		args = rest[1:]
+	}
+
+	cfg, err := a.configFlags.Load()
 	if err != nil {
-		log.Fatalf("Extraction failed: %v", err)
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	if err := cfg.SetupLogging(); err != nil {
+		return nil, err
+	}
+	if a.dataDir != "" {
+		cfg.Storage.DataDir = a.dataDir
+	}
+	a.cfg = cfg
+	return positional, nil
+}
+
+// output prints v as JSON when --json is set, and calls text otherwise.
+func (a *app) output(v interface{}, text func(w io.Writer)) error {
+	if a.json {
+		return writeJSON(os.Stdout, v)
+	}
+	text(os.Stdout)
+	return nil
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("failed to write json: %w", err)
+	}
+	return nil
+}
+
+// fail reports err and returns its exit code. With --json the error is
+// written to stdout as {"error": ..., "exit_code": ...}.
+func (a *app) fail(err error) int {
+	code := exitFailure
+	var silent errSilent
+	var ce *cliError
+	switch {
+	case errors.As(err, &silent):
+		return int(silent)
+	case errors.As(err, &ce):
+		code = ce.code
 	}
-	log.Println("Extraction successful.")
 
-	// Save the card.
-	log.Printf("Saving card to directory: %s", *outputDir)
-	if err := saver.SaveCard(card, rawData, cardImage, "unspecified"); err != nil {
-		log.Fatalf("Failed to save card: %v", err)
+	if a.json {
+		writeJSON(os.Stdout, map[string]interface{}{"error": err.Error(), "exit_code": code})
+		return code
+	}
+	prefix := "charex"
+	if a.cmd.name != "" {
+		prefix += " " + a.cmd.name
 	}
+	fmt.Fprintf(os.Stderr, "%s: %s\n", prefix, strings.TrimSpace(err.Error()))
+	if code == exitUsage {
+		if a.cmd.name != "" {
+			fmt.Fprintf(os.Stderr, "Run 'charex %s -h' for usage.\n", a.cmd.name)
+		} else {
+			fmt.Fprintln(os.Stderr, "Run 'charex help' for usage.")
+		}
+	}
+	return code
+}
 
-	log.Println("Card saved successfully!")
-}
\ No newline at end of file
+// reported returns the error for a command that has already printed its
+// results. With --json those results say what failed, so only the exit code
+// is added; otherwise err is printed as well.
+func (a *app) reported(code int, err error) error {
+	if a.json {
+		return errSilent(code)
+	}
+	return &cliError{code, err}
+}
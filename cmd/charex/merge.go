@@ -0,0 +1,71 @@
+package main
+
+import (
+	"charex/internal/core"
+	"charex/internal/logging"
+	"charex/internal/saver"
+	"context"
+	"fmt"
+	"io"
+	"os"
+)
+
+// runMerge implements "charex merge", which combines two extractions of the same
+// character. Card files are merged to stdout as V2 JSON; library IDs are merged in place.
+func runMerge(a *app, args []string) error {
+	fs := a.flagSet()
+	strategySpec := fs.String("strategy", "", "Field strategies, e.g. 'text=prefer-longer,tags=union,creator=prefer-other'.\n"+
+		"Strategies: prefer-base, prefer-other, prefer-non-empty, prefer-longer, union (lists only).")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 2 {
+		return usageError("expected two card files or two card IDs, got %d arguments", len(args))
+	}
+
+	strategy, err := core.ParseMergeStrategy(*strategySpec)
+	if err != nil {
+		return usageError("invalid strategy: %v", err)
+	}
+
+	if isFile(args[0]) && isFile(args[1]) {
+		base, err := readCardFile(args[0])
+		if err != nil {
+			return err
+		}
+		other, err := readCardFile(args[1])
+		if err != nil {
+			return err
+		}
+		// The merged card is the output in both modes.
+		return writeJSON(os.Stdout, core.Merge(base, other, strategy))
+	}
+
+	library := saver.NewLibrary(a.cfg.Storage.DataDir)
+	target, err := library.Get(args[0])
+	if err != nil {
+		return fmt.Errorf("failed to find card %s: %w", args[0], err)
+	}
+	other, err := library.Get(args[1])
+	if err != nil {
+		return fmt.Errorf("failed to find card %s: %w", args[1], err)
+	}
+	base, err := library.LoadCard(target)
+	if err != nil {
+		return fmt.Errorf("failed to load card %s: %w", target.ID, err)
+	}
+	otherCard, err := library.LoadCard(other)
+	if err != nil {
+		return fmt.Errorf("failed to load card %s: %w", other.ID, err)
+	}
+	ctx := logging.WithID(context.Background(), logging.NewID())
+	if err := library.Merge(ctx, target, other, core.Merge(base, otherCard, strategy)); err != nil {
+		return fmt.Errorf("failed to merge cards: %w", err)
+	}
+
+	summary := summarize(target)
+	return a.output(map[string]interface{}{"merged": other.ID, "into": summary}, func(w io.Writer) {
+		fmt.Fprintf(w, "Merged %s into %s (%s, version %d)\n", other.ID, summary.Name, summary.ID, summary.Version)
+	})
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"charex/internal/web"
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+)
+
+// runServe implements "charex serve", which runs the same server as charex-web.
+func runServe(a *app, args []string) error {
+	fs := a.flagSet()
+	staticDir := fs.String("static-dir", "", "Serve the web UI from this directory instead of the embedded copy (default server.static_dir).")
+	port := fs.String("port", "", "Port to listen on (default server.port).")
+	watchDir := fs.String("watch", "", "Extract or import files dropped into this folder (default watch.dir).")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) != 0 {
+		return usageError("unexpected arguments: %s", strings.Join(args, " "))
+	}
+	if *staticDir != "" {
+		a.cfg.Server.StaticDir = *staticDir
+	}
+	if *watchDir != "" {
+		a.cfg.Watch.Dir = *watchDir
+	}
+	if *port != "" {
+		if err := a.cfg.Set("server.port", *port); err != nil {
+			return &cliError{exitUsage, err}
+		}
+		if err := a.cfg.Validate(); err != nil {
+			return &cliError{exitUsage, err}
+		}
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	return web.Run(ctx, a.cfg)
+}
+
+// signalContext returns a context cancelled by SIGINT or SIGTERM. Default
+// signal handling is restored after the first signal, so a second one kills a
+// stuck shutdown.
+func signalContext() (context.Context, context.CancelFunc) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	return ctx, stop
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"bufio"
+	"charex/internal/auth"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// runUser implements "charex user", which manages the users file read by
+// charex-web when auth.users_file is set.
+//
+//	add, passwd  set a password, read from stdin
+//	token        issue an API token and print it once
+//	revoke       remove all API tokens of a user
+func runUser(a *app, args []string) error {
+	fs := a.flagSet()
+	file := fs.String("file", "", "Path of the users file (default auth.users_file, or users.json).")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) < 1 || (args[0] == "list" && len(args) != 1) || (args[0] != "list" && len(args) != 2) {
+		return usageError("expected an action and, except for list, a user name")
+	}
+	if *file == "" {
+		*file = a.cfg.Auth.UsersFile
+		if *file == "" {
+			*file = "users.json"
+		}
+	}
+	store, err := auth.LoadStore(*file)
+	if err != nil {
+		return err
+	}
+	action := args[0]
+	var name string
+	if len(args) == 2 {
+		name = args[1]
+	}
+
+	result := map[string]interface{}{"file": *file, "action": action}
+	if name != "" {
+		result["user"] = name
+	}
+	switch action {
+	case "list":
+		names := store.Names()
+		if names == nil {
+			names = []string{}
+		}
+		return a.output(map[string]interface{}{"file": *file, "users": names}, func(w io.Writer) {
+			for _, n := range names {
+				fmt.Fprintln(w, n)
+			}
+		})
+	case "add", "passwd":
+		fmt.Fprintf(os.Stderr, "Password for %s: ", name)
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && password == "" {
+			return fmt.Errorf("failed to read password: %w", err)
+		}
+		err = store.SetPassword(name, strings.TrimRight(password, "\r\n"))
+	case "token":
+		var token string
+		if token, err = store.AddToken(name); err == nil {
+			result["token"] = token
+		}
+	case "revoke":
+		err = store.RevokeTokens(name)
+	case "remove":
+		err = store.Remove(name)
+	default:
+		return usageError("unknown action %q", action)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	if err := store.Save(); err != nil {
+		return fmt.Errorf("failed to save users: %w", err)
+	}
+	return a.output(result, func(w io.Writer) {
+		if token, ok := result["token"]; ok {
+			fmt.Fprintln(w, token)
+		}
+	})
+}
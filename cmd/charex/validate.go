@@ -0,0 +1,83 @@
+package main
+
+import (
+	"charex/internal/core"
+	"fmt"
+	"io"
+)
+
+// validateResult is the validation outcome of one card.
+type validateResult struct {
+	Card   string                 `json:"card"` // The file path or card ID validated.
+	Name   string                 `json:"name,omitempty"`
+	Valid  bool                   `json:"valid"`
+	Issues []core.ValidationIssue `json:"issues"`
+	Error  string                 `json:"error,omitempty"` // Set when the card could not be read.
+}
+
+// runValidate implements "charex validate", which checks cards against the
+// specification. It exits with exitInvalid when any card has errors, and with
+// exitFailure when a card cannot be read at all.
+func runValidate(a *app, args []string) error {
+	fs := a.flagSet()
+	strict := fs.Bool("strict", false, "Treat warnings as errors.")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return usageError("expected at least one card file or card ID")
+	}
+
+	results := make([]validateResult, 0, len(args))
+	invalid, unreadable := 0, 0
+	for _, arg := range args {
+		result := validateResult{Card: arg, Issues: []core.ValidationIssue{}}
+		f, _, err := a.openCard(arg)
+		if err != nil {
+			result.Error = err.Error()
+			unreadable++
+			results = append(results, result)
+			continue
+		}
+		result.Name = f.Card.Data.Name
+		if issues := core.Validate(f.Card); issues != nil {
+			result.Issues = issues
+		}
+		result.Valid = !core.HasErrors(result.Issues) && !(*strict && len(result.Issues) > 0)
+		if !result.Valid {
+			invalid++
+		}
+		results = append(results, result)
+	}
+
+	if err := a.output(results, func(w io.Writer) {
+		for _, r := range results {
+			switch {
+			case r.Error != "":
+				fmt.Fprintln(w, r.Error)
+			case len(r.Issues) == 0:
+				fmt.Fprintf(w, "%s: ok\n", r.Card)
+			default:
+				status := "ok"
+				if !r.Valid {
+					status = "invalid"
+				}
+				fmt.Fprintf(w, "%s: %s\n", r.Card, status)
+				for _, issue := range r.Issues {
+					fmt.Fprintf(w, "  %s\n", issue)
+				}
+			}
+		}
+	}); err != nil {
+		return err
+	}
+
+	switch {
+	case unreadable > 0:
+		return a.reported(exitFailure, fmt.Errorf("%d of %d cards could not be read", unreadable, len(args)))
+	case invalid > 0:
+		return a.reported(exitInvalid, fmt.Errorf("%d of %d cards failed validation", invalid, len(args)))
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"charex/internal/saver"
+	"charex/internal/watch"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+// watchResult reports one processed file of "charex watch".
+type watchResult struct {
+	File    string       `json:"file"`
+	Source  string       `json:"source,omitempty"`
+	Status  string       `json:"status"` // batchSaved or batchFailed.
+	Card    *cardSummary `json:"card,omitempty"`
+	MovedTo string       `json:"moved_to,omitempty"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// runWatch implements "charex watch", which imports the card files and
+// extracts the payloads dropped into a folder until interrupted. With --json
+// each processed file is reported as one line of JSON.
+func runWatch(a *app, args []string) error {
+	fs := a.flagSet()
+	settle := fs.Duration("settle", 0, "How long a file must stay unchanged before it is processed (default watch.settle).")
+	args, err := a.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	dir := a.cfg.Watch.Dir
+	switch {
+	case len(args) == 1:
+		dir = args[0]
+	case len(args) > 1:
+		return usageError("unexpected arguments: %s", strings.Join(args[1:], " "))
+	case dir == "":
+		return usageError("expected a folder to watch (or set watch.dir)")
+	}
+	if *settle < 0 {
+		return usageError("--settle must not be negative")
+	}
+
+	w, err := watch.New(dir, saver.NewLibrary(a.cfg.Storage.DataDir), a.cfg.ExtractorOptions())
+	if err != nil {
+		return err
+	}
+	w.Settle = time.Duration(a.cfg.Watch.Settle)
+	if *settle > 0 {
+		w.Settle = *settle
+	}
+	enc := json.NewEncoder(os.Stdout)
+	w.OnResult = func(ctx context.Context, r watch.Result) {
+		result := watchResult{File: r.File, Source: r.Source, Status: batchSaved, MovedTo: r.MovedTo}
+		if r.Record != nil {
+			summary := summarize(r.Record)
+			result.Card = &summary
+		}
+		if r.Err != nil {
+			result.Status, result.Error = batchFailed, r.Err.Error()
+		}
+		if a.json {
+			enc.Encode(result)
+			return
+		}
+		if result.Card == nil {
+			fmt.Fprintf(os.Stdout, "%s: failed: %s\n", result.File, firstLine(result.Error))
+			return
+		}
+		fmt.Fprintf(os.Stdout, "%s: saved %s (%s, %s, version %d)\n", result.File, result.Card.Name, result.Card.ID, result.Source, result.Card.Version)
+	}
+	if !a.json {
+		fmt.Fprintf(os.Stderr, "Watching %s; press Ctrl-C to stop.\n", dir)
+	}
+
+	ctx, stop := signalContext()
+	defer stop()
+	return w.Run(ctx)
+}
@@ -0,0 +1,182 @@
+// Package auth provides optional authentication for charex-web: username and
+// password logins backed by session cookies for the UI, and bearer API tokens
+// for scripts talking to the REST API.
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SessionCookie is the name of the cookie holding the UI session.
+const SessionCookie = "charex_session"
+
+// SessionTTL is how long a session stays valid without being used.
+const SessionTTL = 7 * 24 * time.Hour
+
+type contextKey struct{}
+
+// WithUser returns a context carrying the authenticated username.
+func WithUser(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, contextKey{}, name)
+}
+
+// UserFrom returns the authenticated username, or "" when auth is disabled.
+func UserFrom(ctx context.Context) string {
+	name, _ := ctx.Value(contextKey{}).(string)
+	return name
+}
+
+type session struct {
+	user    string
+	expires time.Time
+}
+
+// Authenticator checks requests against a users store and tracks UI sessions.
+// Sessions live in memory, so a restart logs everyone out.
+type Authenticator struct {
+	store    *Store
+	mu       sync.Mutex
+	sessions map[string]session
+}
+
+// NewAuthenticator returns an Authenticator for the given store.
+func NewAuthenticator(store *Store) *Authenticator {
+	return &Authenticator{store: store, sessions: make(map[string]session)}
+}
+
+// publicPaths are served without authentication so that users can log in and
+// probes can check the server's health.
+var publicPaths = []string{"/login.html", "/js/login.js", "/css/", "/api/login", "/healthz", "/readyz"}
+
+// Middleware rejects unauthenticated requests and records the user of
+// authenticated ones in the request context. API, WebSocket and metrics requests get a
+// 401; page requests are redirected to the login page.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, p := range publicPaths {
+			if r.URL.Path == p || (strings.HasSuffix(p, "/") && strings.HasPrefix(r.URL.Path, p)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		user, ok := a.authenticate(r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/ws" || r.URL.Path == "/metrics" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="charex"`)
+				http.Error(w, "Authentication required", http.StatusUnauthorized)
+				return
+			}
+			http.Redirect(w, r, "/login.html", http.StatusFound)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(WithUser(r.Context(), user)))
+	})
+}
+
+// authenticate resolves the user from a bearer token or a session cookie.
+func (a *Authenticator) authenticate(r *http.Request) (string, bool) {
+	if header := r.Header.Get("Authorization"); header != "" {
+		token, ok := strings.CutPrefix(header, "Bearer ")
+		if !ok {
+			return "", false
+		}
+		return a.store.UserForToken(strings.TrimSpace(token))
+	}
+
+	cookie, err := r.Cookie(SessionCookie)
+	if err != nil {
+		return "", false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s, ok := a.sessions[cookie.Value]
+	if !ok || time.Now().After(s.expires) {
+		delete(a.sessions, cookie.Value)
+		return "", false
+	}
+	s.expires = time.Now().Add(SessionTTL)
+	a.sessions[cookie.Value] = s
+	return s.user, true
+}
+
+// LoginRequest is the body of a POST /api/login request.
+type LoginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// Login checks a username and password and starts a session cookie.
+func (a *Authenticator) Login(w http.ResponseWriter, r *http.Request) {
+	var req LoginRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4096)).Decode(&req); err != nil {
+		http.Error(w, "Invalid login request", http.StatusBadRequest)
+		return
+	}
+	if !a.store.CheckPassword(req.Username, req.Password) {
+		slog.WarnContext(r.Context(), "Failed login", "user", req.Username, "remote", r.RemoteAddr)
+		http.Error(w, "Invalid username or password", http.StatusUnauthorized)
+		return
+	}
+
+	token, err := randomToken()
+	if err != nil {
+		http.Error(w, "Failed to start session", http.StatusInternalServerError)
+		return
+	}
+	a.mu.Lock()
+	a.pruneSessions()
+	a.sessions[token] = session{user: req.Username, expires: time.Now().Add(SessionTTL)}
+	a.mu.Unlock()
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookie,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(SessionTTL / time.Second),
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	writeJSON(w, map[string]string{"username": req.Username})
+}
+
+// Logout ends the current session.
+func (a *Authenticator) Logout(w http.ResponseWriter, r *http.Request) {
+	if cookie, err := r.Cookie(SessionCookie); err == nil {
+		a.mu.Lock()
+		delete(a.sessions, cookie.Value)
+		a.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: SessionCookie, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me reports the authenticated user.
+func Me(w http.ResponseWriter, r *http.Request) {
+	user := UserFrom(r.Context())
+	writeJSON(w, map[string]interface{}{"username": user, "auth_enabled": user != ""})
+}
+
+// pruneSessions drops expired sessions. Callers hold a.mu.
+func (a *Authenticator) pruneSessions() {
+	now := time.Now()
+	for token, s := range a.sessions {
+		if now.After(s.expires) {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
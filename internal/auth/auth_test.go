@@ -0,0 +1,155 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testAuthenticator(t *testing.T) (*Authenticator, string) {
+	t.Helper()
+	s, err := LoadStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPassword("alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.AddToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewAuthenticator(s), token
+}
+
+func login(t *testing.T, a *Authenticator, user, password string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	a.Login(w, httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"`+user+`","password":"`+password+`"}`)))
+	return w
+}
+
+func TestMiddleware(t *testing.T) {
+	a, token := testAuthenticator(t)
+	handler := a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user=" + UserFrom(r.Context())))
+	}))
+	w := login(t, a, "alice", "secret")
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: status %d", w.Code)
+	}
+	session := w.Result().Cookies()[0]
+
+	tests := []struct {
+		name     string
+		path     string
+		header   string
+		cookie   *http.Cookie
+		wantCode int
+		wantBody string
+	}{
+		{"api without credentials", "/api/cards", "", nil, http.StatusUnauthorized, ""},
+		{"websocket without credentials", "/ws", "", nil, http.StatusUnauthorized, ""},
+		{"metrics without credentials", "/metrics", "", nil, http.StatusUnauthorized, ""},
+		{"page without credentials", "/", "", nil, http.StatusFound, ""},
+		{"bad token", "/api/cards", "Bearer nope", nil, http.StatusUnauthorized, ""},
+		{"basic auth", "/api/cards", "Basic YWxpY2U6c2VjcmV0", nil, http.StatusUnauthorized, ""},
+		{"bad session", "/api/cards", "", &http.Cookie{Name: SessionCookie, Value: "nope"}, http.StatusUnauthorized, ""},
+		{"token", "/api/cards", "Bearer " + token, nil, http.StatusOK, "user=alice"},
+		{"session", "/api/cards", "", session, http.StatusOK, "user=alice"},
+		{"login page", "/login.html", "", nil, http.StatusOK, "user="},
+		{"stylesheet", "/css/app.css", "", nil, http.StatusOK, "user="},
+		{"health check", "/healthz", "", nil, http.StatusOK, "user="},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", tt.path, nil)
+		if tt.header != "" {
+			r.Header.Set("Authorization", tt.header)
+		}
+		if tt.cookie != nil {
+			r.AddCookie(tt.cookie)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+		if w.Code != tt.wantCode {
+			t.Errorf("%s: status %d, want %d", tt.name, w.Code, tt.wantCode)
+		}
+		if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+			t.Errorf("%s: body %q, want %q", tt.name, w.Body.String(), tt.wantBody)
+		}
+	}
+}
+
+func TestLogin(t *testing.T) {
+	a, _ := testAuthenticator(t)
+	if w := login(t, a, "alice", "wrong"); w.Code != http.StatusUnauthorized || len(w.Result().Cookies()) != 0 {
+		t.Errorf("login with a wrong password: status %d, cookies %v", w.Code, w.Result().Cookies())
+	}
+	if w := login(t, a, "nobody", "secret"); w.Code != http.StatusUnauthorized {
+		t.Errorf("login of an unknown user: status %d", w.Code)
+	}
+	w := login(t, a, "alice", "secret")
+	cookies := w.Result().Cookies()
+	if w.Code != http.StatusOK || len(cookies) != 1 || cookies[0].Name != SessionCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login: status %d, cookies %v", w.Code, cookies)
+	}
+
+	r := httptest.NewRequest("GET", "/api/cards", nil)
+	r.AddCookie(cookies[0])
+	if user, ok := a.authenticate(r); !ok || user != "alice" {
+		t.Errorf("authenticate after login = %q, %v", user, ok)
+	}
+	a.Logout(httptest.NewRecorder(), r)
+	if _, ok := a.authenticate(r); ok {
+		t.Error("session still valid after logout")
+	}
+}
+
+func TestSessionExpiry(t *testing.T) {
+	a, _ := testAuthenticator(t)
+	cookie := login(t, a, "alice", "secret").Result().Cookies()[0]
+	r := httptest.NewRequest("GET", "/api/cards", nil)
+	r.AddCookie(cookie)
+
+	// Using a session extends it.
+	a.mu.Lock()
+	a.sessions[cookie.Value] = session{user: "alice", expires: time.Now().Add(time.Minute)}
+	a.mu.Unlock()
+	if _, ok := a.authenticate(r); !ok {
+		t.Fatal("valid session rejected")
+	}
+	a.mu.Lock()
+	extended := a.sessions[cookie.Value].expires
+	a.mu.Unlock()
+	if time.Until(extended) < SessionTTL-time.Minute {
+		t.Errorf("session expires in %v after use, want about %v", time.Until(extended), SessionTTL)
+	}
+
+	a.mu.Lock()
+	a.sessions[cookie.Value] = session{user: "alice", expires: time.Now().Add(-time.Second)}
+	a.mu.Unlock()
+	if _, ok := a.authenticate(r); ok {
+		t.Error("expired session accepted")
+	}
+	a.mu.Lock()
+	_, kept := a.sessions[cookie.Value]
+	a.mu.Unlock()
+	if kept {
+		t.Error("expired session not removed")
+	}
+
+	// Logging in prunes sessions that expired unused.
+	a.mu.Lock()
+	a.sessions["stale"] = session{user: "alice", expires: time.Now().Add(-time.Second)}
+	a.mu.Unlock()
+	login(t, a, "alice", "secret")
+	a.mu.Lock()
+	_, kept = a.sessions["stale"]
+	a.mu.Unlock()
+	if kept {
+		t.Error("expired session not pruned on login")
+	}
+}
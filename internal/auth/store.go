@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"charex/internal/fsutil"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnknownUser is returned when a user does not exist in the store.
+var ErrUnknownUser = errors.New("unknown user")
+
+// validName restricts usernames to characters that are safe as a directory name,
+// since every user gets a library under DataDir/users/<user>.
+var validName = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// User is one entry of the users file. Passwords are stored as bcrypt hashes and
+// API tokens as SHA-256 hashes, so the file never contains a usable secret.
+type User struct {
+	Name         string   `json:"name"`
+	PasswordHash string   `json:"password_hash,omitempty"`
+	TokenHashes  []string `json:"token_hashes,omitempty"`
+}
+
+// Store is a users file on disk.
+type Store struct {
+	path  string
+	mu    sync.RWMutex
+	users []User
+}
+
+// LoadStore reads the users file at path. A missing file yields an empty store
+// that is created on the first Save.
+func LoadStore(path string) (*Store, error) {
+	s := &Store{path: path}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read users file: %w", err)
+	}
+	if err := json.Unmarshal(data, &s.users); err != nil {
+		return nil, fmt.Errorf("failed to parse users file: %w", err)
+	}
+	return s, nil
+}
+
+// Save writes the store back to its file.
+func (s *Store) Save() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	data, err := json.MarshalIndent(s.users, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal users: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create users directory: %w", err)
+	}
+	return fsutil.WriteFileAtomic(s.path, data, 0600)
+}
+
+// Names returns every username, sorted.
+func (s *Store) Names() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.users))
+	for _, u := range s.users {
+		names = append(names, u.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// SetPassword creates the user if needed and sets their password.
+func (s *Store) SetPassword(name, password string) error {
+	if !validName.MatchString(name) {
+		return fmt.Errorf("invalid username %q: use letters, digits, '-' and '_'", name)
+	}
+	if password == "" {
+		return fmt.Errorf("password must not be empty")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if u := s.find(name); u != nil {
+		u.PasswordHash = string(hash)
+		return nil
+	}
+	s.users = append(s.users, User{Name: name, PasswordHash: string(hash)})
+	return nil
+}
+
+// AddToken creates the user if needed and issues a new API token. The token is
+// returned once; only its hash is kept.
+func (s *Store) AddToken(name string) (string, error) {
+	if !validName.MatchString(name) {
+		return "", fmt.Errorf("invalid username %q: use letters, digits, '-' and '_'", name)
+	}
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.find(name)
+	if u == nil {
+		s.users = append(s.users, User{Name: name})
+		u = &s.users[len(s.users)-1]
+	}
+	u.TokenHashes = append(u.TokenHashes, hashToken(token))
+	return token, nil
+}
+
+// RevokeTokens removes every API token of a user.
+func (s *Store) RevokeTokens(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	u := s.find(name)
+	if u == nil {
+		return ErrUnknownUser
+	}
+	u.TokenHashes = nil
+	return nil
+}
+
+// Remove deletes a user. Their library on disk is kept.
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i := range s.users {
+		if s.users[i].Name == name {
+			s.users = append(s.users[:i], s.users[i+1:]...)
+			return nil
+		}
+	}
+	return ErrUnknownUser
+}
+
+// CheckPassword reports whether password is correct for the user.
+func (s *Store) CheckPassword(name, password string) bool {
+	s.mu.RLock()
+	u := s.find(name)
+	var hash string
+	if u != nil {
+		hash = u.PasswordHash
+	}
+	s.mu.RUnlock()
+
+	if hash == "" {
+		// Compare against a dummy hash so unknown users take as long as known ones.
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// UserForToken returns the user owning an API token.
+func (s *Store) UserForToken(token string) (string, bool) {
+	hash := []byte(hashToken(token))
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, u := range s.users {
+		for _, h := range u.TokenHashes {
+			if subtle.ConstantTimeCompare([]byte(h), hash) == 1 {
+				return u.Name, true
+			}
+		}
+	}
+	return "", false
+}
+
+// find returns the user with the given name. Callers hold s.mu.
+func (s *Store) find(name string) *User {
+	for i := range s.users {
+		if s.users[i].Name == name {
+			return &s.users[i]
+		}
+	}
+	return nil
+}
+
+// dummyHash returns a bcrypt hash to compare unknown users' passwords against.
+// It is computed on first use, so commands that never log anyone in do not pay
+// for it.
+var dummyHash = sync.OnceValue(func() []byte {
+	hash, _ := bcrypt.GenerateFromPassword([]byte("charex"), bcrypt.DefaultCost)
+	return hash
+})
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
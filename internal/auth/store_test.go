@@ -0,0 +1,128 @@
+package auth
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestStoreNames(t *testing.T) {
+	s, err := LoadStore(filepath.Join(t.TempDir(), "users.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"alice", true},
+		{"Bob_2", true},
+		{"carol-smith", true},
+		{strings.Repeat("a", 64), true},
+		{"", false},
+		{strings.Repeat("a", 65), false},
+		{"..", false},
+		{"a/b", false},
+		{"a b", false},
+		{"ünï", false},
+	}
+	for _, tt := range tests {
+		if err := s.SetPassword(tt.name, "secret"); (err == nil) != tt.valid {
+			t.Errorf("SetPassword(%q) error = %v, want valid %v", tt.name, err, tt.valid)
+		}
+		if _, err := s.AddToken(tt.name); (err == nil) != tt.valid {
+			t.Errorf("AddToken(%q) error = %v, want valid %v", tt.name, err, tt.valid)
+		}
+	}
+	if err := s.SetPassword("alice", ""); err == nil {
+		t.Error("SetPassword accepted an empty password")
+	}
+}
+
+func TestCheckPassword(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	s, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetPassword("alice", "correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+	s, err = LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{"alice", "correct horse", true},
+		{"alice", "wrong horse", false},
+		{"alice", "", false},
+		{"bob", "correct horse", false},
+	}
+	for _, tt := range tests {
+		if got := s.CheckPassword(tt.user, tt.password); got != tt.want {
+			t.Errorf("CheckPassword(%q, %q) = %v, want %v", tt.user, tt.password, got, tt.want)
+		}
+	}
+	// A user with only tokens cannot log in with a password.
+	if _, err := s.AddToken("robot"); err != nil {
+		t.Fatal(err)
+	}
+	if s.CheckPassword("robot", "") {
+		t.Error("CheckPassword succeeded for a user without a password")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.json")
+	s, err := LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := s.AddToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := s.AddToken("alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only hashes are stored.
+	s, err = LoadStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u := s.find("alice"); u == nil || len(u.TokenHashes) != 2 || u.TokenHashes[0] != hashToken(token) || u.TokenHashes[0] == token {
+		t.Fatalf("stored user = %+v, want the hashes of two tokens", u)
+	}
+	for _, tok := range []string{token, second} {
+		if user, ok := s.UserForToken(tok); !ok || user != "alice" {
+			t.Errorf("UserForToken = %q, %v; want alice", user, ok)
+		}
+	}
+	for _, tok := range []string{"", "nope", hashToken(token), token + "x"} {
+		if user, ok := s.UserForToken(tok); ok {
+			t.Errorf("UserForToken(%q) = %q, want no user", tok, user)
+		}
+	}
+
+	if err := s.RevokeTokens("alice"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.UserForToken(token); ok {
+		t.Error("revoked token still accepted")
+	}
+	if err := s.RevokeTokens("bob"); err != ErrUnknownUser {
+		t.Errorf("RevokeTokens(bob) = %v, want ErrUnknownUser", err)
+	}
+}
@@ -0,0 +1,386 @@
+// Package cardfile reads and writes character cards stored as PNG images,
+// JSON files or CHARX archives, in any of the V1, V2 and V3 specifications.
+package cardfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"charex/internal/core"
+	"charex/internal/pngmeta"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Container formats.
+const (
+	FormatPNG   = "png"
+	FormatJSON  = "json"
+	FormatCHARX = "charx"
+)
+
+// Specification versions.
+const (
+	SpecV1 = "v1"
+	SpecV2 = "v2"
+	SpecV3 = "v3"
+)
+
+// charxCardFile is the card JSON inside a CHARX archive.
+const charxCardFile = "card.json"
+
+// ErrNoCard is returned for PNG images and archives that hold no card data.
+var ErrNoCard = errors.New("no character card found")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// File is a card read from disk.
+type File struct {
+	Format string // FormatPNG, FormatJSON or FormatCHARX.
+	Spec   string // SpecV1, SpecV2 or SpecV3: the newest specification present.
+
+	Card *core.TavernCardV2 // The card as V2, converted if necessary.
+	V3   *core.TavernCardV3 // The V3 card, when the file holds one.
+
+	// CardJSON is the card JSON the file holds, V3 when present.
+	CardJSON []byte
+	// Image is the PNG image, or the CHARX icon; nil for JSON files.
+	Image []byte
+	// Raw is the file's content as read.
+	Raw []byte
+}
+
+// ReadFile reads a card from path.
+func ReadFile(path string) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read card file: %w", err)
+	}
+	return Read(data)
+}
+
+// Read parses a card, detecting the container format from its content.
+func Read(data []byte) (*File, error) {
+	var f *File
+	var err error
+	switch DetectFormat(data) {
+	case FormatPNG:
+		f, err = readPNG(data)
+	case FormatCHARX:
+		f, err = readCHARX(data)
+	default:
+		if f, err = ParseJSON(data); err == nil {
+			f.Format = FormatJSON
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.Raw = data
+	return f, nil
+}
+
+// DetectFormat guesses the container format from the first bytes of data.
+func DetectFormat(data []byte) string {
+	switch {
+	case bytes.HasPrefix(data, pngSignature):
+		return FormatPNG
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")):
+		return FormatCHARX
+	default:
+		return FormatJSON
+	}
+}
+
+// ParseJSON parses card JSON of any specification.
+func ParseJSON(data []byte) (*File, error) {
+	var header struct {
+		Spec string `json:"spec"`
+	}
+	if err := json.Unmarshal(data, &header); err != nil {
+		return nil, fmt.Errorf("failed to parse card json: %w", err)
+	}
+
+	f := &File{CardJSON: data}
+	switch header.Spec {
+	case "chara_card_v3":
+		var v3 core.TavernCardV3
+		if err := json.Unmarshal(data, &v3); err != nil {
+			return nil, fmt.Errorf("failed to parse v3 card: %w", err)
+		}
+		f.Spec, f.V3, f.Card = SpecV3, &v3, v3.ToV2()
+	case "chara_card_v2":
+		var v2 core.TavernCardV2
+		if err := json.Unmarshal(data, &v2); err != nil {
+			return nil, fmt.Errorf("failed to parse v2 card: %w", err)
+		}
+		v2.DisplayName = v2.Data.Name
+		f.Spec, f.Card = SpecV2, &v2
+	case "":
+		var v1 core.TavernCardV1
+		if err := json.Unmarshal(data, &v1); err != nil {
+			return nil, fmt.Errorf("failed to parse v1 card: %w", err)
+		}
+		if v1.Name == "" {
+			return nil, fmt.Errorf("%w: json has no spec and no name", ErrNoCard)
+		}
+		f.Spec, f.Card = SpecV1, v1.ToV2()
+	default:
+		return nil, fmt.Errorf("unknown card spec %q", header.Spec)
+	}
+	return f, nil
+}
+
+// readPNG reads the card from the ccv3 chunk, falling back to chara.
+func readPNG(data []byte) (*File, error) {
+	entries, err := pngmeta.ReadText(data, pngmeta.KeywordV3, pngmeta.KeywordV2)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read png metadata: %w", err)
+	}
+	for _, keyword := range []string{pngmeta.KeywordV3, pngmeta.KeywordV2} {
+		text, ok := entries[keyword]
+		if !ok {
+			continue
+		}
+		cardJSON, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode %s chunk: %w", keyword, err)
+		}
+		f, err := ParseJSON(cardJSON)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s chunk: %w", keyword, err)
+		}
+		f.Format, f.Image = FormatPNG, data
+		return f, nil
+	}
+	return nil, ErrNoCard
+}
+
+// readCHARX reads card.json and the main icon from a CHARX archive.
+func readCHARX(data []byte) (*File, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open charx archive: %w", err)
+	}
+	cardJSON, err := readZipFile(zr, charxCardFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrNoCard, err)
+	}
+	f, err := ParseJSON(cardJSON)
+	if err != nil {
+		return nil, err
+	}
+	f.Format = FormatCHARX
+
+	if f.V3 != nil {
+		for _, a := range f.V3.Data.Assets {
+			name, ok := strings.CutPrefix(a.URI, "embeded://")
+			if a.Type != "icon" || !ok {
+				continue
+			}
+			if icon, err := readZipFile(zr, path.Clean(name)); err == nil && bytes.HasPrefix(icon, pngSignature) {
+				f.Image = icon
+				break
+			}
+		}
+	}
+	return f, nil
+}
+
+func readZipFile(zr *zip.Reader, name string) ([]byte, error) {
+	rc, err := zr.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// V3Card returns the file's card as V3, converting V1 and V2 cards.
+func (f *File) V3Card() *core.TavernCardV3 {
+	if f.V3 != nil {
+		return f.V3
+	}
+	return core.ToV3(f.Card, time.Time{}, time.Time{}, f.Image != nil)
+}
+
+// EncodeV2JSON returns the card as indented V2 JSON.
+func EncodeV2JSON(card *core.TavernCardV2) ([]byte, error) {
+	return json.MarshalIndent(card, "", "  ")
+}
+
+// EncodeV3JSON returns the card as indented V3 JSON.
+func EncodeV3JSON(card *core.TavernCardV3) ([]byte, error) {
+	return json.MarshalIndent(card, "", "  ")
+}
+
+// EncodePNG embeds the card into image, as a V2 chara chunk and, when v3 is
+// given, a ccv3 chunk, so both old and new frontends can read it.
+func EncodePNG(image []byte, card *core.TavernCardV2, v3 *core.TavernCardV3) ([]byte, error) {
+	if image == nil {
+		return nil, errors.New("card has no image to embed it in")
+	}
+	v2JSON, err := EncodeV2JSON(card)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal v2 json: %w", err)
+	}
+	entries := []pngmeta.Entry{{Keyword: pngmeta.KeywordV2, Text: base64.StdEncoding.EncodeToString(v2JSON)}}
+	if v3 != nil {
+		v3JSON, err := EncodeV3JSON(v3)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal v3 json: %w", err)
+		}
+		entries = append(entries, pngmeta.Entry{Keyword: pngmeta.KeywordV3, Text: base64.StdEncoding.EncodeToString(v3JSON)})
+	}
+	data, err := pngmeta.Embed(image, entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to embed card metadata: %w", err)
+	}
+	return data, nil
+}
+
+// EncodeCHARX returns a CHARX archive holding the card and its icon, if any.
+func EncodeCHARX(card *core.TavernCardV3, icon []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := WriteCHARX(&buf, card, icon); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// Conversion targets accepted by Encode.
+const (
+	TargetV1JSON = "v1-json"
+	TargetV2JSON = "v2-json"
+	TargetV3JSON = "v3-json"
+	TargetPNG    = "png"
+	TargetCHARX  = "charx"
+)
+
+// Targets lists the conversion targets in the order shown to users.
+var Targets = []string{TargetV1JSON, TargetV2JSON, TargetV3JSON, TargetPNG, TargetCHARX}
+
+// Ext returns the file extension used for files of the given target.
+func Ext(target string) string {
+	switch target {
+	case TargetV1JSON:
+		return ".v1.json"
+	case TargetV2JSON:
+		return ".v2.json"
+	case TargetV3JSON:
+		return ".v3.json"
+	case TargetCHARX:
+		return ".charx"
+	default:
+		return ".png"
+	}
+}
+
+// Encode converts the file to target. Cards without an image are written to
+// PNG on a plain placeholder image, since PNG cards cannot exist without one.
+func (f *File) Encode(target string) ([]byte, error) {
+	switch target {
+	case TargetV1JSON:
+		return json.MarshalIndent(f.Card.ToV1(), "", "  ")
+	case TargetV2JSON:
+		return EncodeV2JSON(f.Card)
+	case TargetV3JSON:
+		return EncodeV3JSON(withoutLocalAssets(f.V3Card()))
+	case TargetPNG:
+		v3 := withoutLocalAssets(f.V3Card())
+		v3.Data.Assets = append([]core.Asset{core.DefaultIconAsset}, v3.Data.Assets...)
+		img := f.Image
+		if img == nil {
+			var err error
+			if img, err = placeholderImage(); err != nil {
+				return nil, err
+			}
+		}
+		return EncodePNG(img, f.Card, v3)
+	case TargetCHARX:
+		return EncodeCHARX(withoutLocalAssets(f.V3Card()), f.Image)
+	default:
+		return nil, fmt.Errorf("unknown target %q (want %s)", target, strings.Join(Targets, ", "))
+	}
+}
+
+// withoutLocalAssets returns a copy of card without the assets that point into
+// its container. Only the main image is carried into another container, and
+// the writers add their own reference to it.
+func withoutLocalAssets(card *core.TavernCardV3) *core.TavernCardV3 {
+	v3 := *card
+	v3.Data.Assets = nil
+	for _, a := range card.Data.Assets {
+		if a.URI == core.DefaultIconAsset.URI || strings.HasPrefix(a.URI, "embeded://") {
+			continue
+		}
+		v3.Data.Assets = append(v3.Data.Assets, a)
+	}
+	return &v3
+}
+
+// Losses lists the content of the file that converting it to target drops.
+func (f *File) Losses(target string) []core.ConversionLoss {
+	var losses []core.ConversionLoss
+
+	// 1. Specification downgrades.
+	switch target {
+	case TargetV1JSON:
+		if f.V3 != nil {
+			losses = append(losses, f.V3.V2Losses()...)
+		}
+		losses = append(losses, f.Card.V1Losses()...)
+	case TargetV2JSON:
+		if f.V3 != nil {
+			losses = append(losses, f.V3.V2Losses()...)
+		}
+	}
+
+	// 2. Container contents. The V2 losses above already cover every asset.
+	if f.V3 != nil && target != TargetV1JSON && target != TargetV2JSON {
+		for _, a := range f.V3.Data.Assets {
+			if strings.HasPrefix(a.URI, "embeded://") && !(a.Type == "icon" && f.Image != nil && isMainIcon(a, f.V3.Data.Assets)) {
+				losses = append(losses, core.ConversionLoss{
+					Field:  "data.assets",
+					Detail: fmt.Sprintf("%s asset %q stored in the archive is not copied", a.Type, a.Name),
+				})
+			}
+		}
+	}
+	if f.Image != nil && (target == TargetV1JSON || target == TargetV2JSON || target == TargetV3JSON) {
+		losses = append(losses, core.ConversionLoss{Field: "image", Detail: "JSON cards cannot hold the avatar image"})
+	}
+	return losses
+}
+
+// isMainIcon reports whether a is the first embedded icon, which readCHARX
+// loads as the card's image.
+func isMainIcon(a core.Asset, assets []core.Asset) bool {
+	for _, other := range assets {
+		if other.Type == "icon" && strings.HasPrefix(other.URI, "embeded://") {
+			return other == a
+		}
+	}
+	return false
+}
+
+// placeholderImage returns a plain grey portrait-sized PNG.
+func placeholderImage() ([]byte, error) {
+	img := image.NewGray(image.Rect(0, 0, 400, 600))
+	for i := range img.Pix {
+		img.Pix[i] = 0x80
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode placeholder image: %w", err)
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,52 @@
+package cardfile
+
+import (
+	"archive/zip"
+	"charex/internal/core"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// charxIconPath is where WriteCHARX stores the card's main icon inside the archive.
+const charxIconPath = "assets/icon/images/main.png"
+
+// WriteCHARX writes a CHARX archive: a zip holding card.json (V3) and, if given,
+// the icon image referenced from the card's assets.
+func WriteCHARX(w io.Writer, card *core.TavernCardV3, icon []byte) error {
+	v3 := *card
+	v3.Data.Assets = nil
+	for _, a := range card.Data.Assets {
+		if a.URI != core.DefaultIconAsset.URI {
+			v3.Data.Assets = append(v3.Data.Assets, a)
+		}
+	}
+	if icon != nil {
+		v3.Data.Assets = append([]core.Asset{{Type: "icon", URI: "embeded://" + charxIconPath, Name: "main", Ext: "png"}}, v3.Data.Assets...)
+	}
+
+	cardJson, err := json.MarshalIndent(&v3, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal v3 json: %w", err)
+	}
+
+	zw := zip.NewWriter(w)
+	f, err := zw.Create(charxCardFile)
+	if err != nil {
+		return fmt.Errorf("failed to add card.json: %w", err)
+	}
+	if _, err := f.Write(cardJson); err != nil {
+		return fmt.Errorf("failed to write card.json: %w", err)
+	}
+	if icon != nil {
+		// PNG data is already compressed, so store it as-is.
+		f, err := zw.CreateHeader(&zip.FileHeader{Name: charxIconPath, Method: zip.Store})
+		if err != nil {
+			return fmt.Errorf("failed to add icon: %w", err)
+		}
+		if _, err := f.Write(icon); err != nil {
+			return fmt.Errorf("failed to write icon: %w", err)
+		}
+	}
+	return zw.Close()
+}
@@ -0,0 +1,50 @@
+package cardfile
+
+import (
+	"bytes"
+	"charex/internal/core"
+	"image"
+	"image/png"
+	"testing"
+	"time"
+)
+
+func TestCHARXRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	icon := buf.Bytes()
+	card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira", Description: "A cartographer."}}
+
+	for _, icon := range [][]byte{icon, nil} {
+		data, err := EncodeCHARX(core.ToV3(card, time.Time{}, time.Time{}, icon != nil), icon)
+		if err != nil {
+			t.Fatalf("EncodeCHARX: %v", err)
+		}
+		f, err := Read(data)
+		if err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		if f.Format != FormatCHARX || f.Card.Data.Name != "Mira" || f.Card.Data.Description != "A cartographer." {
+			t.Errorf("read %s card %+v", f.Format, f.Card.Data)
+		}
+		if !bytes.Equal(f.Image, icon) {
+			t.Errorf("icon of %d bytes read back as %d bytes", len(icon), len(f.Image))
+		}
+		// Only the embedded icon is listed, never the default placeholder.
+		var icons int
+		for _, a := range f.V3.Data.Assets {
+			if a.Type == "icon" {
+				icons++
+			}
+		}
+		want := 0
+		if icon != nil {
+			want = 1
+		}
+		if icons != want {
+			t.Errorf("%d icon assets, want %d", icons, want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package cardfile
+
+import (
+	"archive/zip"
+	"bytes"
+	"charex/internal/pngmeta"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// Part is one piece of a card container: a PNG chunk or a CHARX archive entry.
+type Part struct {
+	Name    string `json:"name"`              // The chunk type or archive path.
+	Keyword string `json:"keyword,omitempty"` // The keyword of a text chunk.
+	Size    int64  `json:"size"`              // Bytes of chunk data, or the uncompressed entry size.
+	Note    string `json:"note,omitempty"`    // What the part holds, for card data.
+	Error   string `json:"error,omitempty"`   // What is wrong with the part.
+}
+
+// Parts lists the chunks of a PNG card or the entries of a CHARX archive.
+// JSON cards have no parts. The chunks of a damaged PNG are listed with the
+// error of each, and those found before a break in the stream are returned
+// along with the error.
+func Parts(data []byte) ([]Part, error) {
+	switch DetectFormat(data) {
+	case FormatPNG:
+		return pngParts(data)
+	case FormatCHARX:
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open charx archive: %w", err)
+		}
+		var parts []Part
+		for _, zf := range zr.File {
+			p := Part{Name: zf.Name, Size: int64(zf.UncompressedSize64)}
+			if zf.Name == charxCardFile {
+				p.Note = "card JSON"
+			}
+			parts = append(parts, p)
+		}
+		return parts, nil
+	default:
+		return nil, nil
+	}
+}
+
+func pngParts(data []byte) ([]Part, error) {
+	chunks, scanErr := pngmeta.ScanChunks(data)
+	var parts []Part
+	for _, c := range chunks {
+		p := Part{Name: c.Type, Size: int64(len(c.Data))}
+		if c.Err != nil {
+			p.Error = c.Err.Error()
+		}
+		if c.IsText() {
+			p.Keyword, _ = c.Keyword()
+			if err := describeText(&p, c.Chunk); err != nil && p.Error == "" {
+				p.Error = err.Error()
+			}
+		}
+		parts = append(parts, p)
+	}
+	if scanErr != nil {
+		return parts, fmt.Errorf("failed to read png chunks: %w", scanErr)
+	}
+	return parts, nil
+}
+
+// describeText decodes a text chunk and, for a chara or ccv3 chunk, summarizes
+// its card JSON in p.Note.
+func describeText(p *Part, c pngmeta.Chunk) error {
+	keyword, text, err := c.Text()
+	if err != nil {
+		return err
+	}
+	if keyword != pngmeta.KeywordV2 && keyword != pngmeta.KeywordV3 {
+		return nil
+	}
+	cardJSON, err := base64.StdEncoding.DecodeString(strings.TrimSpace(text))
+	if err != nil {
+		return fmt.Errorf("invalid base64: %w", err)
+	}
+	f, err := ParseJSON(cardJSON)
+	if err != nil {
+		return err
+	}
+	p.Note = fmt.Sprintf("%s card JSON, %d bytes: %s", f.Spec, len(cardJSON), f.Card.Data.Name)
+	return nil
+}
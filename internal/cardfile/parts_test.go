@@ -0,0 +1,54 @@
+package cardfile
+
+import (
+	"bytes"
+	"charex/internal/pngmeta"
+	"encoding/base64"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestPartsOfDamagedPNG(t *testing.T) {
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	card := base64.StdEncoding.EncodeToString([]byte(`{"spec":"chara_card_v2","spec_version":"2.0","data":{"name":"Mira"}}`))
+	data, err := pngmeta.Embed(buf.Bytes(), []pngmeta.Entry{{Keyword: pngmeta.KeywordV2, Text: card}, {Keyword: "Comment", Text: "hello"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Flip a byte of the Comment text: its CRC no longer matches.
+	damaged := bytes.Clone(data)
+	damaged[bytes.Index(damaged, []byte("hello"))] ^= 1
+	parts, err := Parts(damaged)
+	if err != nil {
+		t.Fatalf("Parts: %v", err)
+	}
+	var got []string
+	for _, p := range parts {
+		got = append(got, p.Name+"/"+p.Keyword)
+		switch p.Keyword {
+		case pngmeta.KeywordV2:
+			if p.Error != "" || !strings.Contains(p.Note, "Mira") {
+				t.Errorf("chara part = %+v, want a note naming the card", p)
+			}
+		case "Comment":
+			if !strings.Contains(p.Error, "crc mismatch") {
+				t.Errorf("Comment part error = %q, want a crc mismatch", p.Error)
+			}
+		}
+	}
+	if strings.Join(got, ",") != "IHDR/,tEXt/chara,tEXt/Comment,IDAT/,IEND/" {
+		t.Errorf("parts = %v", got)
+	}
+
+	// The chunks before a truncation are listed along with the error.
+	parts, err = Parts(data[:bytes.Index(data, []byte("hello"))])
+	if err == nil || len(parts) != 3 || parts[2].Error == "" {
+		t.Errorf("Parts of a truncated png = %+v, %v; want 3 parts and an error", parts, err)
+	}
+}
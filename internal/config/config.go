@@ -0,0 +1,389 @@
+// Package config loads the settings shared by charex and charex-web.
+//
+// Settings are resolved in order: built-in defaults, then the config file,
+// then environment variables, then command-line overrides.
+package config
+
+import (
+	"bytes"
+	"charex/internal/extractors"
+	"charex/internal/logging"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvFile is the environment variable naming the config file when no
+// --config flag is given.
+const EnvFile = "CHAREX_CONFIG"
+
+// Duration is a time.Duration written as a string such as "30s" in config files.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Config holds every setting of both binaries.
+type Config struct {
+	Server    ServerConfig    `yaml:"server" json:"server"`
+	Storage   StorageConfig   `yaml:"storage" json:"storage"`
+	Extractor ExtractorConfig `yaml:"extractor" json:"extractor"`
+	Image     ImageConfig     `yaml:"image" json:"image"`
+	Auth      AuthConfig      `yaml:"auth" json:"auth"`
+	Watch     WatchConfig     `yaml:"watch" json:"watch"`
+	Log       LogConfig       `yaml:"log" json:"log"`
+}
+
+// ServerConfig configures charex-web's HTTP server and its limits.
+type ServerConfig struct {
+	Port              string   `yaml:"port" json:"port"`
+	ReadHeaderTimeout Duration `yaml:"read_header_timeout" json:"read_header_timeout"`
+	ReadTimeout       Duration `yaml:"read_timeout" json:"read_timeout"`
+	WriteTimeout      Duration `yaml:"write_timeout" json:"write_timeout"`
+	IdleTimeout       Duration `yaml:"idle_timeout" json:"idle_timeout"`
+	ShutdownTimeout   Duration `yaml:"shutdown_timeout" json:"shutdown_timeout"`
+
+	// StaticDir serves the web UI from this directory instead of the copy
+	// embedded in the binary, for development.
+	StaticDir string `yaml:"static_dir" json:"static_dir"`
+
+	// AllowedOrigins lists the origins allowed to open a WebSocket, or "*".
+	AllowedOrigins []string `yaml:"allowed_origins" json:"allowed_origins"`
+	// MaxMessageSize is the largest WebSocket frame accepted, in bytes.
+	MaxMessageSize int64 `yaml:"max_message_size" json:"max_message_size"`
+
+	// Extraction requests per minute, per client and across all clients.
+	ExtractRateClient    float64 `yaml:"extract_rate_client" json:"extract_rate_client"`
+	ExtractBurstClient   int     `yaml:"extract_burst_client" json:"extract_burst_client"`
+	ExtractRateGlobal    float64 `yaml:"extract_rate_global" json:"extract_rate_global"`
+	ExtractBurstGlobal   int     `yaml:"extract_burst_global" json:"extract_burst_global"`
+	MaxClientExtractions int     `yaml:"max_client_extractions" json:"max_client_extractions"`
+	// MaxClientConnections caps the WebSocket connections of one user or address.
+	MaxClientConnections int `yaml:"max_client_connections" json:"max_client_connections"`
+}
+
+// StorageConfig configures where cards are saved.
+type StorageConfig struct {
+	DataDir string `yaml:"data_dir" json:"data_dir"`
+}
+
+// ExtractorConfig configures how cards are fetched and processed.
+type ExtractorConfig struct {
+	Timeout Duration `yaml:"timeout" json:"timeout"`
+	// UserAgent is sent with each HTTP request; empty keeps Go's default.
+	UserAgent string `yaml:"user_agent" json:"user_agent"`
+	// Anonymize replaces character and user names with {{char}} and {{user}}.
+	Anonymize bool `yaml:"anonymize" json:"anonymize"`
+}
+
+// ImageConfig bounds downloaded character images.
+type ImageConfig struct {
+	// MaxBytes is the largest image download accepted.
+	MaxBytes int64 `yaml:"max_bytes" json:"max_bytes"`
+	// MaxDimension scales down images wider or taller than this many pixels; 0 keeps the original size.
+	MaxDimension int `yaml:"max_dimension" json:"max_dimension"`
+}
+
+// AuthConfig configures charex-web's optional authentication.
+type AuthConfig struct {
+	// UsersFile enables authentication with the users managed by "charex user".
+	UsersFile string `yaml:"users_file" json:"users_file"`
+}
+
+// WatchConfig configures the watch folder, whose new files are extracted or
+// imported into the library.
+type WatchConfig struct {
+	// Dir is the folder watched by charex-web; empty disables watching.
+	Dir string `yaml:"dir" json:"dir"`
+	// Settle is how long a file must stay unchanged before it is processed.
+	Settle Duration `yaml:"settle" json:"settle"`
+	// User receives the cards in charex-web when authentication is enabled.
+	User string `yaml:"user" json:"user"`
+}
+
+// LogConfig configures logging.
+type LogConfig struct {
+	// Level is debug, info, warn or error.
+	Level string `yaml:"level" json:"level"`
+	// Format is text or json.
+	Format string `yaml:"format" json:"format"`
+}
+
+// Default returns the built-in settings.
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Port:                 "9111",
+			ReadHeaderTimeout:    Duration(10 * time.Second),
+			ReadTimeout:          Duration(30 * time.Second),
+			WriteTimeout:         Duration(60 * time.Second),
+			IdleTimeout:          Duration(120 * time.Second),
+			ShutdownTimeout:      Duration(30 * time.Second),
+			AllowedOrigins:       []string{},
+			MaxMessageSize:       64 << 10,
+			ExtractRateClient:    10,
+			ExtractBurstClient:   5,
+			ExtractRateGlobal:    60,
+			ExtractBurstGlobal:   20,
+			MaxClientExtractions: 2,
+			MaxClientConnections: 8,
+		},
+		Storage: StorageConfig{DataDir: "output"},
+		Extractor: ExtractorConfig{
+			Timeout:   Duration(30 * time.Second),
+			Anonymize: true,
+		},
+		Image: ImageConfig{MaxBytes: 20 << 20},
+		Watch: WatchConfig{Settle: Duration(time.Second)},
+		Log:   LogConfig{Level: "info", Format: "text"},
+	}
+}
+
+// setting ties a config key to its environment variable and field.
+type setting struct {
+	key   string
+	env   string
+	field interface{}
+}
+
+func (c *Config) settings() []setting {
+	return []setting{
+		{"server.port", "PORT", &c.Server.Port},
+		{"server.read_header_timeout", "HTTP_READ_HEADER_TIMEOUT", &c.Server.ReadHeaderTimeout},
+		{"server.read_timeout", "HTTP_READ_TIMEOUT", &c.Server.ReadTimeout},
+		{"server.write_timeout", "HTTP_WRITE_TIMEOUT", &c.Server.WriteTimeout},
+		{"server.idle_timeout", "HTTP_IDLE_TIMEOUT", &c.Server.IdleTimeout},
+		{"server.shutdown_timeout", "SHUTDOWN_TIMEOUT", &c.Server.ShutdownTimeout},
+		{"server.static_dir", "STATIC_DIR", &c.Server.StaticDir},
+		{"server.allowed_origins", "ALLOWED_ORIGINS", &c.Server.AllowedOrigins},
+		{"server.max_message_size", "WS_MAX_MESSAGE_SIZE", &c.Server.MaxMessageSize},
+		{"server.extract_rate_client", "EXTRACT_RATE_CLIENT", &c.Server.ExtractRateClient},
+		{"server.extract_burst_client", "EXTRACT_BURST_CLIENT", &c.Server.ExtractBurstClient},
+		{"server.extract_rate_global", "EXTRACT_RATE_GLOBAL", &c.Server.ExtractRateGlobal},
+		{"server.extract_burst_global", "EXTRACT_BURST_GLOBAL", &c.Server.ExtractBurstGlobal},
+		{"server.max_client_extractions", "MAX_CLIENT_EXTRACTIONS", &c.Server.MaxClientExtractions},
+		{"server.max_client_connections", "MAX_CLIENT_CONNECTIONS", &c.Server.MaxClientConnections},
+		{"storage.data_dir", "DATA_DIR", &c.Storage.DataDir},
+		{"extractor.timeout", "EXTRACTOR_TIMEOUT", &c.Extractor.Timeout},
+		{"extractor.user_agent", "EXTRACTOR_USER_AGENT", &c.Extractor.UserAgent},
+		{"extractor.anonymize", "EXTRACTOR_ANONYMIZE", &c.Extractor.Anonymize},
+		{"image.max_bytes", "IMAGE_MAX_BYTES", &c.Image.MaxBytes},
+		{"image.max_dimension", "IMAGE_MAX_DIMENSION", &c.Image.MaxDimension},
+		{"auth.users_file", "AUTH_FILE", &c.Auth.UsersFile},
+		{"watch.dir", "WATCH_DIR", &c.Watch.Dir},
+		{"watch.settle", "WATCH_SETTLE", &c.Watch.Settle},
+		{"watch.user", "WATCH_USER", &c.Watch.User},
+		{"log.level", "LOG_LEVEL", &c.Log.Level},
+		{"log.format", "LOG_FORMAT", &c.Log.Format},
+	}
+}
+
+// Set assigns a setting by its key, such as "server.port", parsing value for the field's type.
+func (c *Config) Set(key, value string) error {
+	for _, s := range c.settings() {
+		if s.key == key {
+			if err := setField(s.field, value); err != nil {
+				return fmt.Errorf("invalid value for %s: %w", key, err)
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown setting %q", key)
+}
+
+func setField(field interface{}, value string) error {
+	var err error
+	switch f := field.(type) {
+	case *string:
+		*f = value
+	case *[]string:
+		*f = []string{}
+		for _, v := range strings.Split(value, ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				*f = append(*f, v)
+			}
+		}
+	case *int:
+		*f, err = strconv.Atoi(value)
+	case *int64:
+		*f, err = strconv.ParseInt(value, 10, 64)
+	case *float64:
+		*f, err = strconv.ParseFloat(value, 64)
+	case *bool:
+		*f, err = strconv.ParseBool(value)
+	case *Duration:
+		err = f.UnmarshalText([]byte(value))
+	default:
+		err = fmt.Errorf("unsupported setting type %T", field)
+	}
+	return err
+}
+
+// Overrides collects "--set key=value" flags, applied after the environment.
+type Overrides []string
+
+func (o *Overrides) String() string {
+	return strings.Join(*o, ",")
+}
+
+func (o *Overrides) Set(v string) error {
+	if !strings.Contains(v, "=") {
+		return errors.New("expected key=value")
+	}
+	*o = append(*o, v)
+	return nil
+}
+
+// Flags holds the config flags registered on a command's flag set.
+type Flags struct {
+	File      string
+	Overrides Overrides
+}
+
+// AddFlags registers --config and --set on fs.
+func AddFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{}
+	f.Register(fs)
+	return f
+}
+
+// Register registers --config and --set on fs, bound to f, so that several flag
+// sets can share one Flags.
+func (f *Flags) Register(fs *flag.FlagSet) {
+	fs.StringVar(&f.File, "config", f.File, "Path of a YAML config file (default $"+EnvFile+").")
+	fs.Var(&f.Overrides, "set", "Override a config setting, as key=value (repeatable).")
+}
+
+// Load resolves the config described by the flags.
+func (f *Flags) Load() (*Config, error) {
+	return Load(f.File, f.Overrides)
+}
+
+// Load reads the config file at path, or the file named by $CHAREX_CONFIG when
+// path is empty, applies the environment and then overrides, and validates the result.
+func Load(path string, overrides []string) (*Config, error) {
+	c := Default()
+
+	// 1. Config file.
+	if path == "" {
+		path = os.Getenv(EnvFile)
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config file: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("failed to parse config file %s: %w", path, err)
+		}
+	}
+
+	// 2. Environment.
+	for _, s := range c.settings() {
+		if v, ok := os.LookupEnv(s.env); ok && v != "" {
+			if err := setField(s.field, v); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %w", s.env, err)
+			}
+		}
+	}
+
+	// 3. Command-line overrides.
+	for _, o := range overrides {
+		key, value, _ := strings.Cut(o, "=")
+		if err := c.Set(strings.TrimSpace(key), value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Validate reports every invalid setting.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if port, err := strconv.Atoi(c.Server.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Errorf("server.port must be a port number, got %q", c.Server.Port))
+	}
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout must not be negative")
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout must not be negative")
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	for _, origin := range c.Server.AllowedOrigins {
+		if origin == "*" {
+			continue
+		}
+		u, err := url.Parse(origin)
+		check(err == nil && u.Scheme != "" && u.Host != "", "server.allowed_origins: %q is not scheme://host[:port]", origin)
+	}
+	check(c.Server.MaxMessageSize > 0, "server.max_message_size must be positive")
+	check(c.Server.ExtractRateClient > 0, "server.extract_rate_client must be positive")
+	check(c.Server.ExtractBurstClient >= 1, "server.extract_burst_client must be at least 1")
+	check(c.Server.ExtractRateGlobal > 0, "server.extract_rate_global must be positive")
+	check(c.Server.ExtractBurstGlobal >= 1, "server.extract_burst_global must be at least 1")
+	check(c.Server.MaxClientExtractions >= 1, "server.max_client_extractions must be at least 1")
+	check(c.Server.MaxClientConnections >= 1, "server.max_client_connections must be at least 1")
+	check(c.Storage.DataDir != "", "storage.data_dir must not be empty")
+	check(c.Image.MaxBytes > 0, "image.max_bytes must be positive")
+	check(c.Image.MaxDimension >= 0, "image.max_dimension must not be negative")
+	check(c.Extractor.Timeout > 0, "extractor.timeout must be positive")
+	check(c.Watch.Settle > 0, "watch.settle must be positive")
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json, got %q", c.Log.Format)
+	return errors.Join(errs...)
+}
+
+// String renders the config as YAML.
+func (c *Config) String() string {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return fmt.Sprintf("<failed to marshal config: %v>", err)
+	}
+	return string(data)
+}
+
+// SetupLogging installs the configured default logger, writing to stderr.
+func (c *Config) SetupLogging() error {
+	return logging.Setup(os.Stderr, c.Log.Format, c.Log.Level)
+}
+
+// ExtractorOptions returns the options for the extractors.
+func (c *Config) ExtractorOptions() extractors.Options {
+	return extractors.Options{
+		Timeout:           time.Duration(c.Extractor.Timeout),
+		UserAgent:         c.Extractor.UserAgent,
+		Anonymize:         c.Extractor.Anonymize,
+		MaxImageBytes:     c.Image.MaxBytes,
+		MaxImageDimension: c.Image.MaxDimension,
+	}
+}
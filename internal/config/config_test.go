@@ -0,0 +1,72 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "charex.yaml")
+	err := os.WriteFile(file, []byte("server:\n  port: \"8000\"\nextractor:\n  user_agent: from-file\n  timeout: 10s\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		file          string
+		env           map[string]string
+		overrides     []string
+		wantPort      string
+		wantUserAgent string
+		wantTimeout   time.Duration
+	}{
+		{"defaults", "", nil, nil, "9111", "", 30 * time.Second},
+		{"file over defaults", file, nil, nil, "8000", "from-file", 10 * time.Second},
+		{"file named by the environment", "", map[string]string{EnvFile: file}, nil, "8000", "from-file", 10 * time.Second},
+		{"environment over file", file, map[string]string{"PORT": "8001", "EXTRACTOR_USER_AGENT": "from-env"}, nil, "8001", "from-env", 10 * time.Second},
+		{"empty environment keeps file", file, map[string]string{"PORT": ""}, nil, "8000", "from-file", 10 * time.Second},
+		{"overrides over environment", file, map[string]string{"PORT": "8001", "EXTRACTOR_USER_AGENT": "from-env"},
+			[]string{"server.port=8002", "extractor.timeout=5s"}, "8002", "from-env", 5 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, env := range []string{EnvFile, "PORT", "EXTRACTOR_USER_AGENT", "EXTRACTOR_TIMEOUT"} {
+				t.Setenv(env, tt.env[env])
+			}
+			c, err := Load(tt.file, tt.overrides)
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if c.Server.Port != tt.wantPort || c.Extractor.UserAgent != tt.wantUserAgent || time.Duration(c.Extractor.Timeout) != tt.wantTimeout {
+				t.Errorf("port %q, user agent %q, timeout %v; want %q, %q, %v",
+					c.Server.Port, c.Extractor.UserAgent, time.Duration(c.Extractor.Timeout), tt.wantPort, tt.wantUserAgent, tt.wantTimeout)
+			}
+		})
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	t.Setenv(EnvFile, "")
+	file := filepath.Join(t.TempDir(), "charex.yaml")
+	if err := os.WriteFile(file, []byte("server:\n  prot: \"8000\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name      string
+		file      string
+		overrides []string
+	}{
+		{"unknown file key", file, nil},
+		{"missing file", filepath.Join(t.TempDir(), "missing.yaml"), nil},
+		{"unknown override", "", []string{"server.prot=8000"}},
+		{"invalid override", "", []string{"extractor.timeout=soon"}},
+	}
+	for _, tt := range tests {
+		if _, err := Load(tt.file, tt.overrides); err == nil {
+			t.Errorf("%s: Load succeeded", tt.name)
+		}
+	}
+}
@@ -10,21 +10,21 @@ type TavernCardV2 struct {
 
 // TavernCardData contains the core character information.
 type TavernCardData struct {
-	Name                   string                 `json:"name"`
-	Description            string                 `json:"description"`
-	Personality            string                 `json:"personality"`
-	Scenario               string                 `json:"scenario"`
-	FirstMes               string                 `json:"first_mes"`
-	MesExample             string                 `json:"mes_example"`
-	CreatorNotes           string                 `json:"creator_notes"`
-	SystemPrompt           string                 `json:"system_prompt"`
+	Name                    string                 `json:"name"`
+	Description             string                 `json:"description"`
+	Personality             string                 `json:"personality"`
+	Scenario                string                 `json:"scenario"`
+	FirstMes                string                 `json:"first_mes"`
+	MesExample              string                 `json:"mes_example"`
+	CreatorNotes            string                 `json:"creator_notes"`
+	SystemPrompt            string                 `json:"system_prompt"`
 	PostHistoryInstructions string                 `json:"post_history_instructions"`
-	AlternateGreetings     []string               `json:"alternate_greetings"`
-	CharacterBook          *CharacterBook         `json:"character_book,omitempty"`
-	Tags                   []string               `json:"tags"`
-	Creator                string                 `json:"creator"`
-	CharacterVersion       string                 `json:"character_version"`
-	Extensions             map[string]interface{} `json:"extensions"`
+	AlternateGreetings      []string               `json:"alternate_greetings"`
+	CharacterBook           *CharacterBook         `json:"character_book,omitempty"`
+	Tags                    []string               `json:"tags"`
+	Creator                 string                 `json:"creator"`
+	CharacterVersion        string                 `json:"character_version"`
+	Extensions              map[string]interface{} `json:"extensions"`
 }
 
 // CharacterBook represents a character-specific lorebook.
@@ -53,5 +53,6 @@ type BookEntry struct {
 	Selective      bool                   `json:"selective,omitempty"`
 	SecondaryKeys  []string               `json:"secondary_keys,omitempty"`
 	Constant       bool                   `json:"constant,omitempty"`
+	UseRegex       bool                   `json:"use_regex,omitempty"` // V3 only.
 	Position       string                 `json:"position,omitempty"`
-}
\ No newline at end of file
+}
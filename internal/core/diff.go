@@ -0,0 +1,151 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Kinds of change reported by Diff.
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// FieldChange describes a single field that differs between two cards.
+type FieldChange struct {
+	Field string `json:"field"` // e.g. "description", "alternate_greetings[1]", "character_book.entries[Castle].content"
+	Kind  string `json:"kind"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Diff returns the field-level differences between two cards, in a stable order.
+// Greetings are compared by position; lorebook entries are matched by ID, name or keys
+// so that inserting an entry does not report every following entry as changed.
+func Diff(oldCard, newCard *TavernCardV2) []FieldChange {
+	var d differ
+	a, b := &oldCard.Data, &newCard.Data
+
+	d.str("name", a.Name, b.Name)
+	d.str("description", a.Description, b.Description)
+	d.str("personality", a.Personality, b.Personality)
+	d.str("scenario", a.Scenario, b.Scenario)
+	d.str("first_mes", a.FirstMes, b.FirstMes)
+	d.str("mes_example", a.MesExample, b.MesExample)
+	d.str("creator_notes", a.CreatorNotes, b.CreatorNotes)
+	d.str("system_prompt", a.SystemPrompt, b.SystemPrompt)
+	d.str("post_history_instructions", a.PostHistoryInstructions, b.PostHistoryInstructions)
+	d.list("alternate_greetings", a.AlternateGreetings, b.AlternateGreetings)
+	d.str("tags", strings.Join(a.Tags, ", "), strings.Join(b.Tags, ", "))
+	d.str("creator", a.Creator, b.Creator)
+	d.str("character_version", a.CharacterVersion, b.CharacterVersion)
+	d.book(a.CharacterBook, b.CharacterBook)
+
+	return d.changes
+}
+
+type differ struct {
+	changes []FieldChange
+}
+
+func (d *differ) str(field, oldVal, newVal string) {
+	switch {
+	case oldVal == newVal:
+	case oldVal == "":
+		d.changes = append(d.changes, FieldChange{Field: field, Kind: ChangeAdded, New: newVal})
+	case newVal == "":
+		d.changes = append(d.changes, FieldChange{Field: field, Kind: ChangeRemoved, Old: oldVal})
+	default:
+		d.changes = append(d.changes, FieldChange{Field: field, Kind: ChangeChanged, Old: oldVal, New: newVal})
+	}
+}
+
+func (d *differ) list(field string, oldVals, newVals []string) {
+	for i := 0; i < len(oldVals) || i < len(newVals); i++ {
+		name := fmt.Sprintf("%s[%d]", field, i)
+		switch {
+		case i >= len(oldVals):
+			d.changes = append(d.changes, FieldChange{Field: name, Kind: ChangeAdded, New: newVals[i]})
+		case i >= len(newVals):
+			d.changes = append(d.changes, FieldChange{Field: name, Kind: ChangeRemoved, Old: oldVals[i]})
+		default:
+			d.str(name, oldVals[i], newVals[i])
+		}
+	}
+}
+
+func (d *differ) book(oldBook, newBook *CharacterBook) {
+	if oldBook == nil {
+		oldBook = &CharacterBook{}
+	}
+	if newBook == nil {
+		newBook = &CharacterBook{}
+	}
+	d.str("character_book.name", oldBook.Name, newBook.Name)
+	d.str("character_book.description", oldBook.Description, newBook.Description)
+
+	oldEntries := labelEntries(oldBook.Entries)
+	newEntries := labelEntries(newBook.Entries)
+
+	labels := make([]string, 0, len(oldEntries)+len(newEntries))
+	for label := range oldEntries {
+		labels = append(labels, label)
+	}
+	for label := range newEntries {
+		if _, ok := oldEntries[label]; !ok {
+			labels = append(labels, label)
+		}
+	}
+	sort.Strings(labels)
+
+	for _, label := range labels {
+		prefix := "character_book.entries[" + label + "]"
+		oldEntry, hadOld := oldEntries[label]
+		newEntry, hasNew := newEntries[label]
+		switch {
+		case !hadOld:
+			d.changes = append(d.changes, FieldChange{Field: prefix, Kind: ChangeAdded, New: describeEntry(newEntry)})
+		case !hasNew:
+			d.changes = append(d.changes, FieldChange{Field: prefix, Kind: ChangeRemoved, Old: describeEntry(oldEntry)})
+		default:
+			d.str(prefix+".keys", strings.Join(oldEntry.Keys, ", "), strings.Join(newEntry.Keys, ", "))
+			d.str(prefix+".secondary_keys", strings.Join(oldEntry.SecondaryKeys, ", "), strings.Join(newEntry.SecondaryKeys, ", "))
+			d.str(prefix+".content", oldEntry.Content, newEntry.Content)
+			d.str(prefix+".comment", oldEntry.Comment, newEntry.Comment)
+			d.str(prefix+".enabled", strconv.FormatBool(oldEntry.Enabled), strconv.FormatBool(newEntry.Enabled))
+			d.str(prefix+".constant", strconv.FormatBool(oldEntry.Constant), strconv.FormatBool(newEntry.Constant))
+			d.str(prefix+".insertion_order", strconv.Itoa(oldEntry.InsertionOrder), strconv.Itoa(newEntry.InsertionOrder))
+			d.str(prefix+".position", oldEntry.Position, newEntry.Position)
+		}
+	}
+}
+
+// labelEntries keys lorebook entries by a human-readable identity.
+func labelEntries(entries []BookEntry) map[string]BookEntry {
+	labeled := make(map[string]BookEntry, len(entries))
+	for i, e := range entries {
+		var label string
+		switch {
+		case e.ID != 0:
+			label = "id=" + strconv.Itoa(e.ID)
+		case e.Name != "":
+			label = e.Name
+		case len(e.Keys) > 0:
+			label = strings.Join(e.Keys, ",")
+		default:
+			label = "#" + strconv.Itoa(i)
+		}
+		if _, dup := labeled[label]; dup {
+			label += "#" + strconv.Itoa(i)
+		}
+		labeled[label] = e
+	}
+	return labeled
+}
+
+func describeEntry(e BookEntry) string {
+	return fmt.Sprintf("keys: %s\n%s", strings.Join(e.Keys, ", "), e.Content)
+}
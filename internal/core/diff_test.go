@@ -0,0 +1,90 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	base := func() *TavernCardV2 {
+		return &TavernCardV2{Data: TavernCardData{
+			Name:               "Mira",
+			Description:        "A cartographer.",
+			Scenario:           "Aboard the Gull.",
+			AlternateGreetings: []string{"Hello.", "Welcome aboard."},
+			Tags:               []string{"maps", "sea"},
+			CharacterBook: &CharacterBook{Entries: []BookEntry{
+				{Name: "Isles", Keys: []string{"isles"}, Content: "The Shattered Isles.", Enabled: true},
+				{Keys: []string{"gull"}, Content: "Mira's ship.", Enabled: true},
+			}},
+		}}
+	}
+
+	tests := []struct {
+		name string
+		edit func(c *TavernCardV2)
+		want []FieldChange
+	}{
+		{"unchanged", func(c *TavernCardV2) {}, nil},
+		{"changed, added and removed fields", func(c *TavernCardV2) {
+			c.Data.Description = "A cartographer of the Shattered Isles."
+			c.Data.Personality = "Curious."
+			c.Data.Scenario = ""
+		}, []FieldChange{
+			{Field: "description", Kind: ChangeChanged, Old: "A cartographer.", New: "A cartographer of the Shattered Isles."},
+			{Field: "personality", Kind: ChangeAdded, New: "Curious."},
+			{Field: "scenario", Kind: ChangeRemoved, Old: "Aboard the Gull."},
+		}},
+		{"greetings by position", func(c *TavernCardV2) {
+			c.Data.AlternateGreetings = []string{"Hi."}
+		}, []FieldChange{
+			{Field: "alternate_greetings[0]", Kind: ChangeChanged, Old: "Hello.", New: "Hi."},
+			{Field: "alternate_greetings[1]", Kind: ChangeRemoved, Old: "Welcome aboard."},
+		}},
+		{"tags", func(c *TavernCardV2) {
+			c.Data.Tags = []string{"maps", "fantasy"}
+		}, []FieldChange{
+			{Field: "tags", Kind: ChangeChanged, Old: "maps, sea", New: "maps, fantasy"},
+		}},
+		{"book entries", func(c *TavernCardV2) {
+			// Inserting an entry first must not report the others as changed.
+			c.Data.CharacterBook.Entries = []BookEntry{
+				{Keys: []string{"compass"}, Content: "A brass compass.", Enabled: true},
+				{Name: "Isles", Keys: []string{"isles", "archipelago"}, Content: "The Shattered Isles.", Enabled: false},
+			}
+		}, []FieldChange{
+			{Field: "character_book.entries[Isles].keys", Kind: ChangeChanged, Old: "isles", New: "isles, archipelago"},
+			{Field: "character_book.entries[Isles].enabled", Kind: ChangeChanged, Old: "true", New: "false"},
+			{Field: "character_book.entries[compass]", Kind: ChangeAdded, New: "keys: compass\nA brass compass."},
+			{Field: "character_book.entries[gull]", Kind: ChangeRemoved, Old: "keys: gull\nMira's ship."},
+		}},
+		{"book removed", func(c *TavernCardV2) {
+			c.Data.CharacterBook = nil
+		}, []FieldChange{
+			{Field: "character_book.entries[Isles]", Kind: ChangeRemoved, Old: "keys: isles\nThe Shattered Isles."},
+			{Field: "character_book.entries[gull]", Kind: ChangeRemoved, Old: "keys: gull\nMira's ship."},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			edited := base()
+			tt.edit(edited)
+			if got := Diff(base(), edited); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDiffMatchesEntriesByID(t *testing.T) {
+	oldCard := &TavernCardV2{Data: TavernCardData{CharacterBook: &CharacterBook{Entries: []BookEntry{
+		{ID: 1, Keys: []string{"isles"}, Content: "The Shattered Isles."},
+	}}}}
+	newCard := &TavernCardV2{Data: TavernCardData{CharacterBook: &CharacterBook{Entries: []BookEntry{
+		{ID: 1, Keys: []string{"islands"}, Content: "The Shattered Isles."},
+	}}}}
+	want := []FieldChange{{Field: "character_book.entries[id=1].keys", Kind: ChangeChanged, Old: "isles", New: "islands"}}
+	if got := Diff(oldCard, newCard); !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff = %+v, want %+v", got, want)
+	}
+}
@@ -0,0 +1,273 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldStrategy decides how one field of two cards is combined.
+type FieldStrategy string
+
+// Available field strategies.
+const (
+	PreferBase     FieldStrategy = "prefer-base"      // Always keep the base value.
+	PreferOther    FieldStrategy = "prefer-other"     // Take the other value unless it is empty.
+	PreferNonEmpty FieldStrategy = "prefer-non-empty" // Keep the base value unless it is empty.
+	PreferLonger   FieldStrategy = "prefer-longer"    // Keep whichever value is longer (or has more items).
+	Union          FieldStrategy = "union"            // Combine list items, dropping duplicates.
+)
+
+// MergeStrategy selects a FieldStrategy for every card field.
+type MergeStrategy struct {
+	Text   FieldStrategy            // Default for text fields.
+	Lists  FieldStrategy            // Default for tags, alternate_greetings and character_book.
+	Fields map[string]FieldStrategy // Overrides keyed by JSON field name, e.g. "description".
+}
+
+// DefaultMergeStrategy fills empty text fields and unions lists.
+func DefaultMergeStrategy() MergeStrategy {
+	return MergeStrategy{Text: PreferNonEmpty, Lists: Union}
+}
+
+// mergeTextFields and mergeListFields are the field names accepted in MergeStrategy.Fields.
+var (
+	mergeTextFields = []string{"name", "description", "personality", "scenario", "first_mes", "mes_example",
+		"creator_notes", "system_prompt", "post_history_instructions", "creator"}
+	mergeListFields = []string{"alternate_greetings", "tags", "character_book"}
+)
+
+// ParseMergeStrategy parses a comma-separated list of field=strategy pairs, starting
+// from DefaultMergeStrategy. The pseudo-fields "text" and "lists" set the defaults,
+// e.g. "text=prefer-longer,tags=prefer-base".
+func ParseMergeStrategy(spec string) (MergeStrategy, error) {
+	strategy := DefaultMergeStrategy()
+	strategy.Fields = make(map[string]FieldStrategy)
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		field, value, ok := strings.Cut(part, "=")
+		if !ok {
+			return strategy, fmt.Errorf("invalid merge strategy %q: expected field=strategy", part)
+		}
+		field, fs := strings.TrimSpace(field), FieldStrategy(strings.TrimSpace(value))
+		isList := field == "lists" || contains(mergeListFields, field)
+		if !isList && field != "text" && !contains(mergeTextFields, field) {
+			return strategy, fmt.Errorf("unknown merge field %q", field)
+		}
+		if err := fs.validate(isList); err != nil {
+			return strategy, fmt.Errorf("field %q: %w", field, err)
+		}
+		switch field {
+		case "text":
+			strategy.Text = fs
+		case "lists":
+			strategy.Lists = fs
+		default:
+			strategy.Fields[field] = fs
+		}
+	}
+	return strategy, nil
+}
+
+func (fs FieldStrategy) validate(list bool) error {
+	switch fs {
+	case PreferBase, PreferOther, PreferNonEmpty, PreferLonger:
+		return nil
+	case Union:
+		if list {
+			return nil
+		}
+		return fmt.Errorf("strategy %q only applies to lists", fs)
+	}
+	return fmt.Errorf("unknown strategy %q", fs)
+}
+
+func (s MergeStrategy) forText(field string) FieldStrategy {
+	if fs, ok := s.Fields[field]; ok {
+		return fs
+	}
+	if s.Text == "" {
+		return PreferNonEmpty
+	}
+	return s.Text
+}
+
+func (s MergeStrategy) forList(field string) FieldStrategy {
+	if fs, ok := s.Fields[field]; ok {
+		return fs
+	}
+	if s.Lists == "" {
+		return Union
+	}
+	return s.Lists
+}
+
+// Merge combines two extractions of the same character into one card. The result
+// starts as a copy of base; each field is then resolved with the strategy's rule.
+func Merge(base, other *TavernCardV2, strategy MergeStrategy) *TavernCardV2 {
+	merged := *base
+	d, b, o := &merged.Data, &base.Data, &other.Data
+
+	d.Name = mergeText(strategy.forText("name"), b.Name, o.Name)
+	d.Description = mergeText(strategy.forText("description"), b.Description, o.Description)
+	d.Personality = mergeText(strategy.forText("personality"), b.Personality, o.Personality)
+	d.Scenario = mergeText(strategy.forText("scenario"), b.Scenario, o.Scenario)
+	d.FirstMes = mergeText(strategy.forText("first_mes"), b.FirstMes, o.FirstMes)
+	d.MesExample = mergeText(strategy.forText("mes_example"), b.MesExample, o.MesExample)
+	d.CreatorNotes = mergeText(strategy.forText("creator_notes"), b.CreatorNotes, o.CreatorNotes)
+	d.SystemPrompt = mergeText(strategy.forText("system_prompt"), b.SystemPrompt, o.SystemPrompt)
+	d.PostHistoryInstructions = mergeText(strategy.forText("post_history_instructions"), b.PostHistoryInstructions, o.PostHistoryInstructions)
+
+	// Extractors fill in placeholder creators when the source does not name one.
+	d.Creator = mergeText(strategy.forText("creator"), realCreator(b.Creator), realCreator(o.Creator))
+	if d.Creator == "" {
+		d.Creator = b.Creator
+	}
+
+	d.AlternateGreetings = mergeList(strategy.forList("alternate_greetings"), b.AlternateGreetings, o.AlternateGreetings)
+	d.Tags = mergeList(strategy.forList("tags"), b.Tags, o.Tags)
+	d.CharacterBook = mergeBook(strategy.forList("character_book"), b.CharacterBook, o.CharacterBook)
+
+	d.Extensions = make(map[string]interface{}, len(b.Extensions)+len(o.Extensions))
+	for k, v := range o.Extensions {
+		d.Extensions[k] = v
+	}
+	for k, v := range b.Extensions {
+		d.Extensions[k] = v
+	}
+
+	if merged.DisplayName == "" || d.Name != b.Name {
+		merged.DisplayName = d.Name
+	}
+	return &merged
+}
+
+func realCreator(creator string) string {
+	if creator == "charex" || creator == "Anonymous" {
+		return ""
+	}
+	return creator
+}
+
+func mergeText(fs FieldStrategy, base, other string) string {
+	baseEmpty, otherEmpty := strings.TrimSpace(base) == "", strings.TrimSpace(other) == ""
+	switch fs {
+	case PreferBase:
+		return base
+	case PreferOther:
+		if otherEmpty {
+			return base
+		}
+		return other
+	case PreferLonger:
+		if len(strings.TrimSpace(other)) > len(strings.TrimSpace(base)) {
+			return other
+		}
+		return base
+	default: // PreferNonEmpty
+		if baseEmpty {
+			return other
+		}
+		return base
+	}
+}
+
+func mergeList(fs FieldStrategy, base, other []string) []string {
+	var out []string
+	switch fs {
+	case PreferBase:
+		out = base
+	case PreferOther:
+		out = other
+		if len(other) == 0 {
+			out = base
+		}
+	case PreferNonEmpty:
+		out = base
+		if len(base) == 0 {
+			out = other
+		}
+	case PreferLonger:
+		out = base
+		if len(other) > len(base) {
+			out = other
+		}
+	default: // Union
+		seen := make(map[string]bool, len(base)+len(other))
+		for _, s := range append(append([]string{}, base...), other...) {
+			key := strings.TrimSpace(s)
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			out = append(out, s)
+		}
+	}
+	return append([]string{}, out...)
+}
+
+func mergeBook(fs FieldStrategy, base, other *CharacterBook) *CharacterBook {
+	if base == nil || len(base.Entries) == 0 {
+		if fs == PreferBase {
+			return base
+		}
+		return other
+	}
+	if other == nil || len(other.Entries) == 0 {
+		return base
+	}
+
+	switch fs {
+	case PreferBase, PreferNonEmpty:
+		return base
+	case PreferOther:
+		return other
+	case PreferLonger:
+		if len(other.Entries) > len(base.Entries) {
+			return other
+		}
+		return base
+	}
+
+	// Union: keep every base entry and append other entries whose keys and content are new.
+	merged := *base
+	merged.Name = mergeText(PreferNonEmpty, base.Name, other.Name)
+	merged.Description = mergeText(PreferNonEmpty, base.Description, other.Description)
+	merged.Entries = append([]BookEntry(nil), base.Entries...)
+
+	seen := make(map[string]bool, len(merged.Entries))
+	maxID := 0
+	for _, e := range merged.Entries {
+		seen[entryKey(e)] = true
+		if e.ID > maxID {
+			maxID = e.ID
+		}
+	}
+	for _, e := range other.Entries {
+		if seen[entryKey(e)] {
+			continue
+		}
+		seen[entryKey(e)] = true
+		if e.ID != 0 {
+			maxID++
+			e.ID = maxID
+		}
+		merged.Entries = append(merged.Entries, e)
+	}
+	return &merged
+}
+
+func entryKey(e BookEntry) string {
+	return strings.ToLower(strings.Join(e.Keys, "\x00")) + "\x01" + strings.TrimSpace(e.Content)
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,141 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMergeStrategy(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    MergeStrategy
+		wantErr string
+	}{
+		{"", MergeStrategy{Text: PreferNonEmpty, Lists: Union, Fields: map[string]FieldStrategy{}}, ""},
+		{" text = prefer-longer , tags=prefer-base,", MergeStrategy{Text: PreferLonger, Lists: Union, Fields: map[string]FieldStrategy{"tags": PreferBase}}, ""},
+		{"lists=prefer-other,description=prefer-other", MergeStrategy{Text: PreferNonEmpty, Lists: PreferOther, Fields: map[string]FieldStrategy{"description": PreferOther}}, ""},
+		{"character_book=union", MergeStrategy{Text: PreferNonEmpty, Lists: Union, Fields: map[string]FieldStrategy{"character_book": Union}}, ""},
+		{"description", MergeStrategy{}, "expected field=strategy"},
+		{"avatar=prefer-base", MergeStrategy{}, `unknown merge field "avatar"`},
+		{"text=prefer-newest", MergeStrategy{}, `unknown strategy "prefer-newest"`},
+		{"description=union", MergeStrategy{}, "only applies to lists"},
+		{"text=union", MergeStrategy{}, "only applies to lists"},
+	}
+	for _, tt := range tests {
+		got, err := ParseMergeStrategy(tt.spec)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ParseMergeStrategy(%q) error = %v, want %q", tt.spec, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseMergeStrategy(%q): %v", tt.spec, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseMergeStrategy(%q) = %+v, want %+v", tt.spec, got, tt.want)
+		}
+	}
+}
+
+func TestMergeText(t *testing.T) {
+	tests := []struct {
+		strategy    FieldStrategy
+		base, other string
+		want        string
+	}{
+		{PreferBase, "", "other", ""},
+		{PreferOther, "base", "other", "other"},
+		{PreferOther, "base", "  ", "base"},
+		{PreferNonEmpty, "base", "other", "base"},
+		{PreferNonEmpty, " ", "other", "other"},
+		{PreferLonger, "short", "much longer", "much longer"},
+		{PreferLonger, "same!", "equal", "same!"},
+	}
+	for _, tt := range tests {
+		base := &TavernCardV2{Data: TavernCardData{Name: "Mira", Description: tt.base}}
+		other := &TavernCardV2{Data: TavernCardData{Name: "Mira", Description: tt.other}}
+		strategy := MergeStrategy{Fields: map[string]FieldStrategy{"description": tt.strategy}}
+		if got := Merge(base, other, strategy).Data.Description; got != tt.want {
+			t.Errorf("%s of %q and %q = %q, want %q", tt.strategy, tt.base, tt.other, got, tt.want)
+		}
+	}
+}
+
+func TestMergeLists(t *testing.T) {
+	base, other := []string{"fantasy", "maps"}, []string{"maps ", "travel", "sea"}
+	tests := []struct {
+		strategy FieldStrategy
+		want     []string
+	}{
+		{PreferBase, []string{"fantasy", "maps"}},
+		{PreferOther, []string{"maps ", "travel", "sea"}},
+		{PreferNonEmpty, []string{"fantasy", "maps"}},
+		{PreferLonger, []string{"maps ", "travel", "sea"}},
+		{Union, []string{"fantasy", "maps", "travel", "sea"}},
+	}
+	for _, tt := range tests {
+		merged := Merge(&TavernCardV2{Data: TavernCardData{Tags: base}}, &TavernCardV2{Data: TavernCardData{Tags: other}}, MergeStrategy{Lists: tt.strategy})
+		if !reflect.DeepEqual(merged.Data.Tags, tt.want) {
+			t.Errorf("%s tags = %q, want %q", tt.strategy, merged.Data.Tags, tt.want)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	base := &TavernCardV2{
+		DisplayName: "Mira",
+		Data: TavernCardData{
+			Name:        "Mira",
+			Description: "A cartographer.",
+			Creator:     "Anonymous",
+			Tags:        []string{"maps"},
+			CharacterBook: &CharacterBook{Entries: []BookEntry{
+				{ID: 1, Keys: []string{"isles"}, Content: "The Shattered Isles."},
+			}},
+			Extensions: map[string]interface{}{"source": "base"},
+		},
+	}
+	other := &TavernCardV2{
+		Data: TavernCardData{
+			Name:        "Mira Vell",
+			Description: "A cartographer of the Shattered Isles.",
+			Scenario:    "Aboard the Gull.",
+			Creator:     "ink",
+			Tags:        []string{"maps", "sea"},
+			CharacterBook: &CharacterBook{Entries: []BookEntry{
+				{ID: 1, Keys: []string{"Isles"}, Content: "The Shattered Isles."},
+				{ID: 2, Keys: []string{"gull"}, Content: "Mira's ship."},
+			}},
+			Extensions: map[string]interface{}{"source": "other", "depth": 4},
+		},
+	}
+
+	merged := Merge(base, other, MergeStrategy{Text: PreferNonEmpty, Lists: Union, Fields: map[string]FieldStrategy{"name": PreferOther}})
+	d := merged.Data
+	if d.Name != "Mira Vell" || merged.DisplayName != "Mira Vell" {
+		t.Errorf("name = %q, display name %q; want the other name", d.Name, merged.DisplayName)
+	}
+	if d.Description != base.Data.Description || d.Scenario != other.Data.Scenario {
+		t.Errorf("description %q, scenario %q; want base description and other scenario", d.Description, d.Scenario)
+	}
+	// A placeholder creator gives way to a real one.
+	if d.Creator != "ink" {
+		t.Errorf("creator = %q, want ink", d.Creator)
+	}
+	if !reflect.DeepEqual(d.Tags, []string{"maps", "sea"}) {
+		t.Errorf("tags = %q", d.Tags)
+	}
+	// Entries with the same keys and content are kept once, new ones get fresh IDs.
+	if entries := d.CharacterBook.Entries; len(entries) != 2 || entries[1].Content != "Mira's ship." || entries[1].ID != 2 {
+		t.Errorf("book entries = %+v", entries)
+	}
+	if d.Extensions["source"] != "base" || d.Extensions["depth"] != 4 {
+		t.Errorf("extensions = %v, want base values over other ones", d.Extensions)
+	}
+	if len(base.Data.Tags) != 1 || len(base.Data.CharacterBook.Entries) != 1 {
+		t.Error("Merge modified the base card")
+	}
+}
@@ -0,0 +1,26 @@
+package core
+
+import (
+	"strings"
+	"unicode"
+)
+
+// EstimateTokens approximates how many tokens text takes in common LLM
+// tokenizers without depending on any of them: about four characters per
+// token for alphabetic scripts, one token per CJK character, and never fewer
+// tokens than words.
+func EstimateTokens(text string) int {
+	var alphabetic, cjk int
+	for _, r := range text {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) {
+			cjk++
+		} else {
+			alphabetic++
+		}
+	}
+	estimate := (alphabetic+3)/4 + cjk
+	if words := len(strings.Fields(text)); words > estimate {
+		estimate = words
+	}
+	return estimate
+}
@@ -0,0 +1,82 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// TavernCardV1 represents the original, unversioned card format: a flat object
+// holding only the basic character fields.
+type TavernCardV1 struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Personality string `json:"personality"`
+	Scenario    string `json:"scenario"`
+	FirstMes    string `json:"first_mes"`
+	MesExample  string `json:"mes_example"`
+}
+
+// ToV2 upgrades a V1 card to V2, leaving the fields V1 lacks empty.
+func (c *TavernCardV1) ToV2() *TavernCardV2 {
+	return &TavernCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data: TavernCardData{
+			Name:               c.Name,
+			Description:        c.Description,
+			Personality:        c.Personality,
+			Scenario:           c.Scenario,
+			FirstMes:           c.FirstMes,
+			MesExample:         c.MesExample,
+			AlternateGreetings: []string{},
+			Tags:               []string{},
+			Extensions:         make(map[string]interface{}),
+		},
+		DisplayName: c.Name,
+	}
+}
+
+// ToV1 returns the V1 view of a V2 card, keeping only the basic fields.
+func (c *TavernCardV2) ToV1() *TavernCardV1 {
+	return &TavernCardV1{
+		Name:        c.Data.Name,
+		Description: c.Data.Description,
+		Personality: c.Data.Personality,
+		Scenario:    c.Data.Scenario,
+		FirstMes:    c.Data.FirstMes,
+		MesExample:  c.Data.MesExample,
+	}
+}
+
+// V1Losses lists the content of a V2 card that ToV1 drops.
+func (c *TavernCardV2) V1Losses() []ConversionLoss {
+	var losses []ConversionLoss
+	add := func(field, detail string) {
+		losses = append(losses, ConversionLoss{Field: "data." + field, Detail: detail})
+	}
+	d := &c.Data
+	for _, f := range []struct{ name, value string }{
+		{"creator_notes", d.CreatorNotes},
+		{"system_prompt", d.SystemPrompt},
+		{"post_history_instructions", d.PostHistoryInstructions},
+		{"creator", d.Creator},
+		{"character_version", d.CharacterVersion},
+	} {
+		if strings.TrimSpace(f.value) != "" {
+			add(f.name, f.name+" dropped")
+		}
+	}
+	if n := len(nonEmpty(d.AlternateGreetings)); n > 0 {
+		add("alternate_greetings", fmt.Sprintf("%d alternate greeting(s) dropped", n))
+	}
+	if n := len(nonEmpty(d.Tags)); n > 0 {
+		add("tags", fmt.Sprintf("%d tag(s) dropped", n))
+	}
+	if d.CharacterBook != nil && len(d.CharacterBook.Entries) > 0 {
+		add("character_book", fmt.Sprintf("lorebook with %d entry(s) dropped", len(d.CharacterBook.Entries)))
+	}
+	if len(d.Extensions) > 0 {
+		add("extensions", fmt.Sprintf("%d extension field(s) dropped", len(d.Extensions)))
+	}
+	return losses
+}
@@ -0,0 +1,144 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// TavernCardV3 represents the V3 character card structure (chara_card_v3).
+type TavernCardV3 struct {
+	Spec        string           `json:"spec"`
+	SpecVersion string           `json:"spec_version"`
+	Data        TavernCardDataV3 `json:"data"`
+}
+
+// TavernCardDataV3 extends the V2 data with the fields introduced by V3.
+type TavernCardDataV3 struct {
+	TavernCardData
+	Nickname                 string            `json:"nickname,omitempty"`
+	CreatorNotesMultilingual map[string]string `json:"creator_notes_multilingual,omitempty"`
+	Source                   []string          `json:"source,omitempty"`
+	GroupOnlyGreetings       []string          `json:"group_only_greetings"`
+	CreationDate             int64             `json:"creation_date,omitempty"`     // Unix seconds.
+	ModificationDate         int64             `json:"modification_date,omitempty"` // Unix seconds.
+	Assets                   []Asset           `json:"assets,omitempty"`
+}
+
+// Asset references an image or other resource bundled with a V3 card.
+type Asset struct {
+	Type string `json:"type"` // e.g. "icon", "background", "emotion".
+	URI  string `json:"uri"`  // "ccdefault:", "embeded://path" or an http(s)/data URI.
+	Name string `json:"name"`
+	Ext  string `json:"ext"`
+}
+
+// DefaultIconAsset points a V3 card at the image it is embedded in.
+var DefaultIconAsset = Asset{Type: "icon", URI: "ccdefault:", Name: "main", Ext: "png"}
+
+// ToV3 converts a V2 card to V3. The creation and modification times are recorded
+// when non-zero, and hasIcon adds the default icon asset for cards with an image.
+func ToV3(card *TavernCardV2, created, modified time.Time, hasIcon bool) *TavernCardV3 {
+	data := TavernCardDataV3{
+		TavernCardData:     card.Data,
+		GroupOnlyGreetings: []string{},
+	}
+	if data.AlternateGreetings == nil {
+		data.AlternateGreetings = []string{}
+	}
+	if data.Tags == nil {
+		data.Tags = []string{}
+	}
+	if data.Extensions == nil {
+		data.Extensions = make(map[string]interface{})
+	}
+	if !created.IsZero() {
+		data.CreationDate = created.Unix()
+	}
+	if !modified.IsZero() {
+		data.ModificationDate = modified.Unix()
+	}
+	if hasIcon {
+		data.Assets = []Asset{DefaultIconAsset}
+	}
+	return &TavernCardV3{
+		Spec:        "chara_card_v3",
+		SpecVersion: "3.0",
+		Data:        data,
+	}
+}
+
+// ToV2 returns the V2 view of a V3 card. The fields V2 shares with V3 are kept;
+// the V3-only fields are dropped.
+func (c *TavernCardV3) ToV2() *TavernCardV2 {
+	data := c.Data.TavernCardData
+	if data.AlternateGreetings == nil {
+		data.AlternateGreetings = []string{}
+	}
+	if data.Tags == nil {
+		data.Tags = []string{}
+	}
+	if data.Extensions == nil {
+		data.Extensions = make(map[string]interface{})
+	}
+	return &TavernCardV2{
+		Spec:        "chara_card_v2",
+		SpecVersion: "2.0",
+		Data:        data,
+		DisplayName: data.Name,
+	}
+}
+
+// ConversionLoss describes content a conversion cannot carry over.
+type ConversionLoss struct {
+	Field  string `json:"field"`
+	Detail string `json:"detail"`
+}
+
+// V2Losses lists the content of a V3 card that ToV2 drops or that V2
+// frontends ignore.
+func (c *TavernCardV3) V2Losses() []ConversionLoss {
+	var losses []ConversionLoss
+	add := func(field, format string, args ...interface{}) {
+		losses = append(losses, ConversionLoss{Field: "data." + field, Detail: fmt.Sprintf(format, args...)})
+	}
+	d := &c.Data
+	if d.Nickname != "" {
+		add("nickname", "nickname %q dropped", d.Nickname)
+	}
+	if len(d.CreatorNotesMultilingual) > 0 {
+		add("creator_notes_multilingual", "creator notes in %d language(s) dropped", len(d.CreatorNotesMultilingual))
+	}
+	if len(d.Source) > 0 {
+		add("source", "%d source link(s) dropped", len(d.Source))
+	}
+	if n := len(nonEmpty(d.GroupOnlyGreetings)); n > 0 {
+		add("group_only_greetings", "%d group-only greeting(s) dropped", n)
+	}
+	if d.CreationDate != 0 || d.ModificationDate != 0 {
+		add("creation_date", "creation and modification dates dropped")
+	}
+	for _, a := range d.Assets {
+		if a.URI != DefaultIconAsset.URI {
+			add("assets", "%s asset %q (%s) dropped", a.Type, a.Name, a.URI)
+		}
+	}
+	if book := d.CharacterBook; book != nil {
+		var regex, decorated int
+		for _, e := range book.Entries {
+			if e.UseRegex {
+				regex++
+			}
+			if strings.HasPrefix(strings.TrimSpace(e.Content), "@@") {
+				decorated++
+			}
+		}
+		if regex > 0 {
+			add("character_book.entries", "%d entry(s) use regex keys, which V2 frontends match literally", regex)
+		}
+		if decorated > 0 {
+			add("character_book.entries", "%d entry(s) use decorators, which V2 frontends treat as text", decorated)
+		}
+	}
+	return losses
+}
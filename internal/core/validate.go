@@ -0,0 +1,100 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severities of validation issues.
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// ValidationIssue describes one problem found in a card.
+type ValidationIssue struct {
+	Field    string `json:"field"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+func (i ValidationIssue) String() string {
+	return fmt.Sprintf("%s: %s: %s", i.Severity, i.Field, i.Message)
+}
+
+// Validate checks a V2 card against the specification. Errors make the card
+// unusable in frontends; warnings flag content that is probably a mistake.
+func Validate(card *TavernCardV2) []ValidationIssue {
+	var issues []ValidationIssue
+	add := func(severity, field, format string, args ...interface{}) {
+		issues = append(issues, ValidationIssue{Field: field, Severity: severity, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if card.Spec != "chara_card_v2" {
+		add(SeverityError, "spec", "must be \"chara_card_v2\", got %q", card.Spec)
+	}
+	if card.SpecVersion != "2.0" {
+		add(SeverityError, "spec_version", "must be \"2.0\", got %q", card.SpecVersion)
+	}
+
+	d := &card.Data
+	if strings.TrimSpace(d.Name) == "" {
+		add(SeverityError, "data.name", "must not be empty")
+	}
+	if strings.TrimSpace(d.Description) == "" && strings.TrimSpace(d.Personality) == "" {
+		add(SeverityWarning, "data.description", "card has neither a description nor a personality")
+	}
+	if strings.TrimSpace(d.FirstMes) == "" {
+		add(SeverityWarning, "data.first_mes", "card has no first message")
+	}
+	for i, g := range d.AlternateGreetings {
+		if strings.TrimSpace(g) == "" {
+			add(SeverityWarning, fmt.Sprintf("data.alternate_greetings[%d]", i), "greeting is empty")
+		}
+	}
+
+	if book := d.CharacterBook; book != nil {
+		if book.ScanDepth < 0 {
+			add(SeverityError, "data.character_book.scan_depth", "must not be negative")
+		}
+		if book.TokenBudget < 0 {
+			add(SeverityError, "data.character_book.token_budget", "must not be negative")
+		}
+		for i, e := range book.Entries {
+			field := fmt.Sprintf("data.character_book.entries[%d]", i)
+			if len(nonEmpty(e.Keys)) == 0 && !e.Constant {
+				add(SeverityError, field+".keys", "entry has no keys and is not constant, so it can never trigger")
+			}
+			if strings.TrimSpace(e.Content) == "" {
+				add(SeverityWarning, field+".content", "entry is empty")
+			}
+			if e.Selective && len(nonEmpty(e.SecondaryKeys)) == 0 {
+				add(SeverityWarning, field+".secondary_keys", "entry is selective but has no secondary keys")
+			}
+			if e.Position != "" && e.Position != "before_char" && e.Position != "after_char" {
+				add(SeverityError, field+".position", "must be \"before_char\" or \"after_char\", got %q", e.Position)
+			}
+		}
+	}
+	return issues
+}
+
+// HasErrors reports whether any issue has error severity.
+func HasErrors(issues []ValidationIssue) bool {
+	for _, i := range issues {
+		if i.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func nonEmpty(values []string) []string {
+	var out []string
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
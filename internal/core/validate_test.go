@@ -0,0 +1,81 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	valid := func() *TavernCardV2 {
+		return &TavernCardV2{
+			Spec:        "chara_card_v2",
+			SpecVersion: "2.0",
+			Data: TavernCardData{
+				Name:        "Mira",
+				Description: "A cartographer.",
+				FirstMes:    "Hello.",
+				CharacterBook: &CharacterBook{Entries: []BookEntry{
+					{Keys: []string{"isles"}, Content: "The Shattered Isles.", Position: "before_char"},
+					{Constant: true, Content: "Mira is always polite."},
+				}},
+			},
+		}
+	}
+
+	// issue abbreviates the expected issues to severity and field.
+	type issue struct{ severity, field string }
+	tests := []struct {
+		name string
+		edit func(c *TavernCardV2)
+		want []issue
+	}{
+		{"valid", func(c *TavernCardV2) {}, nil},
+		{"spec and version", func(c *TavernCardV2) {
+			c.Spec, c.SpecVersion = "chara_card_v3", "3.0"
+		}, []issue{{SeverityError, "spec"}, {SeverityError, "spec_version"}}},
+		{"missing required fields", func(c *TavernCardV2) {
+			c.Data.Name, c.Data.Description, c.Data.FirstMes = " ", "", ""
+		}, []issue{{SeverityError, "data.name"}, {SeverityWarning, "data.description"}, {SeverityWarning, "data.first_mes"}}},
+		{"personality stands in for a description", func(c *TavernCardV2) {
+			c.Data.Description, c.Data.Personality = "", "Curious."
+		}, nil},
+		{"empty greeting", func(c *TavernCardV2) {
+			c.Data.AlternateGreetings = []string{"Hi.", ""}
+		}, []issue{{SeverityWarning, "data.alternate_greetings[1]"}}},
+		{"book limits", func(c *TavernCardV2) {
+			c.Data.CharacterBook.ScanDepth, c.Data.CharacterBook.TokenBudget = -1, -1
+		}, []issue{{SeverityError, "data.character_book.scan_depth"}, {SeverityError, "data.character_book.token_budget"}}},
+		{"book entries", func(c *TavernCardV2) {
+			c.Data.CharacterBook.Entries = []BookEntry{
+				{Keys: []string{" "}, Content: "Never triggers."},
+				{Keys: []string{"gull"}, Content: " ", Selective: true, Position: "top"},
+			}
+		}, []issue{
+			{SeverityError, "data.character_book.entries[0].keys"},
+			{SeverityWarning, "data.character_book.entries[1].content"},
+			{SeverityWarning, "data.character_book.entries[1].secondary_keys"},
+			{SeverityError, "data.character_book.entries[1].position"},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			card := valid()
+			tt.edit(card)
+			issues := Validate(card)
+			var got []issue
+			for _, i := range issues {
+				got = append(got, issue{i.Severity, i.Field})
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Validate = %v, want %v", issues, tt.want)
+			}
+			wantErrors := false
+			for _, i := range tt.want {
+				wantErrors = wantErrors || i.severity == SeverityError
+			}
+			if HasErrors(issues) != wantErrors {
+				t.Errorf("HasErrors = %v, want %v", !wantErrors, wantErrors)
+			}
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// Package dedup fingerprints character cards so that the same character
+// extracted from different sources can be recognised as a likely duplicate.
+package dedup
+
+import (
+	"bytes"
+	"charex/internal/core"
+	"hash/fnv"
+	"image"
+	_ "image/jpeg" // Register decoders for avatar hashing.
+	_ "image/png"
+	"math/bits"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Thresholds, in differing bits out of 64, below which two fingerprints are considered close.
+const (
+	TextThreshold  = 10
+	ImageThreshold = 6
+)
+
+// shingleSize is the number of consecutive words hashed together.
+const shingleSize = 3
+
+// Fingerprint summarises a card's text and avatar.
+type Fingerprint struct {
+	Text     uint64 `json:"text"`  // SimHash of the normalized description and first message.
+	Image    uint64 `json:"image"` // Difference hash of the avatar.
+	HasText  bool   `json:"has_text"`
+	HasImage bool   `json:"has_image"`
+}
+
+// Match is the result of comparing two fingerprints.
+type Match struct {
+	TextDistance  int  `json:"text_distance"`
+	ImageDistance int  `json:"image_distance"` // -1 when either card has no avatar.
+	Duplicate     bool `json:"duplicate"`
+}
+
+// Item pairs a card identifier with its fingerprint.
+type Item struct {
+	ID          string
+	Fingerprint Fingerprint
+}
+
+var placeholderRegex = regexp.MustCompile(`\{\{\s*(char|user)\s*\}\}`)
+
+// FingerprintCard computes the fingerprint of a card and its optional PNG/JPEG avatar.
+func FingerprintCard(card *core.TavernCardV2, avatar []byte) Fingerprint {
+	var fp Fingerprint
+	text := normalize(card.Data.Description+"\n"+card.Data.FirstMes, card.Data.Name)
+	if len(text) > 0 {
+		fp.Text = simHash(shingles(text))
+		fp.HasText = true
+	}
+	if len(avatar) > 0 {
+		if h, ok := dHash(avatar); ok {
+			fp.Image = h
+			fp.HasImage = true
+		}
+	}
+	return fp
+}
+
+// Compare measures how close two fingerprints are. Cards are flagged as duplicates when
+// their text is close, or when their avatars are near-identical and their text is at
+// least loosely related (shared stock avatars alone are not enough).
+func Compare(a, b Fingerprint) Match {
+	m := Match{TextDistance: 64, ImageDistance: -1}
+	if a.HasText && b.HasText {
+		m.TextDistance = bits.OnesCount64(a.Text ^ b.Text)
+	}
+	if a.HasImage && b.HasImage {
+		m.ImageDistance = bits.OnesCount64(a.Image ^ b.Image)
+	}
+	textClose := m.TextDistance <= TextThreshold
+	imageClose := m.ImageDistance >= 0 && m.ImageDistance <= ImageThreshold
+	m.Duplicate = textClose || (imageClose && m.TextDistance <= 2*TextThreshold)
+	return m
+}
+
+// Groups clusters items whose fingerprints are pairwise duplicates (transitively),
+// returning only clusters with more than one member.
+func Groups(items []Item) [][]string {
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	for i := range items {
+		for j := i + 1; j < len(items); j++ {
+			if Compare(items[i].Fingerprint, items[j].Fingerprint).Duplicate {
+				parent[find(j)] = find(i)
+			}
+		}
+	}
+
+	clusters := make(map[int][]string)
+	var order []int
+	for i, item := range items {
+		root := find(i)
+		if _, ok := clusters[root]; !ok {
+			order = append(order, root)
+		}
+		clusters[root] = append(clusters[root], item.ID)
+	}
+	var groups [][]string
+	for _, root := range order {
+		if len(clusters[root]) > 1 {
+			groups = append(groups, clusters[root])
+		}
+	}
+	return groups
+}
+
+// normalize lowercases the text, strips punctuation and replaces the character's
+// name with a placeholder so anonymized and non-anonymized extractions agree.
+func normalize(text, name string) []string {
+	text = placeholderRegex.ReplaceAllString(strings.ToLower(text), " $1 ")
+	words := splitWords(text)
+	nameWords := splitWords(strings.ToLower(name))
+	if len(nameWords) == 0 {
+		return words
+	}
+
+	out := words[:0]
+	for i := 0; i < len(words); i++ {
+		if i+len(nameWords) <= len(words) && slices.Equal(words[i:i+len(nameWords)], nameWords) {
+			out = append(out, "char")
+			i += len(nameWords) - 1
+			continue
+		}
+		out = append(out, words[i])
+	}
+	return out
+}
+
+func splitWords(text string) []string {
+	return strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+func shingles(words []string) []string {
+	if len(words) <= shingleSize {
+		return []string{strings.Join(words, " ")}
+	}
+	out := make([]string, 0, len(words)-shingleSize+1)
+	for i := 0; i+shingleSize <= len(words); i++ {
+		out = append(out, strings.Join(words[i:i+shingleSize], " "))
+	}
+	return out
+}
+
+func simHash(features []string) uint64 {
+	var weights [64]int
+	for _, f := range features {
+		h := fnv.New64a()
+		h.Write([]byte(f))
+		sum := h.Sum64()
+		for bit := 0; bit < 64; bit++ {
+			if sum&(1<<bit) != 0 {
+				weights[bit]++
+			} else {
+				weights[bit]--
+			}
+		}
+	}
+	var hash uint64
+	for bit, w := range weights {
+		if w > 0 {
+			hash |= 1 << bit
+		}
+	}
+	return hash
+}
+
+// dHash computes a 64-bit difference hash: the image is shrunk to 9x8 grayscale
+// and each bit records whether a pixel is brighter than its right-hand neighbour.
+func dHash(data []byte) (uint64, bool) {
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return 0, false
+	}
+	b := img.Bounds()
+	if b.Dx() < 1 || b.Dy() < 1 {
+		return 0, false
+	}
+
+	const w, h = 9, 8
+	var gray [h][w]float64
+	for y := 0; y < h; y++ {
+		y0, y1 := b.Min.Y+y*b.Dy()/h, b.Min.Y+(y+1)*b.Dy()/h
+		if y1 == y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < w; x++ {
+			x0, x1 := b.Min.X+x*b.Dx()/w, b.Min.X+(x+1)*b.Dx()/w
+			if x1 == x0 {
+				x1 = x0 + 1
+			}
+			// Average the block, sampling at most 8x8 pixels to keep large avatars cheap.
+			var sum float64
+			var n int
+			for py := y0; py < y1; py += max(1, (y1-y0)/8) {
+				for px := x0; px < x1; px += max(1, (x1-x0)/8) {
+					r, g, bl, _ := img.At(px, py).RGBA()
+					sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(bl)
+					n++
+				}
+			}
+			gray[y][x] = sum / float64(n)
+		}
+	}
+
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			if gray[y][x] > gray[y][x+1] {
+				hash |= 1 << (y*(w-1) + x)
+			}
+		}
+	}
+	return hash, true
+}
@@ -0,0 +1,36 @@
+package dedup
+
+import (
+	"charex/internal/core"
+	"slices"
+	"testing"
+)
+
+func TestNormalize(t *testing.T) {
+	tests := []struct {
+		text, name string
+		want       []string
+	}{
+		{"Mira maps the isles.", "Mira", []string{"char", "maps", "the", "isles"}},
+		{"{{char}} maps the isles.", "Mira", []string{"char", "maps", "the", "isles"}},
+		{"Mira's compass", "mira", []string{"char", "s", "compass"}},
+		{"Mira Stone met Mira.", "Mira Stone", []string{"char", "met", "mira"}},
+		{"Miranda is not Mira", "Mira", []string{"miranda", "is", "not", "char"}},
+		{"{{ user }} waves", "", []string{"user", "waves"}},
+		{"", "Mira", []string{}},
+	}
+	for _, tt := range tests {
+		got := normalize(tt.text, tt.name)
+		if !slices.Equal(got, tt.want) {
+			t.Errorf("normalize(%q, %q) = %q, want %q", tt.text, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestFingerprintIgnoresAnonymization(t *testing.T) {
+	named := &core.TavernCardV2{Data: core.TavernCardData{Name: "Mira", Description: "Mira is a cartographer who maps the floating isles with a brass compass.", FirstMes: "Mira looks up from her maps."}}
+	anonymized := &core.TavernCardV2{Data: core.TavernCardData{Name: "Mira", Description: "{{char}} is a cartographer who maps the floating isles with a brass compass.", FirstMes: "{{char}} looks up from her maps."}}
+	if a, b := FingerprintCard(named, nil), FingerprintCard(anonymized, nil); a.Text != b.Text {
+		t.Errorf("fingerprints differ: %x and %x", a.Text, b.Text)
+	}
+}
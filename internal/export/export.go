@@ -0,0 +1,272 @@
+// Package export streams selected library cards into a zip archive.
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"charex/internal/cardfile"
+	"charex/internal/core"
+	"charex/internal/saver"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// Formats accepted by Options.Format.
+const (
+	FormatPNG   = "png"
+	FormatJSON  = "json"
+	FormatCHARX = "charx"
+)
+
+// ManifestFile is the name of the manifest written at the end of every archive.
+const ManifestFile = "manifest.json"
+
+// Options selects which cards are exported and how.
+type Options struct {
+	Source     string // Only export cards from this source; empty means all sources.
+	Tag        string // Only export cards carrying this card or user tag (case-insensitive); empty means all.
+	Collection string // Only export cards in this collection; empty means all.
+	Format     string // One of FormatPNG, FormatJSON or FormatCHARX.
+	UserTags   bool   // Write user tags into the exported cards' tags so they carry over to frontends.
+}
+
+// ManifestEntry describes one exported card.
+type ManifestEntry struct {
+	ID     string `json:"id"`
+	Source string `json:"source"`
+	Name   string `json:"name"`
+	File   string `json:"file"`
+	Format string `json:"format"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Manifest lists every card in an export archive.
+type Manifest struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	Format      string          `json:"format"`
+	Source      string          `json:"source,omitempty"`
+	Tag         string          `json:"tag,omitempty"`
+	Collection  string          `json:"collection,omitempty"`
+	Cards       []ManifestEntry `json:"cards"`
+}
+
+// ValidateFormat reports an error for unknown export formats.
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatPNG, FormatJSON, FormatCHARX:
+		return nil
+	}
+	return fmt.Errorf("unknown export format %q, expected png, json or charx", format)
+}
+
+// WriteZip streams the selected cards into a zip archive on w, one file at a time,
+// followed by the manifest. Cards without an image are exported as JSON when PNG is requested.
+func WriteZip(w io.Writer, library *saver.Library, opts Options) (*Manifest, error) {
+	if opts.Format == "" {
+		opts.Format = FormatPNG
+	}
+	if err := ValidateFormat(opts.Format); err != nil {
+		return nil, err
+	}
+
+	records, err := library.List(opts.Source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cards: %w", err)
+	}
+	var inCollection map[string]bool
+	if opts.Collection != "" {
+		c, err := library.Collection(opts.Collection)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load collection %q: %w", opts.Collection, err)
+		}
+		inCollection = make(map[string]bool, len(c.CardIDs))
+		for _, id := range c.CardIDs {
+			inCollection[id] = true
+		}
+	}
+
+	manifest := &Manifest{
+		GeneratedAt: time.Now().UTC(),
+		Format:      opts.Format,
+		Source:      opts.Source,
+		Tag:         opts.Tag,
+		Collection:  opts.Collection,
+		Cards:       []ManifestEntry{},
+	}
+	zw := zip.NewWriter(w)
+	used := make(map[string]bool)
+
+	for _, rec := range records {
+		if inCollection != nil && !inCollection[rec.ID] {
+			continue
+		}
+		card, err := library.LoadCard(rec)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load card %s: %w", rec.ID, err)
+		}
+		tags := saver.CardTags(rec, card.Data.Tags)
+		if opts.Tag != "" && !hasTag(tags, opts.Tag) {
+			continue
+		}
+
+		// Cards are streamed from disk unless user tags must be written into them.
+		rewrite := opts.UserTags && len(tags) != len(card.Data.Tags)
+		if rewrite {
+			card.Data.Tags = tags
+		}
+		entry, err := writeCard(zw, rec, card, opts.Format, rewrite, used)
+		if err != nil {
+			return nil, fmt.Errorf("failed to export card %s: %w", rec.ID, err)
+		}
+		manifest.Cards = append(manifest.Cards, entry)
+	}
+
+	mf, err := zw.CreateHeader(&zip.FileHeader{Name: ManifestFile, Method: zip.Deflate, Modified: manifest.GeneratedAt})
+	if err != nil {
+		return nil, fmt.Errorf("failed to add manifest: %w", err)
+	}
+	enc := json.NewEncoder(mf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(manifest); err != nil {
+		return nil, fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("failed to finish archive: %w", err)
+	}
+	return manifest, nil
+}
+
+// writeCard adds one card to the archive. Unless rewrite is set, PNG and JSON files
+// are copied from the library as stored; otherwise they are regenerated from card.
+func writeCard(zw *zip.Writer, rec *saver.CardRecord, card *core.TavernCardV2, format string, rewrite bool, used map[string]bool) (ManifestEntry, error) {
+	entry := ManifestEntry{ID: rec.ID, Source: rec.Source, Name: card.Data.Name, Format: format}
+
+	var body io.Reader
+	switch {
+	case format == FormatPNG && rewrite:
+		image, err := os.ReadFile(rec.PNGPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return writeCard(zw, rec, card, FormatJSON, rewrite, used)
+		}
+		if err != nil {
+			return entry, err
+		}
+		v2Json, err := json.MarshalIndent(card, "", "  ")
+		if err != nil {
+			return entry, err
+		}
+		pngData, err := saver.EmbedJSON(image, v2Json)
+		if err != nil {
+			return entry, err
+		}
+		body = bytes.NewReader(pngData)
+
+	case format == FormatPNG:
+		f, err := os.Open(rec.PNGPath())
+		if errors.Is(err, os.ErrNotExist) {
+			return writeCard(zw, rec, card, FormatJSON, rewrite, used)
+		}
+		if err != nil {
+			return entry, err
+		}
+		defer f.Close()
+		body = f
+
+	case format == FormatJSON && rewrite:
+		v2Json, err := json.MarshalIndent(card, "", "  ")
+		if err != nil {
+			return entry, err
+		}
+		body = bytes.NewReader(v2Json)
+
+	case format == FormatJSON:
+		f, err := os.Open(rec.V2Path())
+		if err != nil {
+			return entry, err
+		}
+		defer f.Close()
+		body = f
+
+	case format == FormatCHARX:
+		icon, err := os.ReadFile(rec.PNGPath())
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return entry, err
+		}
+		var buf bytes.Buffer
+		if err := cardfile.WriteCHARX(&buf, core.ToV3(card, rec.CreatedAt, rec.UpdatedAt, icon != nil), icon); err != nil {
+			return entry, err
+		}
+		body = &buf
+	}
+
+	entry.File = uniqueName(used, path.Join(safeName(rec.Source), safeName(rec.Name)+"_"+rec.ID+extension(format)))
+	method := zip.Deflate
+	if format != FormatJSON {
+		method = zip.Store // PNG and CHARX payloads are already compressed.
+	}
+	f, err := zw.CreateHeader(&zip.FileHeader{Name: entry.File, Method: method, Modified: rec.UpdatedAt})
+	if err != nil {
+		return entry, err
+	}
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, h), body)
+	if err != nil {
+		return entry, err
+	}
+	entry.Size = n
+	entry.SHA256 = hex.EncodeToString(h.Sum(nil))
+	return entry, nil
+}
+
+func extension(format string) string {
+	switch format {
+	case FormatPNG:
+		return ".png"
+	case FormatCHARX:
+		return ".charx"
+	}
+	return ".v2.json"
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if strings.EqualFold(strings.TrimSpace(t), strings.TrimSpace(tag)) {
+			return true
+		}
+	}
+	return false
+}
+
+// safeName keeps archive paths portable across operating systems.
+func safeName(name string) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`/\?%*:|"<>`, r) || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, strings.TrimSpace(name))
+	if name == "" || name == "." || name == ".." {
+		return "unnamed"
+	}
+	return name
+}
+
+func uniqueName(used map[string]bool, name string) string {
+	candidate := name
+	for i := 2; used[candidate]; i++ {
+		ext := path.Ext(name)
+		candidate = fmt.Sprintf("%s_%d%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	used[candidate] = true
+	return candidate
+}
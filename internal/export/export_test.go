@@ -0,0 +1,66 @@
+package export
+
+import (
+	"charex/internal/core"
+	"charex/internal/saver"
+	"context"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestWriteZipSource(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	save := func(library *saver.Library, name, source string) {
+		card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: name, Description: name}}
+		if _, err := library.Save(ctx, card, []byte("{}"), nil, source, []byte(name)); err != nil {
+			t.Fatalf("Save(%s): %v", name, err)
+		}
+	}
+	// Two per-user libraries side by side, as charex-web stores them.
+	alice := saver.NewLibrary(saver.UserRoot(dataDir, "alice"))
+	bob := saver.NewLibrary(saver.UserRoot(dataDir, "bob"))
+	save(alice, "Mira", "SakuraFM")
+	save(alice, "Nova", "JanitorAI")
+	save(bob, "Secret", "SakuraFM")
+
+	tests := []struct {
+		source    string
+		wantCards int
+		wantErr   error
+	}{
+		{"", 2, nil},
+		{"SakuraFM", 1, nil},
+		{"JanitorAI", 1, nil},
+		{"Imported", 0, saver.ErrUnknownSource},
+		{"../bob/SakuraFM", 0, saver.ErrUnknownSource},
+		{"../bob", 0, saver.ErrUnknownSource},
+		{"..", 0, saver.ErrUnknownSource},
+		{".", 0, saver.ErrUnknownSource},
+		{"SakuraFM/..", 0, saver.ErrUnknownSource},
+		{"/etc", 0, saver.ErrUnknownSource},
+		{"*", 0, saver.ErrUnknownSource},
+	}
+	for _, tt := range tests {
+		manifest, err := WriteZip(io.Discard, alice, Options{Source: tt.source, Format: FormatJSON})
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("WriteZip(source %q) error = %v, want %v", tt.source, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("WriteZip(source %q): %v", tt.source, err)
+			continue
+		}
+		if len(manifest.Cards) != tt.wantCards {
+			t.Errorf("WriteZip(source %q) exported %d cards, want %d", tt.source, len(manifest.Cards), tt.wantCards)
+		}
+		for _, c := range manifest.Cards {
+			if c.Name == "Secret" {
+				t.Errorf("WriteZip(source %q) exported another user's card", tt.source)
+			}
+		}
+	}
+}
@@ -1,6 +1,21 @@
 package extractors
 
-import "charex/internal/core"
+import (
+	"bytes"
+	"charex/internal/core"
+	"context"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Register the JPEG decoder.
+	"image/png"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp" // Register the WebP decoder.
+)
 
 // Extractor defines the interface for all character extractors.
 // Each extractor is responsible for parsing data from a specific source
@@ -9,6 +24,153 @@ type Extractor interface {
 	// Extract processes the given input data (e.g., a URL or a JSON body)
 	// and returns a populated TavernCardV2 object, the raw data used for
 	// the extraction, a byte slice for a character image if found, and an error
-	// if the process fails.
-	Extract(input []byte) (card *core.TavernCardV2, rawData []byte, cardImage []byte, err error)
-}
\ No newline at end of file
+	// if the process fails. ctx bounds network requests and carries the
+	// correlation ID used in logs.
+	Extract(ctx context.Context, input []byte) (card *core.TavernCardV2, rawData []byte, cardImage []byte, err error)
+}
+
+// Options configures how extractors fetch and process content.
+type Options struct {
+	// Timeout bounds each HTTP request.
+	Timeout time.Duration
+	// UserAgent is sent with each HTTP request; empty keeps Go's default.
+	UserAgent string
+	// Anonymize replaces character and user names with {{char}} and {{user}}.
+	Anonymize bool
+	// MaxImageBytes is the largest image download accepted.
+	MaxImageBytes int64
+	// MaxImageDimension scales down larger images; 0 keeps the original size.
+	MaxImageDimension int
+}
+
+// DefaultOptions returns the options used unless configured otherwise.
+func DefaultOptions() Options {
+	return Options{
+		Timeout:       30 * time.Second,
+		Anonymize:     true,
+		MaxImageBytes: 20 << 20,
+	}
+}
+
+// fetch GETs url, reading at most limit bytes of the body when limit is positive.
+func (o Options) fetch(ctx context.Context, url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if o.UserAgent != "" {
+		req.Header.Set("User-Agent", o.UserAgent)
+	}
+	client := &http.Client{Timeout: o.Timeout}
+	start := time.Now()
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch url: %w", err)
+	}
+	defer res.Body.Close()
+	slog.DebugContext(ctx, "Fetched URL", "url", url, "status", res.StatusCode, "duration", time.Since(start))
+
+	if res.StatusCode != 200 {
+		return nil, fmt.Errorf("failed to fetch url: status code %d", res.StatusCode)
+	}
+
+	var body io.Reader = res.Body
+	if limit > 0 {
+		body = io.LimitReader(res.Body, limit+1)
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %w", err)
+	}
+	if limit > 0 && int64(len(data)) > limit {
+		return nil, fmt.Errorf("response larger than %d bytes", limit)
+	}
+	return data, nil
+}
+
+// downloadImage fetches an image from a URL and returns it as PNG, scaled down
+// to the configured maximum dimension.
+func (o Options) downloadImage(ctx context.Context, url string) ([]byte, error) {
+	body, err := o.fetch(ctx, url, o.MaxImageBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(body))
+	if err != nil {
+		// Keep unknown formats as they are; the saver validates the image later.
+		slog.DebugContext(ctx, "Keeping image of unknown format", "content_type", http.DetectContentType(body))
+		return body, nil
+	}
+	slog.DebugContext(ctx, "Downloaded image", "format", format, "width", cfg.Width, "height", cfg.Height, "bytes", len(body))
+	tooLarge := o.MaxImageDimension > 0 && (cfg.Width > o.MaxImageDimension || cfg.Height > o.MaxImageDimension)
+	if format == "png" && !tooLarge {
+		return body, nil
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %w", format, err)
+	}
+	if tooLarge {
+		img = scaleDown(img, o.MaxImageDimension)
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, fmt.Errorf("failed to encode png: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// scaleDown resizes img so that neither side exceeds max pixels, keeping its aspect ratio.
+func scaleDown(img image.Image, max int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w >= h {
+		w, h = max, h*max/w
+	} else {
+		w, h = w*max/h, max
+	}
+	if w < 1 {
+		w = 1
+	}
+	if h < 1 {
+		h = 1
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+	return dst
+}
+
+// Source names, which are also the library directories their cards are saved in.
+const (
+	SourceSakuraFM  = "SakuraFM"
+	SourceJanitorAI = "JanitorAI"
+)
+
+// New returns the extractor for the named source.
+func New(source string, opts Options) (Extractor, error) {
+	switch source {
+	case SourceSakuraFM:
+		return NewSakuraFMExtractor(opts), nil
+	case SourceJanitorAI:
+		return NewJanitorAIExtractor(opts), nil
+	default:
+		return nil, fmt.Errorf("unknown source %q (want %s or %s)", source, SourceSakuraFM, SourceJanitorAI)
+	}
+}
+
+// DetectSource guesses the source an extraction input is meant for: JanitorAI
+// request bodies are JSON and SakuraFM inputs are sakura.fm URLs. It returns ""
+// when the input matches neither.
+func DetectSource(input []byte) string {
+	trimmed := bytes.TrimSpace(input)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("[")) || bytes.HasPrefix(trimmed, []byte("{")):
+		return SourceJanitorAI
+	case bytes.Contains(trimmed, []byte("sakura.fm")) && !bytes.ContainsAny(trimmed, " \n"):
+		return SourceSakuraFM
+	default:
+		return ""
+	}
+}
@@ -2,9 +2,11 @@ package extractors
 
 import (
 	"charex/internal/core"
+	"context"
 	"crypto/md5"
 	"encoding/json"
 	"fmt"
+	"log/slog"
 	"regexp"
 	"strings"
 )
@@ -18,12 +20,18 @@ var (
 	nameKeyRegex = regexp.MustCompile(`(?i)Name:\s*([^\n\r]+)`)
 )
 
+// fallbackNamePrefix is how many characters of the description name a
+// character whose name cannot be found.
+const fallbackNamePrefix = 200
+
 // JanitorAIExtractor specializes in extracting character data from JanitorAI-style API request bodies.
-type JanitorAIExtractor struct{}
+type JanitorAIExtractor struct {
+	opts Options
+}
 
 // NewJanitorAIExtractor creates a new instance of the JanitorAIExtractor.
-func NewJanitorAIExtractor() *JanitorAIExtractor {
-	return &JanitorAIExtractor{}
+func NewJanitorAIExtractor(opts Options) *JanitorAIExtractor {
+	return &JanitorAIExtractor{opts: opts}
 }
 
 // JAIMessage represents a single message in the JAI request.
@@ -33,7 +41,7 @@ type JAIMessage struct {
 }
 
 // Extract parses the JSON body of a JanitorAI request to create a character card.
-func (e *JanitorAIExtractor) Extract(input []byte) (*core.TavernCardV2, []byte, []byte, error) {
+func (e *JanitorAIExtractor) Extract(ctx context.Context, input []byte) (*core.TavernCardV2, []byte, []byte, error) {
 	var messages []JAIMessage
 	if err := json.Unmarshal(input, &messages); err != nil {
 		return nil, nil, nil, fmt.Errorf("failed to unmarshal janitorai request: %w", err)
@@ -58,26 +66,29 @@ func (e *JanitorAIExtractor) Extract(input []byte) (*core.TavernCardV2, []byte,
 	userName := detectUserName(messages)
 
 	// Anonymize the text fields.
-	anonDesc := anonymizeText(description, charName, userName)
-	anonScenario := anonymizeText(scenario, charName, userName)
-	anonFirstMes := anonymizeText(firstMes, charName, userName)
-	anonMesExample := anonymizeText(mesExample, charName, userName)
+	anonDesc, anonScenario, anonFirstMes, anonMesExample := description, scenario, firstMes, mesExample
+	if e.opts.Anonymize {
+		anonDesc = anonymizeText(description, charName, userName)
+		anonScenario = anonymizeText(scenario, charName, userName)
+		anonFirstMes = anonymizeText(firstMes, charName, userName)
+		anonMesExample = anonymizeText(mesExample, charName, userName)
+	}
 
 	cardData := core.TavernCardData{
-		Name:                   charName,
-		Description:            anonDesc,
-		Scenario:               anonScenario,
-		FirstMes:               anonFirstMes,
-		MesExample:             anonMesExample,
-		Tags:                   []string{"JanitorAI"},
-		Creator:                "charex",
-		CharacterVersion:       "1.0",
-		Extensions:             make(map[string]interface{}),
-		Personality:            "", // JAI format doesn't have these fields.
-		CreatorNotes:           "",
-		SystemPrompt:           "",
+		Name:                    charName,
+		Description:             anonDesc,
+		Scenario:                anonScenario,
+		FirstMes:                anonFirstMes,
+		MesExample:              anonMesExample,
+		Tags:                    []string{"JanitorAI"},
+		Creator:                 "charex",
+		CharacterVersion:        "1.0",
+		Extensions:              make(map[string]interface{}),
+		Personality:             "", // JAI format doesn't have these fields.
+		CreatorNotes:            "",
+		SystemPrompt:            "",
 		PostHistoryInstructions: "",
-		AlternateGreetings:     []string{},
+		AlternateGreetings:      []string{},
 	}
 
 	card := &core.TavernCardV2{
@@ -88,6 +99,7 @@ func (e *JanitorAIExtractor) Extract(input []byte) (*core.TavernCardV2, []byte,
 	}
 
 	// The JanitorAI extractor does not handle images.
+	slog.DebugContext(ctx, "Parsed JanitorAI request", "name", charName, "messages", len(messages), "anonymized", e.opts.Anonymize)
 	return card, rawData, nil, nil
 }
 
@@ -113,9 +125,14 @@ func extractDetailsFromSystemPrompt(prompt string) (name, description, scenario,
 		name = strings.TrimSpace(matches[1])
 	}
 
-	// Fallback name if no other heuristic works.
+	// Fallback name if no other heuristic works. It only hashes the start of
+	// the description, so that later edits of the bot keep its name.
 	if name == "" {
-		name = fmt.Sprintf("char_%x", md5.Sum([]byte(description)))
+		start := []rune(description)
+		if len(start) > fallbackNamePrefix {
+			start = start[:fallbackNamePrefix]
+		}
+		name = fmt.Sprintf("char_%x", md5.Sum([]byte(string(start))))
 	}
 
 	return
@@ -159,4 +176,4 @@ func anonymizeText(text, charName, userName string) string {
 		anonymized = re.ReplaceAllString(anonymized, "{{user}}")
 	}
 	return anonymized
-}
\ No newline at end of file
+}
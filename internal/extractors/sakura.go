@@ -3,48 +3,35 @@ package extractors
 import (
 	"bytes"
 	"charex/internal/core"
+	"context"
 	"fmt"
-	"image/jpeg" // Add jpeg support
-	"image/png"
-	"io/ioutil"
-	"log"
-	"net/http"
+	"log/slog"
 	"strings"
 
 	"github.com/PuerkitoBio/goquery"
-	"golang.org/x/image/webp"
 )
 
 // SakuraFMExtractor specializes in extracting character data from Sakura.fm URLs.
-type SakuraFMExtractor struct{}
+type SakuraFMExtractor struct {
+	opts Options
+}
 
 // NewSakuraFMExtractor creates a new instance of the SakuraFMExtractor.
-func NewSakuraFMExtractor() *SakuraFMExtractor {
-	return &SakuraFMExtractor{}
+func NewSakuraFMExtractor(opts Options) *SakuraFMExtractor {
+	return &SakuraFMExtractor{opts: opts}
 }
 
 // Extract fetches the content from a Sakura.fm URL and parses it to create a character card.
-func (e *SakuraFMExtractor) Extract(input []byte) (*core.TavernCardV2, []byte, []byte, error) {
+func (e *SakuraFMExtractor) Extract(ctx context.Context, input []byte) (*core.TavernCardV2, []byte, []byte, error) {
 	url := string(input)
 	if !strings.Contains(url, "sakura.fm") {
 		return nil, nil, nil, fmt.Errorf("invalid url: not a sakura.fm url")
 	}
 
 	// Fetch the HTML page.
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to fetch url: %w", err)
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, nil, nil, fmt.Errorf("failed to fetch url: status code %d", res.StatusCode)
-	}
-
-	// Read the body of the response.
-	body, err := ioutil.ReadAll(res.Body)
+	body, err := e.opts.fetch(ctx, url, 0)
 	if err != nil {
-		return nil, nil, nil, fmt.Errorf("failed to read response body: %w", err)
+		return nil, nil, nil, err
 	}
 	rawData := body
 
@@ -69,22 +56,23 @@ func (e *SakuraFMExtractor) Extract(input []byte) (*core.TavernCardV2, []byte, [
 			}
 		}
 	})
-	log.Printf("Extracted data: name='%s', description='%s', scenario='%s', firstMes='%s', creator='%s'", name, description, scenario, firstMes, creator)
+	slog.DebugContext(ctx, "Parsed Sakura.fm page", "name", name, "creator", creator,
+		"description_len", len(description), "scenario_len", len(scenario), "first_mes_len", len(firstMes))
 	cardData := core.TavernCardData{
-		Name:                   name,
-		Description:            scenario,
-		Scenario:               "",
-		FirstMes:               firstMes,
-		Creator:                creator,
-		Personality:            "",
-		MesExample:             "",
-		CreatorNotes:           description,
-		SystemPrompt:           "",
+		Name:                    name,
+		Description:             scenario,
+		Scenario:                "",
+		FirstMes:                firstMes,
+		Creator:                 creator,
+		Personality:             "",
+		MesExample:              "",
+		CreatorNotes:            description,
+		SystemPrompt:            "",
 		PostHistoryInstructions: "",
-		AlternateGreetings:     []string{},
-		Tags:                   []string{"SakuraFM"},
-		CharacterVersion:       "1.0",
-		Extensions:             make(map[string]interface{}),
+		AlternateGreetings:      []string{},
+		Tags:                    []string{"SakuraFM"},
+		CharacterVersion:        "1.0",
+		Extensions:              make(map[string]interface{}),
 	}
 
 	// Create the full V2 card.
@@ -99,59 +87,12 @@ func (e *SakuraFMExtractor) Extract(input []byte) (*core.TavernCardV2, []byte, [
 	var cardImage []byte
 	imgSrc, exists := doc.Find("img.mx-auto.h-\\[200px\\].w-\\[200px\\].rounded-md.object-cover").Attr("src")
 	if exists {
-		cardImage, err = downloadImage(imgSrc)
+		cardImage, err = e.opts.downloadImage(ctx, imgSrc)
 		if err != nil {
 			// We can consider this a non-fatal error and continue without an image.
-			fmt.Printf("Warning: failed to download character image: %v\n", err)
+			slog.WarnContext(ctx, "Failed to download character image", "url", imgSrc, "error", err)
 		}
 	}
 
 	return card, rawData, cardImage, nil
 }
-
-// downloadImage fetches an image from a URL and returns it as a byte slice.
-func downloadImage(url string) ([]byte, error) {
-	res, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer res.Body.Close()
-
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("failed to download image: status code %d", res.StatusCode)
-	}
-
-	body, err := ioutil.ReadAll(res.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	contentType := http.DetectContentType(body)
-	fmt.Printf("Detected image Content-Type: %s\n", contentType) // Add logging
-	if strings.Contains(contentType, "webp") {
-		img, err := webp.Decode(bytes.NewReader(body))
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode webp: %w", err)
-		}
-
-		var buf bytes.Buffer
-		if err := png.Encode(&buf, img); err != nil {
-			return nil, fmt.Errorf("failed to encode png: %w", err)
-		}
-		return buf.Bytes(), nil
-	} else if strings.Contains(contentType, "jpeg") {
-		img, err := jpeg.Decode(bytes.NewReader(body))
-		if err != nil {
-			return nil, fmt.Errorf("failed to decode jpeg: %w", err)
-		}
-		var buf bytes.Buffer
-		if err := png.Encode(&buf, img); err != nil {
-			return nil, fmt.Errorf("failed to encode png: %w", err)
-		}
-		return buf.Bytes(), nil
-	}
-
-	// Assume it's a PNG if not WEBP, as per original logic.
-	// The saver will validate if it's a valid PNG later.
-	return body, nil
-}
\ No newline at end of file
@@ -0,0 +1,405 @@
+// Package pngmeta reads and rewrites the textual metadata chunks that carry
+// character card data inside PNG images.
+package pngmeta
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"math"
+	"slices"
+
+	"github.com/murkland/pngchunks"
+)
+
+// Keywords used by the character card specifications.
+const (
+	KeywordV2 = "chara" // Base64-encoded V2 card JSON.
+	KeywordV3 = "ccv3"  // Base64-encoded V3 card JSON.
+)
+
+// LargePayloadThreshold is the size above which EncodingAuto switches from an
+// uncompressed tEXt chunk to a compressed zTXt chunk.
+const LargePayloadThreshold = 8 << 20
+
+var (
+	// ErrCorrupt is returned when the PNG stream is structurally invalid or a chunk fails its CRC check.
+	ErrCorrupt = errors.New("corrupt png data")
+	// ErrTruncated is returned when the PNG stream ends before the IEND chunk.
+	ErrTruncated = errors.New("truncated png data")
+)
+
+// Encoding selects the chunk type used for a text entry.
+type Encoding int
+
+const (
+	// EncodingAuto writes tEXt, falling back to zTXt for payloads above LargePayloadThreshold.
+	EncodingAuto Encoding = iota
+	// EncodingText writes an uncompressed Latin-1 tEXt chunk.
+	EncodingText
+	// EncodingCompressed writes a zlib-compressed zTXt chunk.
+	EncodingCompressed
+	// EncodingInternational writes a compressed UTF-8 iTXt chunk.
+	EncodingInternational
+)
+
+// Chunk is a single PNG chunk held in memory.
+type Chunk struct {
+	Type string
+	Data []byte
+}
+
+// Entry is a keyword/text pair to be stored in a text chunk.
+type Entry struct {
+	Keyword  string
+	Text     string
+	Encoding Encoding
+}
+
+// ReadChunks parses every chunk up to and including IEND, verifying each CRC.
+// Structural problems wrap ErrCorrupt and a premature end of data wraps ErrTruncated.
+func ReadChunks(r io.Reader) ([]Chunk, error) {
+	reader, err := pngchunks.NewReader(r)
+	if err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return nil, fmt.Errorf("%w: missing png signature", ErrTruncated)
+		}
+		if errors.Is(err, pngchunks.ErrNotPNG) {
+			return nil, fmt.Errorf("%w: not a png file", ErrCorrupt)
+		}
+		return nil, err
+	}
+
+	var chunks []Chunk
+	for {
+		chunk, err := reader.NextChunk()
+		if err != nil {
+			switch {
+			case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+				return nil, fmt.Errorf("%w: no IEND chunk after %d chunks", ErrTruncated, len(chunks))
+			case errors.Is(err, pngchunks.ErrBadLength):
+				return nil, fmt.Errorf("%w: chunk %d has a negative length", ErrCorrupt, len(chunks))
+			default:
+				return nil, err
+			}
+		}
+
+		data, err := io.ReadAll(chunk)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s chunk: %w", chunk.Type(), err)
+		}
+		if int32(len(data)) != chunk.Length() {
+			return nil, fmt.Errorf("%w: %s chunk body is %d of %d bytes", ErrTruncated, chunk.Type(), len(data), chunk.Length())
+		}
+		if err := chunk.Close(); err != nil {
+			switch {
+			case errors.Is(err, pngchunks.ErrCRC32Mismatch):
+				return nil, fmt.Errorf("%w: crc mismatch in %s chunk", ErrCorrupt, chunk.Type())
+			case errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+				return nil, fmt.Errorf("%w: missing crc for %s chunk", ErrTruncated, chunk.Type())
+			default:
+				return nil, err
+			}
+		}
+
+		if len(chunks) == 0 && chunk.Type() != "IHDR" {
+			return nil, fmt.Errorf("%w: first chunk is %s, not IHDR", ErrCorrupt, chunk.Type())
+		}
+		chunks = append(chunks, Chunk{Type: chunk.Type(), Data: data})
+		if chunk.Type() == "IEND" {
+			return chunks, nil
+		}
+	}
+}
+
+// signature starts every PNG stream.
+var signature = []byte("\x89PNG\r\n\x1a\n")
+
+// ScannedChunk is a chunk found by ScanChunks. Err is set when the chunk is
+// damaged: it wraps ErrCorrupt for a CRC mismatch and ErrTruncated when the
+// data ends inside the chunk.
+type ScannedChunk struct {
+	Chunk
+	Err error
+}
+
+// ScanChunks lists the chunks of a possibly damaged PNG, for diagnostics.
+// Unlike ReadChunks it goes on past chunks failing their CRC check, and it
+// returns the chunks found so far along with the error when the stream itself
+// is broken: no signature, a negative chunk length or no IEND chunk.
+func ScanChunks(data []byte) ([]ScannedChunk, error) {
+	if !bytes.HasPrefix(data, signature) {
+		return nil, fmt.Errorf("%w: not a png file", ErrCorrupt)
+	}
+	var chunks []ScannedChunk
+	rest := data[len(signature):]
+	for len(rest) >= 8 {
+		length, typ := binary.BigEndian.Uint32(rest), string(rest[4:8])
+		if length > math.MaxInt32 {
+			return chunks, fmt.Errorf("%w: chunk %d has a negative length", ErrCorrupt, len(chunks))
+		}
+		body := rest[8:]
+		if uint64(len(body)) < uint64(length)+4 {
+			c := ScannedChunk{Chunk: Chunk{Type: typ, Data: body[:min(len(body), int(length))]}}
+			c.Err = fmt.Errorf("%w: %s chunk has %d of %d bytes including its crc", ErrTruncated, typ, len(body), int(length)+4)
+			return append(chunks, c), fmt.Errorf("%w: no IEND chunk after %d chunks", ErrTruncated, len(chunks)+1)
+		}
+		c := ScannedChunk{Chunk: Chunk{Type: typ, Data: body[:length]}}
+		if crc32.ChecksumIEEE(rest[4:8+length]) != binary.BigEndian.Uint32(body[length:]) {
+			c.Err = fmt.Errorf("%w: crc mismatch in %s chunk", ErrCorrupt, typ)
+		}
+		chunks = append(chunks, c)
+		if typ == "IEND" {
+			return chunks, nil
+		}
+		rest = body[length+4:]
+	}
+	return chunks, fmt.Errorf("%w: no IEND chunk after %d chunks", ErrTruncated, len(chunks))
+}
+
+// WriteChunks writes a PNG signature followed by the given chunks.
+func WriteChunks(w io.Writer, chunks []Chunk) error {
+	writer, err := pngchunks.NewWriter(w)
+	if err != nil {
+		return fmt.Errorf("failed to write png signature: %w", err)
+	}
+	for _, c := range chunks {
+		if len(c.Data) > math.MaxInt32 {
+			return fmt.Errorf("%s chunk too large: %d bytes", c.Type, len(c.Data))
+		}
+		if err := writer.WriteChunk(int32(len(c.Data)), c.Type, bytes.NewReader(c.Data)); err != nil {
+			return fmt.Errorf("failed to write %s chunk: %w", c.Type, err)
+		}
+	}
+	return nil
+}
+
+// IsText reports whether the chunk is one of the textual metadata chunk types.
+func (c Chunk) IsText() bool {
+	return c.Type == "tEXt" || c.Type == "zTXt" || c.Type == "iTXt"
+}
+
+// Keyword returns the keyword of a tEXt, zTXt or iTXt chunk without decoding its text.
+func (c Chunk) Keyword() (string, error) {
+	sep := bytes.IndexByte(c.Data, 0)
+	if sep < 1 || sep > 79 {
+		return "", fmt.Errorf("%w: %s chunk has an invalid keyword", ErrCorrupt, c.Type)
+	}
+	return latin1ToUTF8(c.Data[:sep]), nil
+}
+
+// Text decodes a tEXt, zTXt or iTXt chunk into its keyword and text.
+func (c Chunk) Text() (keyword, text string, err error) {
+	keyword, err = c.Keyword()
+	if err != nil {
+		return "", "", err
+	}
+	rest := c.Data[bytes.IndexByte(c.Data, 0)+1:]
+
+	switch c.Type {
+	case "tEXt":
+		return keyword, latin1ToUTF8(rest), nil
+
+	case "zTXt":
+		if len(rest) < 1 || rest[0] != 0 {
+			return "", "", fmt.Errorf("%w: zTXt chunk uses an unknown compression method", ErrCorrupt)
+		}
+		inflated, err := inflate(rest[1:])
+		if err != nil {
+			return "", "", err
+		}
+		return keyword, latin1ToUTF8(inflated), nil
+
+	case "iTXt":
+		if len(rest) < 2 {
+			return "", "", fmt.Errorf("%w: iTXt chunk is too short", ErrCorrupt)
+		}
+		compressed, method := rest[0] == 1, rest[1]
+		rest = rest[2:]
+		// Skip the language tag and the translated keyword.
+		for i := 0; i < 2; i++ {
+			end := bytes.IndexByte(rest, 0)
+			if end < 0 {
+				return "", "", fmt.Errorf("%w: iTXt chunk is missing a separator", ErrCorrupt)
+			}
+			rest = rest[end+1:]
+		}
+		if !compressed {
+			return keyword, string(rest), nil
+		}
+		if method != 0 {
+			return "", "", fmt.Errorf("%w: iTXt chunk uses an unknown compression method", ErrCorrupt)
+		}
+		inflated, err := inflate(rest)
+		if err != nil {
+			return "", "", err
+		}
+		return keyword, string(inflated), nil
+	}
+	return "", "", fmt.Errorf("%s is not a text chunk", c.Type)
+}
+
+// TextChunk builds a text chunk for the given entry.
+func TextChunk(e Entry) (Chunk, error) {
+	if len(e.Keyword) < 1 || len(e.Keyword) > 79 || bytes.IndexByte([]byte(e.Keyword), 0) >= 0 {
+		return Chunk{}, fmt.Errorf("invalid keyword %q", e.Keyword)
+	}
+
+	enc := e.Encoding
+	if enc == EncodingAuto {
+		enc = EncodingText
+		if len(e.Text) > LargePayloadThreshold {
+			enc = EncodingCompressed
+		}
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(e.Keyword)
+	buf.WriteByte(0)
+
+	switch enc {
+	case EncodingText:
+		latin1, err := utf8ToLatin1(e.Text)
+		if err != nil {
+			return Chunk{}, err
+		}
+		buf.Write(latin1)
+		return Chunk{Type: "tEXt", Data: buf.Bytes()}, nil
+
+	case EncodingCompressed:
+		latin1, err := utf8ToLatin1(e.Text)
+		if err != nil {
+			return Chunk{}, err
+		}
+		buf.WriteByte(0) // Compression method: deflate.
+		if err := deflate(&buf, latin1); err != nil {
+			return Chunk{}, err
+		}
+		return Chunk{Type: "zTXt", Data: buf.Bytes()}, nil
+
+	case EncodingInternational:
+		buf.Write([]byte{1, 0}) // Compressed with deflate.
+		buf.WriteByte(0)        // Empty language tag.
+		buf.WriteByte(0)        // Empty translated keyword.
+		if err := deflate(&buf, []byte(e.Text)); err != nil {
+			return Chunk{}, err
+		}
+		return Chunk{Type: "iTXt", Data: buf.Bytes()}, nil
+	}
+	return Chunk{}, fmt.Errorf("unknown encoding %d", enc)
+}
+
+// ReadText returns the text entries with the given keywords, or every text
+// entry when no keyword is given, keyed by keyword. Later chunks win when a
+// keyword appears more than once. Chunks with other keywords are not decoded,
+// so a damaged unrelated chunk does not prevent reading the card.
+func ReadText(imageData []byte, keywords ...string) (map[string]string, error) {
+	chunks, err := ReadChunks(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]string)
+	for _, c := range chunks {
+		if !c.IsText() {
+			continue
+		}
+		if len(keywords) > 0 {
+			if keyword, err := c.Keyword(); err != nil || !slices.Contains(keywords, keyword) {
+				continue
+			}
+		}
+		keyword, text, err := c.Text()
+		if err != nil {
+			return nil, err
+		}
+		entries[keyword] = text
+	}
+	return entries, nil
+}
+
+// Embed returns a copy of the PNG in which every existing chara/ccv3 chunk, and
+// any other text chunk sharing a keyword with entries, is replaced by the given entries.
+// The new chunks are placed directly after IHDR. Other chunks are copied as they
+// are, without decoding them.
+func Embed(imageData []byte, entries []Entry) ([]byte, error) {
+	chunks, err := ReadChunks(bytes.NewReader(imageData))
+	if err != nil {
+		return nil, err
+	}
+
+	replaced := map[string]bool{KeywordV2: true, KeywordV3: true}
+	for _, e := range entries {
+		replaced[e.Keyword] = true
+	}
+
+	out := make([]Chunk, 0, len(chunks)+len(entries))
+	for i, c := range chunks {
+		if c.IsText() {
+			// A chunk without a valid keyword cannot be one being replaced.
+			if keyword, err := c.Keyword(); err == nil && replaced[keyword] {
+				continue
+			}
+		}
+		out = append(out, c)
+
+		if i == 0 {
+			for _, e := range entries {
+				tc, err := TextChunk(e)
+				if err != nil {
+					return nil, err
+				}
+				out = append(out, tc)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := WriteChunks(&buf, out); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func inflate(data []byte) ([]byte, error) {
+	zr, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	defer zr.Close()
+	out, err := io.ReadAll(zr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorrupt, err)
+	}
+	return out, nil
+}
+
+func deflate(w io.Writer, data []byte) error {
+	zw := zlib.NewWriter(w)
+	if _, err := zw.Write(data); err != nil {
+		return fmt.Errorf("failed to compress text: %w", err)
+	}
+	return zw.Close()
+}
+
+func latin1ToUTF8(b []byte) string {
+	runes := make([]rune, len(b))
+	for i, c := range b {
+		runes[i] = rune(c)
+	}
+	return string(runes)
+}
+
+func utf8ToLatin1(s string) ([]byte, error) {
+	out := make([]byte, 0, len(s))
+	for _, r := range s {
+		if r > 0xFF {
+			return nil, fmt.Errorf("text contains non-latin-1 character %q; use EncodingInternational", r)
+		}
+		out = append(out, byte(r))
+	}
+	return out, nil
+}
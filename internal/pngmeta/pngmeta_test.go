@@ -0,0 +1,260 @@
+package pngmeta
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// testPNG returns a valid 1x1 PNG.
+func testPNG(t *testing.T) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// rawChunk encodes a chunk with the given length field and a correct CRC.
+func rawChunk(length uint32, typ string, data []byte) []byte {
+	b := binary.BigEndian.AppendUint32(nil, length)
+	b = append(b, typ...)
+	b = append(b, data...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(append([]byte(typ), data...)))
+}
+
+func TestReadChunks(t *testing.T) {
+	valid := testPNG(t)
+	signature := valid[:8]
+	ihdr := valid[8 : 8+25]
+	iend := rawChunk(0, "IEND", nil)
+	join := func(parts ...[]byte) []byte { return bytes.Join(parts, nil) }
+
+	badCRC := bytes.Clone(valid)
+	badCRC[8+24] ^= 0xFF // Last byte of the IHDR CRC.
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"empty", nil, ErrTruncated},
+		{"short signature", signature[:4], ErrTruncated},
+		{"not png", []byte("GIF89a, certainly not a png"), ErrCorrupt},
+		{"signature only", signature, ErrTruncated},
+		{"crc mismatch", badCRC, ErrCorrupt},
+		{"missing crc", valid[:8+21], ErrTruncated},
+		{"truncated body", valid[:8+15], ErrTruncated},
+		{"no IEND", valid[:len(valid)-12], ErrTruncated},
+		{"first chunk not IHDR", join(signature, iend), ErrCorrupt},
+		{"negative length", join(signature, ihdr, rawChunk(0x80000000, "tEXt", nil)), ErrCorrupt},
+	}
+	for _, tt := range tests {
+		chunks, err := ReadChunks(bytes.NewReader(tt.data))
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(chunks) < 3 || chunks[0].Type != "IHDR" || chunks[len(chunks)-1].Type != "IEND" {
+			t.Errorf("%s: chunks = %v", tt.name, chunkTypes(chunks))
+		}
+	}
+}
+
+func TestEmbedRoundTrip(t *testing.T) {
+	for _, enc := range []Encoding{EncodingAuto, EncodingText, EncodingCompressed, EncodingInternational} {
+		text := "eyJuYW1lIjoiTWlyYSJ9"
+		if enc == EncodingInternational {
+			text = "Mira 🧭 ミラ"
+		}
+		data, err := Embed(testPNG(t), []Entry{{Keyword: KeywordV2, Text: text, Encoding: enc}})
+		if err != nil {
+			t.Fatalf("Embed(encoding %d): %v", enc, err)
+		}
+		entries, err := ReadText(data)
+		if err != nil {
+			t.Fatalf("ReadText(encoding %d): %v", enc, err)
+		}
+		if entries[KeywordV2] != text {
+			t.Errorf("encoding %d: read %q, want %q", enc, entries[KeywordV2], text)
+		}
+	}
+}
+
+func TestEmbedReplacesCardChunks(t *testing.T) {
+	data, err := Embed(testPNG(t), []Entry{{Keyword: KeywordV2, Text: "old"}, {Keyword: KeywordV3, Text: "old"}, {Keyword: "Comment", Text: "kept"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = Embed(data, []Entry{{Keyword: KeywordV2, Text: "new"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := ReadChunks(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(chunkTypes(chunks), ","); !strings.HasPrefix(got, "IHDR,tEXt,tEXt,") {
+		t.Errorf("chunks = %s, want the new entry right after IHDR", got)
+	}
+	entries, err := ReadText(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[KeywordV2] != "new" || entries["Comment"] != "kept" {
+		t.Errorf("entries = %v, want chara=new and Comment=kept", entries)
+	}
+}
+
+func TestChunkText(t *testing.T) {
+	tests := []struct {
+		name    string
+		chunk   Chunk
+		wantErr error
+	}{
+		{"empty keyword", Chunk{Type: "tEXt", Data: []byte("\x00text")}, ErrCorrupt},
+		{"no separator", Chunk{Type: "tEXt", Data: []byte("chara")}, ErrCorrupt},
+		{"keyword too long", Chunk{Type: "tEXt", Data: []byte(strings.Repeat("k", 80) + "\x00text")}, ErrCorrupt},
+		{"zTXt unknown method", Chunk{Type: "zTXt", Data: []byte("chara\x00\x01data")}, ErrCorrupt},
+		{"zTXt bad stream", Chunk{Type: "zTXt", Data: []byte("chara\x00\x00not zlib")}, ErrCorrupt},
+		{"iTXt too short", Chunk{Type: "iTXt", Data: []byte("chara\x00\x01")}, ErrCorrupt},
+		{"iTXt missing separator", Chunk{Type: "iTXt", Data: []byte("chara\x00\x00\x00en")}, ErrCorrupt},
+		{"iTXt unknown method", Chunk{Type: "iTXt", Data: []byte("chara\x00\x01\x01\x00\x00data")}, ErrCorrupt},
+	}
+	for _, tt := range tests {
+		if _, _, err := tt.chunk.Text(); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+
+	keyword, text, err := Chunk{Type: "tEXt", Data: []byte("chara\x00caf\xe9")}.Text()
+	if err != nil || keyword != "chara" || text != "café" {
+		t.Errorf("latin-1 tEXt = %q, %q, %v", keyword, text, err)
+	}
+}
+
+func TestTextChunkRejectsInvalidEntries(t *testing.T) {
+	for _, e := range []Entry{
+		{Keyword: "", Text: "x"},
+		{Keyword: strings.Repeat("k", 80), Text: "x"},
+		{Keyword: "a\x00b", Text: "x"},
+		{Keyword: "chara", Text: "ミラ", Encoding: EncodingText},
+	} {
+		if _, err := TextChunk(e); err == nil {
+			t.Errorf("TextChunk(%q, %q) succeeded", e.Keyword, e.Text)
+		}
+	}
+}
+
+func chunkTypes(chunks []Chunk) []string {
+	types := make([]string, len(chunks))
+	for i, c := range chunks {
+		types[i] = c.Type
+	}
+	return types
+}
+
+func TestDamagedUnrelatedChunks(t *testing.T) {
+	data, err := Embed(testPNG(t), []Entry{{Keyword: KeywordV2, Text: "card"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks, err := ReadChunks(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An editor comment that does not inflate, and a text chunk without a keyword.
+	damaged := []Chunk{
+		{Type: "zTXt", Data: []byte("Comment\x00\x00not zlib")},
+		{Type: "tEXt", Data: []byte("no keyword")},
+	}
+	chunks = append(chunks[:2], append(damaged, chunks[2:]...)...)
+	var buf bytes.Buffer
+	if err := WriteChunks(&buf, chunks); err != nil {
+		t.Fatal(err)
+	}
+	data = buf.Bytes()
+
+	entries, err := ReadText(data, KeywordV3, KeywordV2)
+	if err != nil {
+		t.Fatalf("ReadText: %v", err)
+	}
+	if len(entries) != 1 || entries[KeywordV2] != "card" {
+		t.Errorf("ReadText = %v, want chara=card", entries)
+	}
+	if _, err := ReadText(data); !errors.Is(err, ErrCorrupt) {
+		t.Errorf("ReadText of every entry: err = %v, want ErrCorrupt", err)
+	}
+
+	embedded, err := Embed(data, []Entry{{Keyword: KeywordV2, Text: "new card"}})
+	if err != nil {
+		t.Fatalf("Embed: %v", err)
+	}
+	if entries, err := ReadText(embedded, KeywordV2); err != nil || entries[KeywordV2] != "new card" {
+		t.Errorf("ReadText after Embed = %v, %v", entries, err)
+	}
+	out, err := ReadChunks(bytes.NewReader(embedded))
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept := 0
+	for _, c := range out {
+		for _, d := range damaged {
+			if c.Type == d.Type && bytes.Equal(c.Data, d.Data) {
+				kept++
+			}
+		}
+	}
+	if kept != len(damaged) {
+		t.Errorf("Embed kept %d of %d unrelated chunks unchanged", kept, len(damaged))
+	}
+}
+
+func TestScanChunks(t *testing.T) {
+	valid := testPNG(t)
+	badCRC := bytes.Clone(valid)
+	badCRC[8+24] ^= 0xFF // Last byte of the IHDR CRC.
+
+	tests := []struct {
+		name      string
+		data      []byte
+		wantTypes string
+		wantErr   error
+		badChunk  int // Index of the chunk with an error, or -1.
+	}{
+		{"valid", valid, "IHDR,IDAT,IEND", nil, -1},
+		{"crc mismatch", badCRC, "IHDR,IDAT,IEND", nil, 0},
+		{"truncated body", valid[:8+15], "IHDR", ErrTruncated, 0},
+		{"no IEND", valid[:len(valid)-12], "IHDR,IDAT", ErrTruncated, -1},
+		{"not png", []byte("GIF89a"), "", ErrCorrupt, -1},
+	}
+	for _, tt := range tests {
+		chunks, err := ScanChunks(tt.data)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: error = %v, want %v", tt.name, err, tt.wantErr)
+		}
+		var types []string
+		for i, c := range chunks {
+			types = append(types, c.Type)
+			if (c.Err != nil) != (i == tt.badChunk) {
+				t.Errorf("%s: chunk %d (%s) error = %v", tt.name, i, c.Type, c.Err)
+			}
+		}
+		if got := strings.Join(types, ","); got != tt.wantTypes {
+			t.Errorf("%s: chunks %s, want %s", tt.name, got, tt.wantTypes)
+		}
+	}
+}
@@ -2,64 +2,141 @@ package saver
 
 import (
 	"charex/internal/core"
+	"charex/internal/dedup"
+	"charex/internal/fsutil"
+	"charex/internal/pngmeta"
+	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"regexp"
 	"strings"
-
-	"bytes"
-
-	"github.com/murkland/pngchunks"
+	"time"
 )
 
 var (
-	// A regular expression to catch characters that are not safe for filenames.
-	unsafeChars = regexp.MustCompile(`[\\?%*:|"<>]`)
+	// A regular expression to catch characters that are not safe for filenames,
+	// including path separators and control characters.
+	unsafeChars         = regexp.MustCompile(`[\\/?%*:|"<>\x00-\x1f\x7f]`)
+	repeatedUnderscores = regexp.MustCompile(`_+`)
 )
 
-// sanitizeFilename replaces unsafe characters with underscores and cleans up the name.
+// sanitizeFilename turns a card name into a single path element: unsafe
+// characters become underscores and leading dots are dropped, so the result is
+// never "." or "..", nor hidden. It returns "" when nothing usable is left.
 func sanitizeFilename(name string) string {
-	// Replace unsafe characters with an underscore.
+	// Replace unsafe characters and spaces with an underscore.
 	sanitized := unsafeChars.ReplaceAllString(name, "_")
-	// Replace spaces with underscores.
 	sanitized = strings.ReplaceAll(sanitized, " ", "_")
 	// Reduce multiple underscores to a single one.
-	sanitized = regexp.MustCompile(`_+`).ReplaceAllString(sanitized, "_")
-	// Trim leading/trailing underscores.
-	sanitized = strings.Trim(sanitized, "_")
+	sanitized = repeatedUnderscores.ReplaceAllString(sanitized, "_")
+	// Trim leading dots and leading/trailing underscores.
+	return strings.Trim(strings.TrimLeft(sanitized, "._"), "_")
+}
 
-	if sanitized == "" {
-		return "unnamed_character"
+// cardDir returns the directory of a new card, <Root>/<source>/<Name>_<id>. The
+// name falls back to the ID when nothing of it is usable, and directories
+// outside the library are refused.
+func (l *Library) cardDir(source, name, id string) (string, error) {
+	if name = sanitizeFilename(name); name == "" {
+		name = id
 	}
-	return sanitized
+	dir := filepath.Join(l.Root, source, name+"_"+id)
+	if !l.contains(dir) {
+		return "", fmt.Errorf("%w: %s", ErrOutsideLibrary, dir)
+	}
+	return dir, nil
 }
 
-// SaveCard performs the complete save operation for a character card.
-func SaveCard(card *core.TavernCardV2, rawData []byte, cardImage []byte, source string) error {
-	// Create the source-specific directory.
-	outputDir := "output"
-	sourceDir := filepath.Join(outputDir, source)
-	if err := os.MkdirAll(sourceDir, 0755); err != nil {
-		return fmt.Errorf("failed to create source directory: %w", err)
+// Save performs the complete save operation for a character card and returns its record.
+// The origin (a URL or request body) determines the card ID, see CardID, so extracting
+// from the same origin again records a new version of the existing card.
+func (l *Library) Save(ctx context.Context, card *core.TavernCardV2, rawData []byte, cardImage []byte, source string, origin []byte) (*CardRecord, error) {
+	if !validSourceName(source) {
+		return nil, fmt.Errorf("%w %q", ErrInvalidSource, source)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	id := CardID(source, origin)
+
+	// Reuse the existing directory for this ID so renamed characters keep their history.
+	rec, err := l.get(id)
+	switch {
+	case err == nil:
+	case errors.Is(err, ErrNotFound):
+		dir, err := l.cardDir(source, displayName(card), id)
+		if err != nil {
+			return nil, err
+		}
+		now := time.Now().UTC()
+		rec = &CardRecord{
+			CardMeta: CardMeta{ID: id, Source: source, Version: 1, CreatedAt: now},
+			Dir:      dir,
+		}
+	default:
+		return nil, err
+	}
+
+	if err := l.update(ctx, rec, card, rawData, cardImage); err != nil {
+		return nil, err
 	}
+	return rec, nil
+}
+
+// update writes card as the record's current version. If the record already has a
+// card that differs, the old files are archived first and the version is bumped.
+// A nil rawData or cardImage keeps the record's existing raw data or avatar.
+func (l *Library) update(ctx context.Context, rec *CardRecord, card *core.TavernCardV2, rawData []byte, cardImage []byte) error {
+	if _, err := os.Stat(rec.V2Path()); err == nil {
+		if cardImage == nil {
+			// Keep the previous avatar rather than dropping it when a re-extraction has no image.
+			cardImage, _ = os.ReadFile(rec.PNGPath())
+		}
+		changed, err := cardChanged(rec, card)
+		if err != nil {
+			return err
+		}
+		if changed {
+			if err := archiveVersion(rec); err != nil {
+				return err
+			}
+			rec.Version = rec.currentVersion() + 1
+			slog.InfoContext(ctx, "Card changed, recording new version", "card", rec.ID, "version", rec.Version)
+		}
+	}
+	rec.Name = displayName(card)
+	rec.UpdatedAt = time.Now().UTC()
+
+	if err := os.MkdirAll(rec.Dir, 0755); err != nil {
+		return fmt.Errorf("failed to create card directory: %w", err)
+	}
+	slog.InfoContext(ctx, "Saving card", "card", rec.ID, "dir", rec.Dir)
+
+	card.Data.CharacterVersion = versionString(rec.currentVersion())
+
+	return writeCardFiles(rec, card, rawData, cardImage)
+}
 
-	// Determine the base filename from the display name or the card name.
-	baseFilename := card.DisplayName
-	if baseFilename == "" {
-		baseFilename = card.Data.Name
+// displayName returns the name used for directory names and listings.
+func displayName(card *core.TavernCardV2) string {
+	if card.DisplayName != "" {
+		return card.DisplayName
 	}
-	baseFilename = sanitizeFilename(baseFilename)
-	log.Printf("Saving card with base filename: %s", baseFilename)
+	return card.Data.Name
+}
 
+// writeCardFiles writes the raw data, V2 JSON, optional PNG and metadata into the record's directory.
+func writeCardFiles(rec *CardRecord, card *core.TavernCardV2, rawData []byte, cardImage []byte) error {
 	// 1. Save the raw data.
-	rawPath := filepath.Join(sourceDir, baseFilename+".raw.json")
-	if err := ioutil.WriteFile(rawPath, rawData, 0644); err != nil {
-		return fmt.Errorf("failed to save raw data: %w", err)
+	if rawData != nil {
+		if err := fsutil.WriteFileAtomic(rec.RawPath(), rawData, 0644); err != nil {
+			return fmt.Errorf("failed to save raw data: %w", err)
+		}
 	}
 
 	// 2. Save the V2 JSON data.
@@ -67,73 +144,56 @@ func SaveCard(card *core.TavernCardV2, rawData []byte, cardImage []byte, source
 	if err != nil {
 		return fmt.Errorf("failed to marshal v2 json: %w", err)
 	}
-	v2Path := filepath.Join(sourceDir, baseFilename+".v2.json")
-	if err := ioutil.WriteFile(v2Path, v2Json, 0644); err != nil {
+	if err := fsutil.WriteFileAtomic(rec.V2Path(), v2Json, 0644); err != nil {
 		return fmt.Errorf("failed to save v2 json: %w", err)
 	}
 
 	// 3. Save the PNG with embedded data, if an image is provided.
 	if cardImage != nil {
-		pngPath := filepath.Join(sourceDir, baseFilename+".png")
-		if err := embedDataInPng(cardImage, v2Json, pngPath); err != nil {
+		if err := embedDataInPng(cardImage, v2Json, rec.PNGPath()); err != nil {
 			return fmt.Errorf("failed to save png with embedded data: %w", err)
 		}
 	}
 
-	return nil
+	// 4. Save the metadata last so a card only becomes visible once its files exist.
+	fp := dedup.FingerprintCard(card, cardImage)
+	rec.Fingerprint = &fp
+	return writeMeta(rec)
 }
 
-// embedDataInPng injects the character data into a new tEXt chunk and saves the new PNG.
+// embedDataInPng replaces any existing card metadata in the image with the given
+// JSON and atomically writes the result to outputPath.
 func embedDataInPng(imageData, jsonData []byte, outputPath string) error {
-	// Base64 encode the JSON data.
-	encodedJson := base64.StdEncoding.EncodeToString(jsonData)
-	textChunkData := []byte("chara\x00" + encodedJson)
-
-	// Create a reader for the original image.
-	reader, err := pngchunks.NewReader(bytes.NewReader(imageData))
+	pngData, err := EmbedJSON(imageData, jsonData)
 	if err != nil {
-		return fmt.Errorf("failed to create png reader: %w", err)
+		return err
 	}
 
-	// Create the output file.
-	f, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output png file: %w", err)
-	}
-	defer f.Close()
-
-	// Create a writer for the new image.
-	writer, err := pngchunks.NewWriter(f)
-	if err != nil {
-		return fmt.Errorf("failed to create png writer: %w", err)
+	if err := fsutil.WriteFileAtomic(outputPath, pngData, 0644); err != nil {
+		return fmt.Errorf("failed to write png file: %w", err)
 	}
+	return nil
+}
 
-	// Read the first chunk (IHDR) and write it to the new file.
-	ihdr, err := reader.NextChunk()
+// EmbedJSON returns the image with its card metadata replaced by the given V2 JSON.
+func EmbedJSON(imageData, jsonData []byte) ([]byte, error) {
+	encodedJson := base64.StdEncoding.EncodeToString(jsonData)
+	pngData, err := pngmeta.Embed(imageData, []pngmeta.Entry{
+		{Keyword: pngmeta.KeywordV2, Text: encodedJson},
+	})
 	if err != nil {
-		return fmt.Errorf("failed to read IHDR chunk: %w", err)
-	}
-	if err := writer.WriteChunk(ihdr.Length(), ihdr.Type(), ihdr); err != nil {
-		return fmt.Errorf("failed to write IHDR chunk: %w", err)
+		return nil, fmt.Errorf("failed to embed card metadata: %w", err)
 	}
-	ihdr.Close()
+	return pngData, nil
+}
 
-	// Write our new tEXt chunk.
-	if err := writer.WriteChunk(int32(len(textChunkData)), "tEXt", bytes.NewReader(textChunkData)); err != nil {
-		return fmt.Errorf("failed to write tEXt chunk: %w", err)
+// Update replaces a card's content with an edited card, recording a new version
+// if anything changed. The raw extraction data and avatar are kept.
+func (l *Library) Update(ctx context.Context, rec *CardRecord, card *core.TavernCardV2) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.reload(rec); err != nil {
+		return err
 	}
-
-	// Copy the rest of the chunks from the original image to the new one.
-	for {
-		chunk, err := reader.NextChunk()
-		if err != nil {
-			break // End of chunks
-		}
-		if err := writer.WriteChunk(chunk.Length(), chunk.Type(), chunk); err != nil {
-			return fmt.Errorf("failed to write chunk: %w", err)
-		}
-		chunk.Close()
-	}
-
-	return nil
-}
\ No newline at end of file
+	return l.update(ctx, rec, card, nil, nil)
+}
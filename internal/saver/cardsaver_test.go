@@ -0,0 +1,143 @@
+package saver
+
+import (
+	"charex/internal/core"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSanitizeFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"Alice", "Alice"},
+		{"Alice Smith", "Alice_Smith"},
+		{"a:b*c?", "a_b_c"},
+		{"../../../escaped", "escaped"},
+		{"..", ""},
+		{".", ""},
+		{".hidden", "hidden"},
+		{`..\..\win`, "win"},
+		{"a/b/c", "a_b_c"},
+		{"/etc/passwd", "etc_passwd"},
+		{"tab\there\x00", "tab_here"},
+		{"   ", ""},
+		{"", ""},
+		{"v1.2", "v1.2"},
+	}
+	for _, tt := range tests {
+		if got := sanitizeFilename(tt.name); got != tt.want {
+			t.Errorf("sanitizeFilename(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSaveStaysInsideLibrary(t *testing.T) {
+	tests := []struct {
+		name    string
+		source  string
+		wantErr error
+	}{
+		{"../../../escaped", "SakuraFM", nil},
+		{"..", "SakuraFM", nil},
+		{"/abs/path", "SakuraFM", nil},
+		{"", "SakuraFM", nil},
+		{"Bob", "../outside", ErrInvalidSource},
+		{"Bob", "..", ErrInvalidSource},
+		{"Bob", "a/b", ErrInvalidSource},
+		{"Bob", ".hidden", ErrInvalidSource},
+		{"Bob", "", ErrInvalidSource},
+	}
+	for _, tt := range tests {
+		root := filepath.Join(t.TempDir(), "lib")
+		library := NewLibrary(root)
+		card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: tt.name}}
+
+		rec, err := library.Save(context.Background(), card, []byte("{}"), nil, tt.source, []byte(tt.name+tt.source))
+		if tt.wantErr != nil {
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Save(%q, %q) error = %v, want %v", tt.name, tt.source, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("Save(%q, %q): %v", tt.name, tt.source, err)
+			continue
+		}
+		rel, err := filepath.Rel(root, rec.Dir)
+		if err != nil || strings.HasPrefix(rel, "..") || filepath.Dir(filepath.Dir(rel)) != "." {
+			t.Errorf("Save(%q) wrote to %s, want <root>/<source>/<card>", tt.name, rec.Dir)
+		}
+		if _, err := os.Stat(rec.V2Path()); err != nil {
+			t.Errorf("Save(%q): card file missing: %v", tt.name, err)
+		}
+		if got, err := library.Get(rec.ID); err != nil || got.Dir != rec.Dir {
+			t.Errorf("Get(%s) after Save(%q) = %v, %v", rec.ID, tt.name, got, err)
+		}
+	}
+}
+
+func TestUpdateWithStaleRecord(t *testing.T) {
+	ctx := context.Background()
+	library := NewLibrary(t.TempDir())
+	origin := []byte("https://www.sakura.fm/chat/mira")
+	card := func(description string) *core.TavernCardV2 {
+		return &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira", Description: description}}
+	}
+
+	stale, err := library.Save(ctx, card("v1"), origin, nil, "SakuraFM", origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A re-extraction records version 2 after stale was read.
+	if _, err := library.Save(ctx, card("v2"), origin, nil, "SakuraFM", origin); err != nil {
+		t.Fatal(err)
+	}
+	if err := library.Update(ctx, stale, card("edited")); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := library.Get(stale.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Version != 3 {
+		t.Errorf("version after update = %d, want 3", rec.Version)
+	}
+	if old, err := library.LoadVersion(rec, 2); err != nil || old.Data.Description != "v2" {
+		t.Errorf("version 2 = %+v, %v; want the re-extracted card", old, err)
+	}
+}
+
+func TestSetUserTagsWithStaleRecord(t *testing.T) {
+	ctx := context.Background()
+	library := NewLibrary(t.TempDir())
+	origin := []byte("https://www.sakura.fm/chat/mira")
+	card := func(description string) *core.TavernCardV2 {
+		return &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira", Description: description}}
+	}
+
+	stale, err := library.Save(ctx, card("v1"), origin, nil, "SakuraFM", origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := library.Save(ctx, card("v2"), origin, nil, "SakuraFM", origin); err != nil {
+		t.Fatal(err)
+	}
+	if err := library.SetUserTags(stale, []string{"fav"}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	rec, err := library.Get(stale.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Version != 2 || len(rec.UserTags) != 1 || rec.UserTags[0] != "fav" {
+		t.Errorf("after tagging: version %d, tags %v; want version 2, tags [fav]", rec.Version, rec.UserTags)
+	}
+}
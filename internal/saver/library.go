@@ -0,0 +1,431 @@
+package saver
+
+import (
+	"charex/internal/core"
+	"charex/internal/dedup"
+	"charex/internal/fsutil"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// File names used inside every card directory.
+const (
+	metaFile = "meta.json"
+	v2File   = "card.v2.json"
+	rawFile  = "card.raw.json"
+	pngFile  = "card.png"
+)
+
+// ImportSource is the library source of cards imported from card files.
+const ImportSource = "Imported"
+
+// UsersDir is the directory of a data directory that holds one library per
+// user. It is never a source of the shared library at the data directory.
+const UsersDir = "users"
+
+// ErrNotFound is returned when no card exists for a given ID.
+var ErrNotFound = errors.New("card not found")
+
+// ErrUnknownSource is returned for a source that is not one of the library's sources.
+var ErrUnknownSource = errors.New("unknown source")
+
+// ErrInvalidSource is returned when saving under a source that cannot be a directory name.
+var ErrInvalidSource = errors.New("invalid source name")
+
+// ErrOutsideLibrary is returned when a card would be written outside the library root.
+var ErrOutsideLibrary = errors.New("path is outside the library")
+
+// Library stores character cards on disk, one directory per card:
+//
+//	<Root>/<source>/<Name>_<id>/{meta.json,card.v2.json,card.raw.json,card.png}
+type Library struct {
+	Root string
+	mu   sync.Mutex
+}
+
+// NewLibrary creates a library rooted at the given directory.
+func NewLibrary(root string) *Library {
+	return &Library{Root: root}
+}
+
+// CardMeta is the library metadata persisted next to each card.
+type CardMeta struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Name      string    `json:"name"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+
+	// UserTags are tags added in charex, kept separate from the tags stored in the card.
+	UserTags []string `json:"user_tags,omitempty"`
+
+	// Fingerprint is computed on save for duplicate detection.
+	Fingerprint *dedup.Fingerprint `json:"fingerprint,omitempty"`
+}
+
+// CardRecord locates a saved card on disk.
+type CardRecord struct {
+	CardMeta
+	Dir string `json:"-"`
+}
+
+// V2Path returns the path of the card's V2 JSON file.
+func (r *CardRecord) V2Path() string { return filepath.Join(r.Dir, v2File) }
+
+// RawPath returns the path of the raw extraction data.
+func (r *CardRecord) RawPath() string { return filepath.Join(r.Dir, rawFile) }
+
+// PNGPath returns the path of the card image; the file may not exist.
+func (r *CardRecord) PNGPath() string { return filepath.Join(r.Dir, pngFile) }
+
+// CardID derives a stable identifier from the source and the origin of a card.
+// URLs are normalized so trivial differences (query strings, trailing slashes)
+// map to the same card; any other origin, such as a captured request body or an
+// imported file, is identified by its content hash. Cards that look alike are
+// never merged by their ID; the dedup package flags likely duplicates instead.
+func CardID(source string, origin []byte) string {
+	h := sha256.New()
+	h.Write([]byte(source))
+	h.Write([]byte{0})
+	h.Write([]byte(normalizeOrigin(origin)))
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// normalizeOrigin returns the normalized form of a URL origin, or the trimmed
+// origin if it is not a URL.
+func normalizeOrigin(origin []byte) string {
+	s := strings.TrimSpace(string(origin))
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return s
+	}
+	u.Scheme = "https"
+	u.Host = strings.ToLower(u.Host)
+	u.RawQuery = ""
+	u.Fragment = ""
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	return u.String()
+}
+
+// contains reports whether path lies below the library root.
+func (l *Library) contains(path string) bool {
+	rel, err := filepath.Rel(l.Root, path)
+	return err == nil && rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// Get looks up a card by ID.
+func (l *Library) Get(id string) (*CardRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.get(id)
+}
+
+func (l *Library) get(id string) (*CardRecord, error) {
+	if id == "" || strings.ContainsAny(id, `/\*?[`) {
+		return nil, ErrNotFound
+	}
+	matches, err := filepath.Glob(filepath.Join(l.Root, "*", "*_"+id, metaFile))
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+	return readRecord(filepath.Dir(matches[0]))
+}
+
+// validSourceName reports whether name can be a source directory: a single,
+// non-hidden path element.
+func validSourceName(name string) bool {
+	return name != "" && name != UsersDir && !strings.HasPrefix(name, ".") && !strings.ContainsAny(name, `/\`) && filepath.Base(name) == name
+}
+
+// CheckSource returns ErrUnknownSource unless source names one of the library's sources.
+func (l *Library) CheckSource(source string) error {
+	if validSourceName(source) {
+		sources, err := l.Sources()
+		if err != nil {
+			return err
+		}
+		if slices.Contains(sources, source) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %q", ErrUnknownSource, source)
+}
+
+// List returns the cards of one source, or of every source when source is empty,
+// most recently updated first. Any other source than one of the library's own
+// is refused with ErrUnknownSource.
+func (l *Library) List(source string) ([]*CardRecord, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if source != "" {
+		if err := l.CheckSource(source); err != nil {
+			return nil, err
+		}
+	}
+
+	pattern := filepath.Join(l.Root, "*", "*", metaFile)
+	if source != "" {
+		pattern = filepath.Join(l.Root, source, "*", metaFile)
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]*CardRecord, 0, len(matches))
+	for _, m := range matches {
+		rec, err := readRecord(filepath.Dir(m))
+		if err != nil {
+			slog.Warn("Skipping unreadable card", "dir", filepath.Dir(m), "error", err)
+			continue
+		}
+		records = append(records, rec)
+	}
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].UpdatedAt.After(records[j].UpdatedAt)
+	})
+	return records, nil
+}
+
+// Sources returns the names of all source directories in the library.
+func (l *Library) Sources() ([]string, error) {
+	entries, err := os.ReadDir(l.Root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var sources []string
+	for _, e := range entries {
+		if e.IsDir() && validSourceName(e.Name()) {
+			sources = append(sources, e.Name())
+		}
+	}
+	return sources, nil
+}
+
+// LoadCard reads the V2 card stored for a record.
+func (l *Library) LoadCard(rec *CardRecord) (*core.TavernCardV2, error) {
+	return readCard(rec.V2Path())
+}
+
+func readCard(path string) (*core.TavernCardV2, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var card core.TavernCardV2
+	if err := json.Unmarshal(data, &card); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &card, nil
+}
+
+func readRecord(dir string) (*CardRecord, error) {
+	data, err := os.ReadFile(filepath.Join(dir, metaFile))
+	if err != nil {
+		return nil, err
+	}
+	rec := &CardRecord{Dir: dir}
+	if err := json.Unmarshal(data, &rec.CardMeta); err != nil {
+		return nil, fmt.Errorf("failed to parse card metadata: %w", err)
+	}
+	return rec, nil
+}
+
+// reload refreshes rec from its meta.json, which another save may have changed
+// since rec was read. Callers hold l.mu and then apply their change to rec, so
+// that writing it back never reverts a concurrent save.
+func (l *Library) reload(rec *CardRecord) error {
+	fresh, err := readRecord(rec.Dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("card %s: %w", rec.ID, ErrNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reload card %s: %w", rec.ID, err)
+	}
+	*rec = *fresh
+	return nil
+}
+
+func writeMeta(rec *CardRecord) error {
+	data, err := json.MarshalIndent(rec.CardMeta, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal card metadata: %w", err)
+	}
+	if err := fsutil.WriteFileAtomic(filepath.Join(rec.Dir, metaFile), data, 0644); err != nil {
+		return fmt.Errorf("failed to save card metadata: %w", err)
+	}
+	return nil
+}
+
+// UserRoot returns the root of a user's library under dataDir.
+func UserRoot(dataDir, user string) string {
+	return filepath.Join(dataDir, UsersDir, user)
+}
+
+// MigrateUserLibrary moves a user's library from <dataDir>/<user>, where it was
+// kept before, to UserRoot. A directory holding cards directly is a source of
+// the shared library, not a user's library, and is left in place.
+func MigrateUserLibrary(dataDir, user string) error {
+	oldRoot, newRoot := filepath.Join(dataDir, user), UserRoot(dataDir, user)
+	if _, err := os.Stat(oldRoot); err != nil {
+		return nil
+	}
+	if _, err := os.Stat(newRoot); err == nil {
+		slog.Warn("Not migrating user library, the new location exists", "user", user, "dir", oldRoot)
+		return nil
+	}
+	if cards, _ := filepath.Glob(filepath.Join(oldRoot, "*", metaFile)); len(cards) > 0 {
+		slog.Warn("Not migrating user library, the directory is a source of the shared library", "user", user, "dir", oldRoot)
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(newRoot), 0755); err != nil {
+		return fmt.Errorf("failed to create users directory: %w", err)
+	}
+	if err := os.Rename(oldRoot, newRoot); err != nil {
+		return fmt.Errorf("failed to move library of %s: %w", user, err)
+	}
+	slog.Info("Migrated user library", "user", user, "dir", newRoot)
+	return nil
+}
+
+// MigrateLegacy moves cards saved in the old flat layout (<source>/<Name>.v2.json)
+// into per-card directories. Their IDs are derived from the raw data, since the
+// original extraction input was never recorded.
+func (l *Library) MigrateLegacy() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	matches, err := filepath.Glob(filepath.Join(l.Root, "*", "*.v2.json"))
+	if err != nil {
+		return err
+	}
+	for _, v2Path := range matches {
+		sourceDir := filepath.Dir(v2Path)
+		source := filepath.Base(sourceDir)
+		base := strings.TrimSuffix(filepath.Base(v2Path), ".v2.json")
+		rawPath := filepath.Join(sourceDir, base+".raw.json")
+		pngPath := filepath.Join(sourceDir, base+".png")
+
+		rawData, err := os.ReadFile(rawPath)
+		if err != nil {
+			rawData, _ = os.ReadFile(v2Path)
+		}
+		info, err := os.Stat(v2Path)
+		if err != nil {
+			return err
+		}
+
+		id := CardID(source, rawData)
+		dir, err := l.cardDir(source, base, id)
+		if err != nil {
+			return err
+		}
+		rec := &CardRecord{
+			CardMeta: CardMeta{ID: id, Source: source, Name: base, CreatedAt: info.ModTime().UTC(), UpdatedAt: info.ModTime().UTC()},
+			Dir:      dir,
+		}
+		if err := os.MkdirAll(rec.Dir, 0755); err != nil {
+			return fmt.Errorf("failed to create card directory: %w", err)
+		}
+		moves := [][2]string{{v2Path, rec.V2Path()}, {rawPath, rec.RawPath()}, {pngPath, rec.PNGPath()}}
+		for _, mv := range moves {
+			if err := os.Rename(mv[0], mv[1]); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return fmt.Errorf("failed to move %s: %w", mv[0], err)
+			}
+		}
+		if err := writeMeta(rec); err != nil {
+			return err
+		}
+		slog.Info("Migrated legacy card", "file", base, "dir", rec.Dir)
+	}
+	return nil
+}
+
+// Delete removes a card, including its version history, from the library.
+func (l *Library) Delete(ctx context.Context, rec *CardRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if err := os.RemoveAll(rec.Dir); err != nil {
+		return fmt.Errorf("failed to delete card %s: %w", rec.ID, err)
+	}
+	if err := l.pruneCollections(rec.ID); err != nil {
+		return fmt.Errorf("failed to remove card %s from collections: %w", rec.ID, err)
+	}
+	slog.InfoContext(ctx, "Deleted card", "card", rec.ID, "dir", rec.Dir)
+	return nil
+}
+
+// Sync waits for any write in progress and flushes the library's directories
+// to disk. Card files are already synced as they are written.
+func (l *Library) Sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := os.Stat(l.Root); os.IsNotExist(err) {
+		return nil
+	}
+	if err := fsutil.SyncTree(l.Root); err != nil {
+		return fmt.Errorf("failed to sync library: %w", err)
+	}
+	return nil
+}
+
+// Usage summarises the cards and bytes stored under a directory.
+type Usage struct {
+	Cards map[string]int // Card directories by source.
+	Bytes int64
+}
+
+// DiskUsage walks root, which may hold one library or one library per user,
+// counting card directories by source and the bytes of every file.
+func DiskUsage(root string) (*Usage, error) {
+	usage := &Usage{Cards: make(map[string]int)}
+	// The card directory last counted. WalkDir visits meta.json before the
+	// card's sources/ and versions/ directories, whose files count towards
+	// bytes, not cards.
+	var card string
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if d.Name() == metaFile && (card == "" || !strings.HasPrefix(path, card+string(filepath.Separator))) {
+			// <source>/<Name>_<id>/meta.json
+			card = filepath.Dir(path)
+			usage.Cards[filepath.Base(filepath.Dir(card))]++
+		}
+		if info, err := d.Info(); err == nil {
+			usage.Bytes += info.Size()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to measure %s: %w", root, err)
+	}
+	return usage, nil
+}
@@ -0,0 +1,162 @@
+package saver
+
+import (
+	"charex/internal/core"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestCardID(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		sameIDs bool
+	}{
+		{"same url", "https://www.sakura.fm/chat/abc", "https://www.sakura.fm/chat/abc", true},
+		{"url query and slash", "https://WWW.sakura.fm/chat/abc/?ref=x#top", "http://www.sakura.fm/chat/abc", true},
+		{"url whitespace", " https://www.sakura.fm/chat/abc\n", "https://www.sakura.fm/chat/abc", true},
+		{"different urls", "https://www.sakura.fm/chat/abc", "https://www.sakura.fm/chat/abd", false},
+		{"same payload", `[{"role":"system"}]`, `[{"role":"system"}]`, true},
+		// Payloads of one character captured in two chats look alike, but only
+		// dedup may decide they are the same card.
+		{"different payloads", `[{"role":"system"},"chat 1"]`, `[{"role":"system"},"chat 2"]`, false},
+	}
+	for _, tt := range tests {
+		a, b := CardID("JanitorAI", []byte(tt.a)), CardID("JanitorAI", []byte(tt.b))
+		if (a == b) != tt.sameIDs {
+			t.Errorf("%s: CardID = %s and %s, want same IDs %v", tt.name, a, b, tt.sameIDs)
+		}
+	}
+
+	if CardID("SakuraFM", []byte("https://www.sakura.fm/chat/abc")) == CardID("Imported", []byte("https://www.sakura.fm/chat/abc")) {
+		t.Error("CardID is the same for two sources")
+	}
+}
+
+func TestSaveKeepsLookalikesApart(t *testing.T) {
+	ctx := context.Background()
+	library := NewLibrary(t.TempDir())
+	card := func(description string) *core.TavernCardV2 {
+		return &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Luna", Description: description}}
+	}
+	save := func(c *core.TavernCardV2, origin string) *CardRecord {
+		rec, err := library.Save(ctx, c, []byte(origin), nil, "JanitorAI", []byte(origin))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return rec
+	}
+
+	// Two characters with the same name and no description are two cards.
+	a := save(card(""), `["payload a"]`)
+	b := save(card(""), `["payload b"]`)
+	if a.ID == b.ID {
+		t.Error("cards of two payloads share an ID")
+	}
+	// The same origin saved again is a new version, whatever was edited.
+	c := save(card("Edited from the first word."), `["payload a"]`)
+	if c.ID != a.ID || c.Version != 2 {
+		t.Errorf("re-saved card = %s version %d, want %s version 2", c.ID, c.Version, a.ID)
+	}
+	if old, err := library.LoadVersion(c, 1); err != nil || old.Data.Description != "" {
+		t.Errorf("version 1 = %+v, %v; want the original card", old, err)
+	}
+}
+
+func TestDiskUsage(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	library := NewLibrary(UserRoot(dataDir, "alice"))
+	save := func(name, description, source, origin string) *CardRecord {
+		card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: name, Description: description}}
+		rec, err := library.Save(ctx, card, []byte(origin), nil, source, []byte(origin))
+		if err != nil {
+			t.Fatalf("Save(%s): %v", name, err)
+		}
+		return rec
+	}
+	target := save("Mira", "", "SakuraFM", "https://www.sakura.fm/chat/a")
+	other := save("Mira", "A cartographer.", "SakuraFM", "https://www.sakura.fm/chat/b")
+	save("Nova", "v1", "JanitorAI", "https://janitorai.com/characters/nova")
+	save("Nova", "v2", "JanitorAI", "https://janitorai.com/characters/nova")
+	// Merging keeps the other card's files, meta.json included, under sources/.
+	merged := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira", Description: "A cartographer."}}
+	if err := library.Merge(ctx, target, other, merged); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	usage, err := DiskUsage(dataDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(usage.Cards) != 2 || usage.Cards["SakuraFM"] != 1 || usage.Cards["JanitorAI"] != 1 {
+		t.Errorf("DiskUsage cards = %v, want SakuraFM:1 JanitorAI:1", usage.Cards)
+	}
+	if usage.Bytes == 0 {
+		t.Error("DiskUsage counted no bytes")
+	}
+}
+
+func TestUserLibraries(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	shared := NewLibrary(dataDir)
+	card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira"}}
+	if _, err := shared.Save(ctx, card, []byte("{}"), nil, "SakuraFM", []byte("https://www.sakura.fm/chat/a")); err != nil {
+		t.Fatal(err)
+	}
+	// A user named after a source gets a library of their own.
+	user := NewLibrary(UserRoot(dataDir, "SakuraFM"))
+	if _, err := user.Save(ctx, card, []byte("{}"), nil, "JanitorAI", []byte("https://janitorai.com/characters/b")); err != nil {
+		t.Fatal(err)
+	}
+
+	sources, err := shared.Sources()
+	if err != nil || !slices.Equal(sources, []string{"SakuraFM"}) {
+		t.Errorf("shared Sources() = %v, %v; want [SakuraFM]", sources, err)
+	}
+	if err := shared.CheckSource(UsersDir); err == nil {
+		t.Errorf("CheckSource(%q) accepted the users directory", UsersDir)
+	}
+	if _, err := shared.Save(ctx, card, []byte("{}"), nil, UsersDir, []byte("x")); !errors.Is(err, ErrInvalidSource) {
+		t.Errorf("Save under %q: err = %v, want ErrInvalidSource", UsersDir, err)
+	}
+	if records, err := shared.List(""); err != nil || len(records) != 1 || records[0].Source != "SakuraFM" {
+		t.Errorf("shared List() = %v, %v; want the shared card only", records, err)
+	}
+	if records, err := user.List(""); err != nil || len(records) != 1 || records[0].Source != "JanitorAI" {
+		t.Errorf("user List() = %v, %v; want the user's card only", records, err)
+	}
+}
+
+func TestMigrateUserLibrary(t *testing.T) {
+	ctx := context.Background()
+	dataDir := t.TempDir()
+	card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira"}}
+	if _, err := NewLibrary(filepath.Join(dataDir, "alice")).Save(ctx, card, []byte("{}"), nil, "SakuraFM", []byte("https://www.sakura.fm/chat/a")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewLibrary(dataDir).Save(ctx, card, []byte("{}"), nil, "JanitorAI", []byte("https://janitorai.com/characters/b")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, user := range []string{"alice", "JanitorAI", "nobody"} {
+		if err := MigrateUserLibrary(dataDir, user); err != nil {
+			t.Fatalf("MigrateUserLibrary(%s): %v", user, err)
+		}
+	}
+	if records, err := NewLibrary(UserRoot(dataDir, "alice")).List(""); err != nil || len(records) != 1 {
+		t.Errorf("alice's library after migration = %v, %v; want one card", records, err)
+	}
+	if _, err := os.Stat(filepath.Join(dataDir, "alice")); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("old library of alice still exists: %v", err)
+	}
+	// The shared library's source directory is not a user's library.
+	if records, err := NewLibrary(dataDir).List("JanitorAI"); err != nil || len(records) != 1 {
+		t.Errorf("shared JanitorAI cards after migration = %v, %v; want one card", records, err)
+	}
+}
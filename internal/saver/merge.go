@@ -0,0 +1,98 @@
+package saver
+
+import (
+	"charex/internal/core"
+	"charex/internal/dedup"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+)
+
+// sourcesDir is the per-card directory holding the raw data of cards merged into it.
+const sourcesDir = "sources"
+
+// Merge folds other into target. The merged card becomes target's new version,
+// other's files are preserved under target's sources/<source>_<id>/ directory so
+// both raw extractions are kept, and other is removed from the library.
+func (l *Library) Merge(ctx context.Context, target, other *CardRecord, merged *core.TavernCardV2) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if target.ID == other.ID {
+		return fmt.Errorf("cannot merge card %s into itself", target.ID)
+	}
+	if err := l.reload(target); err != nil {
+		return err
+	}
+	if err := l.reload(other); err != nil {
+		return err
+	}
+
+	// 1. Adopt the other card's avatar if the target has none.
+	var cardImage []byte
+	if _, err := os.Stat(target.PNGPath()); errors.Is(err, os.ErrNotExist) {
+		cardImage, _ = os.ReadFile(other.PNGPath())
+	}
+
+	// 2. Move the other card's files under the target first, so a failed move
+	// leaves both cards untouched.
+	keepDir := filepath.Join(target.Dir, sourcesDir, other.Source+"_"+other.ID)
+	if err := os.MkdirAll(filepath.Dir(keepDir), 0755); err != nil {
+		return fmt.Errorf("failed to create sources directory: %w", err)
+	}
+	if err := os.Rename(other.Dir, keepDir); err != nil {
+		return fmt.Errorf("failed to move merged card files: %w", err)
+	}
+
+	// 3. Record the merged card as the target's new version, keeping both cards'
+	// user tags. If that fails, move the other card back.
+	userTags := target.UserTags
+	target.UserTags = CardTags(target, other.UserTags)
+	if err := l.update(ctx, target, merged, nil, cardImage); err != nil {
+		target.UserTags = userTags
+		if rerr := os.Rename(keepDir, other.Dir); rerr != nil {
+			return errors.Join(err, fmt.Errorf("failed to restore merged card files: %w", rerr))
+		}
+		return err
+	}
+	if err := l.pruneCollections(other.ID); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "Merged cards", "card", other.ID, "into", target.ID)
+	return nil
+}
+
+// Fingerprint returns the record's duplicate-detection fingerprint, computing and
+// persisting it for cards saved before fingerprints were recorded.
+func (l *Library) Fingerprint(rec *CardRecord) (dedup.Fingerprint, error) {
+	// A recorded fingerprint is only read. Computing a missing one writes
+	// meta.json, which is done under the lock on a freshly read record.
+	if rec.Fingerprint != nil {
+		return *rec.Fingerprint, nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// A save since rec was read may have recorded the fingerprint already.
+	if err := l.reload(rec); err != nil {
+		return dedup.Fingerprint{}, err
+	}
+	if rec.Fingerprint != nil {
+		return *rec.Fingerprint, nil
+	}
+	card, err := readCard(rec.V2Path())
+	if err != nil {
+		return dedup.Fingerprint{}, err
+	}
+	avatar, _ := os.ReadFile(rec.PNGPath())
+	fp := dedup.FingerprintCard(card, avatar)
+	rec.Fingerprint = &fp
+	if err := writeMeta(rec); err != nil {
+		return fp, err
+	}
+	return fp, nil
+}
@@ -0,0 +1,97 @@
+package saver
+
+import (
+	"charex/internal/core"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	ctx := context.Background()
+	library := NewLibrary(t.TempDir())
+	save := func(name, description, origin string) *CardRecord {
+		card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: name, Description: description}}
+		rec, err := library.Save(ctx, card, []byte(origin), nil, "SakuraFM", []byte(origin))
+		if err != nil {
+			t.Fatalf("Save(%s): %v", name, err)
+		}
+		return rec
+	}
+	target := save("Mira", "", "https://www.sakura.fm/chat/a")
+	other := save("Mira", "A cartographer.", "https://www.sakura.fm/chat/b")
+
+	merged := core.Merge(&core.TavernCardV2{Data: core.TavernCardData{Name: "Mira"}}, &core.TavernCardV2{Data: core.TavernCardData{Description: "A cartographer."}}, core.DefaultMergeStrategy())
+	if err := library.Merge(ctx, target, other, merged); err != nil {
+		t.Fatalf("Merge: %v", err)
+	}
+
+	if target.Version != 2 {
+		t.Errorf("target version = %d, want 2", target.Version)
+	}
+	if _, err := library.Get(other.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(other) after merge: err = %v, want ErrNotFound", err)
+	}
+	if _, err := os.Stat(filepath.Join(target.Dir, sourcesDir, "SakuraFM_"+other.ID, rawFile)); err != nil {
+		t.Errorf("other card's raw data not kept: %v", err)
+	}
+	card, err := library.LoadCard(target)
+	if err != nil || card.Data.Description != "A cartographer." {
+		t.Errorf("merged card = %+v, %v", card, err)
+	}
+
+	if err := library.Merge(ctx, target, target, merged); err == nil {
+		t.Error("Merge of a card into itself succeeded")
+	}
+}
+
+func TestMergeFailureKeepsBothCards(t *testing.T) {
+	tests := []struct {
+		name    string
+		breakFn func(target *CardRecord) error
+	}{
+		// The other card's files cannot be moved under the target.
+		{"sources blocked", func(target *CardRecord) error {
+			return os.WriteFile(filepath.Join(target.Dir, sourcesDir), nil, 0644)
+		}},
+		// Recording the merged version fails after the files were moved.
+		{"target unreadable", func(target *CardRecord) error {
+			if err := os.Remove(target.V2Path()); err != nil {
+				return err
+			}
+			return os.Mkdir(target.V2Path(), 0755)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			library := NewLibrary(t.TempDir())
+			var recs []*CardRecord
+			for _, origin := range []string{"https://www.sakura.fm/chat/a", "https://www.sakura.fm/chat/b"} {
+				card := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira"}}
+				rec, err := library.Save(ctx, card, []byte(origin), nil, "SakuraFM", []byte(origin))
+				if err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+				recs = append(recs, rec)
+			}
+			target, other := recs[0], recs[1]
+			if err := tt.breakFn(target); err != nil {
+				t.Fatal(err)
+			}
+
+			merged := &core.TavernCardV2{Spec: "chara_card_v2", SpecVersion: "2.0", Data: core.TavernCardData{Name: "Mira", Description: "A cartographer."}}
+			if err := library.Merge(ctx, target, other, merged); err == nil {
+				t.Fatal("Merge succeeded")
+			}
+			if _, err := library.Get(other.ID); err != nil {
+				t.Errorf("Get(other) after failed merge: %v", err)
+			}
+			if rec, err := library.Get(target.ID); err != nil || rec.Version != 1 {
+				t.Errorf("Get(target) after failed merge = %+v, %v; want version 1", rec, err)
+			}
+		})
+	}
+}
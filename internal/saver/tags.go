@@ -0,0 +1,275 @@
+package saver
+
+import (
+	"charex/internal/fsutil"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// collectionsFile stores the library's named collections at the library root.
+const collectionsFile = "collections.json"
+
+// ErrCollectionNotFound is returned when no collection exists with a given name.
+var ErrCollectionNotFound = errors.New("collection not found")
+
+// Collection is a named, user-curated set of cards.
+type Collection struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	CardIDs     []string  `json:"card_ids"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// TagCount is the number of cards carrying a tag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// SetUserTags adds and removes user-defined tags on a card. User tags are library
+// metadata and do not create a new card version.
+func (l *Library) SetUserTags(rec *CardRecord, add, remove []string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.reload(rec); err != nil {
+		return err
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, t := range remove {
+		removed[strings.ToLower(strings.TrimSpace(t))] = true
+	}
+	var tags []string
+	for _, t := range append(append([]string{}, rec.UserTags...), add...) {
+		t = strings.TrimSpace(t)
+		if t == "" || removed[strings.ToLower(t)] || containsFold(tags, t) {
+			continue
+		}
+		tags = append(tags, t)
+	}
+	rec.UserTags = tags
+	return writeMeta(rec)
+}
+
+// TagCounts counts user tags and the tags stored in the cards themselves, most used first.
+func (l *Library) TagCounts() ([]TagCount, error) {
+	records, err := l.List("")
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int)
+	display := make(map[string]string)
+	for _, rec := range records {
+		card, err := l.LoadCard(rec)
+		if err != nil {
+			continue
+		}
+		for _, t := range CardTags(rec, card.Data.Tags) {
+			key := strings.ToLower(t)
+			if _, ok := display[key]; !ok {
+				display[key] = t
+			}
+			counts[key]++
+		}
+	}
+
+	result := make([]TagCount, 0, len(counts))
+	for key, n := range counts {
+		result = append(result, TagCount{Tag: display[key], Count: n})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Tag < result[j].Tag
+	})
+	return result, nil
+}
+
+// CardTags returns a card's own tags followed by the record's user tags, without duplicates.
+func CardTags(rec *CardRecord, cardTags []string) []string {
+	var tags []string
+	for _, t := range append(append([]string{}, cardTags...), rec.UserTags...) {
+		if t = strings.TrimSpace(t); t != "" && !containsFold(tags, t) {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// Collections returns every collection, sorted by name.
+func (l *Library) Collections() ([]Collection, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.readCollections()
+}
+
+// Collection returns the collection with the given name.
+func (l *Library) Collection(name string) (*Collection, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	collections, err := l.readCollections()
+	if err != nil {
+		return nil, err
+	}
+	for i := range collections {
+		if collections[i].Name == name {
+			return &collections[i], nil
+		}
+	}
+	return nil, ErrCollectionNotFound
+}
+
+// SaveCollection creates or replaces a collection, stamping its update time.
+func (l *Library) SaveCollection(c *Collection) error {
+	if strings.TrimSpace(c.Name) == "" {
+		return fmt.Errorf("collection name must not be empty")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.saveCollection(c)
+}
+
+func (l *Library) saveCollection(c *Collection) error {
+	collections, err := l.readCollections()
+	if err != nil {
+		return err
+	}
+	c.UpdatedAt = time.Now().UTC()
+	if c.CardIDs == nil {
+		c.CardIDs = []string{}
+	}
+	replaced := false
+	for i := range collections {
+		if collections[i].Name == c.Name {
+			collections[i] = *c
+			replaced = true
+		}
+	}
+	if !replaced {
+		collections = append(collections, *c)
+	}
+	return l.writeCollections(collections)
+}
+
+// UpdateCollection adds and removes card IDs, creating the collection if needed.
+func (l *Library) UpdateCollection(name string, add, remove []string) (*Collection, error) {
+	if strings.TrimSpace(name) == "" {
+		return nil, fmt.Errorf("collection name must not be empty")
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	collections, err := l.readCollections()
+	if err != nil {
+		return nil, err
+	}
+	c := &Collection{Name: name}
+	for i := range collections {
+		if collections[i].Name == name {
+			c = &collections[i]
+		}
+	}
+
+	removed := make(map[string]bool, len(remove))
+	for _, id := range remove {
+		removed[id] = true
+	}
+	var ids []string
+	seen := make(map[string]bool)
+	for _, id := range append(append([]string{}, c.CardIDs...), add...) {
+		if id == "" || removed[id] || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	c.CardIDs = ids
+	if err := l.saveCollection(c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// DeleteCollection removes a collection; the cards themselves are kept.
+func (l *Library) DeleteCollection(name string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	collections, err := l.readCollections()
+	if err != nil {
+		return err
+	}
+	for i := range collections {
+		if collections[i].Name == name {
+			return l.writeCollections(append(collections[:i], collections[i+1:]...))
+		}
+	}
+	return ErrCollectionNotFound
+}
+
+// pruneCollections drops a deleted card from every collection. Callers hold l.mu.
+func (l *Library) pruneCollections(id string) error {
+	collections, err := l.readCollections()
+	if err != nil {
+		return err
+	}
+	changed := false
+	for i := range collections {
+		for j, cardID := range collections[i].CardIDs {
+			if cardID == id {
+				collections[i].CardIDs = append(collections[i].CardIDs[:j], collections[i].CardIDs[j+1:]...)
+				changed = true
+				break
+			}
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return l.writeCollections(collections)
+}
+
+func (l *Library) readCollections() ([]Collection, error) {
+	data, err := os.ReadFile(filepath.Join(l.Root, collectionsFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return []Collection{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var collections []Collection
+	if err := json.Unmarshal(data, &collections); err != nil {
+		return nil, fmt.Errorf("failed to parse collections: %w", err)
+	}
+	sort.Slice(collections, func(i, j int) bool { return collections[i].Name < collections[j].Name })
+	return collections, nil
+}
+
+func (l *Library) writeCollections(collections []Collection) error {
+	data, err := json.MarshalIndent(collections, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal collections: %w", err)
+	}
+	if err := os.MkdirAll(l.Root, 0755); err != nil {
+		return fmt.Errorf("failed to create library directory: %w", err)
+	}
+	return fsutil.WriteFileAtomic(filepath.Join(l.Root, collectionsFile), data, 0644)
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
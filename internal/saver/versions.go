@@ -0,0 +1,134 @@
+package saver
+
+import (
+	"charex/internal/core"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// versionsDir is the per-card directory holding archived versions, one numbered subdirectory each.
+const versionsDir = "versions"
+
+// VersionInfo describes one stored version of a card.
+type VersionInfo struct {
+	Version          int       `json:"version"`
+	CharacterVersion string    `json:"character_version"`
+	SavedAt          time.Time `json:"saved_at"`
+	Current          bool      `json:"current"`
+}
+
+// currentVersion returns the version number of the card's current files.
+// Cards saved before versioning was introduced count as version 1.
+func (r *CardRecord) currentVersion() int {
+	if r.Version < 1 {
+		return 1
+	}
+	return r.Version
+}
+
+// versionDir returns the directory of an archived version.
+func (r *CardRecord) versionDir(version int) string {
+	return filepath.Join(r.Dir, versionsDir, strconv.Itoa(version))
+}
+
+// versionString formats a version number as a card character_version.
+func versionString(version int) string {
+	return fmt.Sprintf("%d.0", version)
+}
+
+// cardChanged reports whether card differs from the record's current card,
+// ignoring the character_version field that the library manages itself.
+func cardChanged(rec *CardRecord, card *core.TavernCardV2) (bool, error) {
+	current, err := readCard(rec.V2Path())
+	if errors.Is(err, os.ErrNotExist) {
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	candidate := *card
+	candidate.Data.CharacterVersion = current.Data.CharacterVersion
+	a, err := json.Marshal(current)
+	if err != nil {
+		return false, err
+	}
+	b, err := json.Marshal(&candidate)
+	if err != nil {
+		return false, err
+	}
+	return string(a) != string(b), nil
+}
+
+// archiveVersion copies the record's current files into versions/<n>/.
+func archiveVersion(rec *CardRecord) error {
+	dir := rec.versionDir(rec.currentVersion())
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create version directory: %w", err)
+	}
+	for _, name := range []string{metaFile, v2File, rawFile, pngFile} {
+		data, err := os.ReadFile(filepath.Join(rec.Dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s for archiving: %w", name, err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+			return fmt.Errorf("failed to archive %s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Versions lists every stored version of a card, oldest first.
+func (l *Library) Versions(rec *CardRecord) ([]VersionInfo, error) {
+	entries, err := os.ReadDir(filepath.Join(rec.Dir, versionsDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	var versions []VersionInfo
+	for _, e := range entries {
+		n, err := strconv.Atoi(e.Name())
+		if err != nil || !e.IsDir() || n >= rec.currentVersion() {
+			continue
+		}
+		info := VersionInfo{Version: n, CharacterVersion: versionString(n)}
+		if old, err := readRecord(rec.versionDir(n)); err == nil {
+			info.SavedAt = old.UpdatedAt
+		}
+		if card, err := readCard(filepath.Join(rec.versionDir(n), v2File)); err == nil {
+			info.CharacterVersion = card.Data.CharacterVersion
+		}
+		versions = append(versions, info)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+
+	current := VersionInfo{Version: rec.currentVersion(), CharacterVersion: versionString(rec.currentVersion()), SavedAt: rec.UpdatedAt, Current: true}
+	if card, err := readCard(rec.V2Path()); err == nil {
+		current.CharacterVersion = card.Data.CharacterVersion
+	}
+	return append(versions, current), nil
+}
+
+// LoadVersion reads the card as it was at the given version.
+func (l *Library) LoadVersion(rec *CardRecord, version int) (*core.TavernCardV2, error) {
+	if version == rec.currentVersion() {
+		return readCard(rec.V2Path())
+	}
+	if version < 1 || version > rec.currentVersion() {
+		return nil, fmt.Errorf("card %s has no version %d", rec.ID, version)
+	}
+	card, err := readCard(filepath.Join(rec.versionDir(version), v2File))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("card %s has no version %d", rec.ID, version)
+	}
+	return card, err
+}
@@ -0,0 +1,294 @@
+// Package watch ingests the files dropped into a folder: card files are
+// imported and extraction inputs, such as captured JanitorAI request bodies,
+// are run through the extractor detected for them. Processed files are moved
+// to the folder's done/ or failed/ subfolder.
+package watch
+
+import (
+	"charex/internal/cardfile"
+	"charex/internal/core"
+	"charex/internal/extractors"
+	"charex/internal/logging"
+	"charex/internal/saver"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Subfolders processed files are moved to.
+const (
+	DoneDir   = "done"
+	FailedDir = "failed"
+)
+
+// DefaultSettle is how long a file must stay unchanged before it is processed.
+const DefaultSettle = time.Second
+
+// Result is the outcome of processing one file.
+type Result struct {
+	File    string             // Path of the file in the watched folder.
+	Source  string             // Extractor that read it, or saver.ImportSource.
+	Record  *saver.CardRecord  // The saved card; nil on failure.
+	Card    *core.TavernCardV2 // The card as saved; nil on failure.
+	MovedTo string             // Where the file was moved; empty if it could not be.
+	Err     error
+}
+
+// Watcher processes the files created in a folder.
+type Watcher struct {
+	Dir     string
+	Library *saver.Library
+	Options extractors.Options
+
+	// Settle is how long a file must stay unchanged before it is processed, so
+	// files still being written are not read half-way.
+	Settle time.Duration
+
+	// OnResult, if set, is called after each file is processed.
+	OnResult func(ctx context.Context, r Result)
+
+	notify     *fsnotify.Watcher
+	extractors map[string]extractors.Extractor
+}
+
+// New starts watching dir, creating its done/ and failed/ subfolders. Files are
+// only processed once Run is called.
+func New(dir string, library *saver.Library, opts extractors.Options) (*Watcher, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open watch folder: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("watch folder %s is not a directory", dir)
+	}
+	for _, sub := range []string{DoneDir, FailedDir} {
+		if err := os.MkdirAll(filepath.Join(dir, sub), 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s folder: %w", sub, err)
+		}
+	}
+
+	notify, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("failed to start watcher: %w", err)
+	}
+	if err := notify.Add(dir); err != nil {
+		notify.Close()
+		return nil, fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+	return &Watcher{
+		Dir:        dir,
+		Library:    library,
+		Options:    opts,
+		Settle:     DefaultSettle,
+		notify:     notify,
+		extractors: make(map[string]extractors.Extractor),
+	}, nil
+}
+
+// Run processes the files already in the folder, then every new file, one at
+// a time, until ctx is cancelled. A file is processed once no write to it has
+// been seen for Settle.
+func (w *Watcher) Run(ctx context.Context) error {
+	defer w.notify.Close()
+	slog.Info("Watching folder", "dir", w.Dir, "settle", w.Settle)
+
+	// 1. Files dropped while nothing was watching.
+	entries, err := os.ReadDir(w.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read watch folder: %w", err)
+	}
+	for _, e := range entries {
+		if ctx.Err() != nil {
+			return nil
+		}
+		if e.Type().IsRegular() && !ignored(e.Name()) {
+			w.process(ctx, filepath.Join(w.Dir, e.Name()))
+		}
+	}
+
+	// 2. New files. Every write restarts the file's settle timer; a settled
+	// file comes back on ready and is processed on this goroutine.
+	pending := make(map[string]*time.Timer)
+	ready := make(chan string)
+	defer func() {
+		for _, t := range pending {
+			t.Stop()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+
+		case event, ok := <-w.notify.Events:
+			if !ok {
+				return nil
+			}
+			path := event.Name
+			if ignored(filepath.Base(path)) {
+				continue
+			}
+			if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+				// Renamed or removed before settling: nothing left to process.
+				if t, ok := pending[path]; ok && (event.Has(fsnotify.Rename) || event.Has(fsnotify.Remove)) {
+					t.Stop()
+					delete(pending, path)
+				}
+				continue
+			}
+			if t, ok := pending[path]; ok {
+				t.Reset(w.Settle)
+				continue
+			}
+			pending[path] = time.AfterFunc(w.Settle, func() {
+				select {
+				case ready <- path:
+				case <-ctx.Done():
+				}
+			})
+
+		case path := <-ready:
+			delete(pending, path)
+			if info, err := os.Lstat(path); err == nil && info.Mode().IsRegular() {
+				w.process(ctx, path)
+			}
+
+		case err, ok := <-w.notify.Errors:
+			if !ok {
+				return nil
+			}
+			slog.Warn("Watch folder error", "dir", w.Dir, "error", err)
+		}
+	}
+}
+
+// ignored reports whether a file name is hidden or marks a file still being
+// written, such as a partial download.
+func ignored(name string) bool {
+	if strings.HasPrefix(name, ".") || strings.HasSuffix(name, "~") {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".tmp", ".part", ".partial", ".crdownload", ".download", ".swp":
+		return true
+	}
+	return false
+}
+
+// process saves the card held or described by one file and moves the file out
+// of the folder. Processing outlives ctx, so that a shutdown does not move a
+// good file to failed/.
+func (w *Watcher) process(ctx context.Context, path string) {
+	ctx = logging.WithID(context.WithoutCancel(ctx), logging.NewID())
+	start := time.Now()
+	r := Result{File: path}
+	r.Source, r.Record, r.Card, r.Err = w.ingest(ctx, path)
+
+	sub := DoneDir
+	if r.Err != nil {
+		sub = FailedDir
+		slog.WarnContext(ctx, "Failed to process watched file", "file", path, "source", r.Source, "error", r.Err)
+	} else {
+		slog.InfoContext(ctx, "Processed watched file", "file", path, "source", r.Source, "card", r.Record.ID, "duration", time.Since(start))
+	}
+	movedTo, err := w.move(path, sub, r.Err)
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to move watched file", "file", path, "error", err)
+		if r.Err == nil {
+			r.Err = err
+		}
+	}
+	r.MovedTo = movedTo
+
+	if w.OnResult != nil {
+		w.OnResult(ctx, r)
+	}
+}
+
+// ingest reads one file and saves its card. Card files are imported as-is;
+// anything else is handed to the extractor its content is meant for.
+func (w *Watcher) ingest(ctx context.Context, path string) (string, *saver.CardRecord, *core.TavernCardV2, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", nil, nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// 1. Card files: PNG, CHARX and card JSON.
+	f, readErr := cardfile.Read(data)
+	if readErr == nil {
+		rec, err := w.Library.Save(ctx, f.Card, f.CardJSON, f.Image, saver.ImportSource, f.CardJSON)
+		if err != nil {
+			return saver.ImportSource, nil, nil, fmt.Errorf("failed to save card: %w", err)
+		}
+		return saver.ImportSource, rec, f.Card, nil
+	}
+
+	// 2. Extraction inputs. Images and archives without a card are not.
+	source := ""
+	if cardfile.DetectFormat(data) == cardfile.FormatJSON {
+		source = extractors.DetectSource(data)
+	}
+	if source == "" {
+		return "", nil, nil, fmt.Errorf("not a card or a recognized extraction input: %w", readErr)
+	}
+	if source == extractors.SourceSakuraFM {
+		data = []byte(strings.TrimSpace(string(data)))
+	}
+	extractor, err := w.extractor(source)
+	if err != nil {
+		return source, nil, nil, err
+	}
+	card, rawData, cardImage, err := extractor.Extract(ctx, data)
+	if err != nil {
+		return source, nil, nil, fmt.Errorf("extraction failed: %w", err)
+	}
+	rec, err := w.Library.Save(ctx, card, rawData, cardImage, source, data)
+	if err != nil {
+		return source, nil, nil, fmt.Errorf("failed to save card: %w", err)
+	}
+	return source, rec, card, nil
+}
+
+// extractor returns the extractor of a source, creating it on first use.
+func (w *Watcher) extractor(source string) (extractors.Extractor, error) {
+	if e, ok := w.extractors[source]; ok {
+		return e, nil
+	}
+	e, err := extractors.New(source, w.Options)
+	if err != nil {
+		return nil, err
+	}
+	w.extractors[source] = e
+	return e, nil
+}
+
+// move moves a processed file into a subfolder, adding a timestamp to its name
+// if the subfolder already has a file of that name. Failed files get a
+// <name>.error.txt next to them explaining the failure.
+func (w *Watcher) move(path, sub string, failure error) (string, error) {
+	name := filepath.Base(path)
+	dst := filepath.Join(w.Dir, sub, name)
+	if _, err := os.Lstat(dst); err == nil {
+		ext := filepath.Ext(name)
+		dst = filepath.Join(w.Dir, sub, strings.TrimSuffix(name, ext)+"-"+time.Now().UTC().Format("20060102-150405.000")+ext)
+	}
+	if err := os.Rename(path, dst); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("file disappeared before it could be moved: %w", err)
+		}
+		return "", fmt.Errorf("failed to move file to %s: %w", sub, err)
+	}
+	if failure != nil {
+		if err := os.WriteFile(dst+".error.txt", []byte(failure.Error()+"\n"), 0644); err != nil {
+			return dst, fmt.Errorf("failed to write error file: %w", err)
+		}
+	}
+	return dst, nil
+}
@@ -1,74 +1,207 @@
 package web
 
 import (
+	"charex/internal/auth"
 	"charex/internal/core"
+	"charex/internal/dedup"
+	"charex/internal/saver"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"sort"
-	"strings"
+	"strconv"
+	"time"
 )
 
+// LibraryCard is a stored card together with its library metadata.
+type LibraryCard struct {
+	ID        string    `json:"id"`
+	Source    string    `json:"source"`
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	UserTags  []string  `json:"user_tags"`
+	core.TavernCardV2
+
+	// PossibleDuplicates lists the IDs of other cards that look like the same character.
+	PossibleDuplicates []string `json:"possible_duplicates,omitempty"`
+}
+
 // CardSource represents a source of character cards (e.g., 'SakuraFM').
 type CardSource struct {
-	Name  string                `json:"name"`
-	Cards []core.TavernCardV2   `json:"cards"`
+	Name  string        `json:"name"`
+	Cards []LibraryCard `json:"cards"`
 }
 
 // CardsResponse is the structure for the GET /api/cards response.
 type CardsResponse struct {
-	Sources []CardSource `json:"sources"`
+	Sources    []CardSource `json:"sources"`
+	Duplicates [][]string   `json:"duplicates"` // Groups of card IDs that are likely the same character.
+
+	// Epoch and Seq are the event position the listing reflects; clients resume
+	// from here to receive every change made after it.
+	Epoch string `json:"epoch"`
+	Seq   uint64 `json:"seq"`
+}
+
+// MergeRequest is the body of a POST /api/cards/merge request.
+type MergeRequest struct {
+	TargetID string `json:"target_id"` // The card that is kept.
+	OtherID  string `json:"other_id"`  // The card folded into the target and removed.
+	Strategy string `json:"strategy"`  // Optional field strategies, see core.ParseMergeStrategy.
+	DryRun   bool   `json:"dry_run"`   // Return the merged card without saving it.
 }
 
 func (s *Server) GetCards(w http.ResponseWriter, r *http.Request) {
-	sources, err := s.scanForCardSources()
+	library := s.libraryFor(r)
+	epoch, seq := s.hub.Position()
+	sources, records, err := s.scanForCardSources(library)
 	if err != nil {
 		http.Error(w, "Failed to scan for card sources", http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	response := CardsResponse{Sources: sources}
+	response := CardsResponse{Sources: sources, Duplicates: s.flagDuplicates(library, sources, records), Epoch: epoch, Seq: seq}
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		http.Error(w, "Failed to encode response", http.StatusInternalServerError)
 	}
 }
 
-func (s *Server) scanForCardSources() ([]CardSource, error) {
+// flagDuplicates groups likely duplicates across all sources and records each
+// card's possible duplicates on the card itself. records holds the listed
+// cards' records by ID.
+func (s *Server) flagDuplicates(library *saver.Library, sources []CardSource, records map[string]*saver.CardRecord) [][]string {
+	var items []dedup.Item
+	for _, source := range sources {
+		for _, card := range source.Cards {
+			rec, ok := records[card.ID]
+			if !ok {
+				continue
+			}
+			fp, err := library.Fingerprint(rec)
+			if err != nil {
+				slog.Error("Failed to fingerprint card", "card", card.ID, "error", err)
+				continue
+			}
+			items = append(items, dedup.Item{ID: card.ID, Fingerprint: fp})
+		}
+	}
+
+	groups := dedup.Groups(items)
+	groupOf := make(map[string][]string)
+	for _, group := range groups {
+		for _, id := range group {
+			groupOf[id] = group
+		}
+	}
+	for i := range sources {
+		for j := range sources[i].Cards {
+			card := &sources[i].Cards[j]
+			for _, id := range groupOf[card.ID] {
+				if id != card.ID {
+					card.PossibleDuplicates = append(card.PossibleDuplicates, id)
+				}
+			}
+		}
+	}
+	if groups == nil {
+		groups = [][]string{}
+	}
+	return groups
+}
+
+// MergeCards folds one card into another, keeping both raw extractions.
+func (s *Server) MergeCards(w http.ResponseWriter, r *http.Request) {
+	var req MergeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid merge request", http.StatusBadRequest)
+		return
+	}
+	if req.TargetID == req.OtherID {
+		http.Error(w, "Cannot merge a card into itself", http.StatusBadRequest)
+		return
+	}
+	strategy, err := core.ParseMergeStrategy(req.Strategy)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	library := s.libraryFor(r)
+	target, ok := s.lookupCard(w, library, req.TargetID)
+	if !ok {
+		return
+	}
+	other, ok := s.lookupCard(w, library, req.OtherID)
+	if !ok {
+		return
+	}
+
+	targetCard, err := library.LoadCard(target)
+	if err != nil {
+		http.Error(w, "Failed to load target card", http.StatusInternalServerError)
+		return
+	}
+	otherCard, err := library.LoadCard(other)
+	if err != nil {
+		http.Error(w, "Failed to load card to merge", http.StatusInternalServerError)
+		return
+	}
+
+	merged := core.Merge(targetCard, otherCard, strategy)
+	if req.DryRun {
+		writeJSON(w, newLibraryCard(target, merged))
+		return
+	}
+	if err := library.Merge(r.Context(), target, other, merged); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to merge cards", "card", other.ID, "into", target.ID, "error", err)
+		http.Error(w, "Failed to merge cards", http.StatusInternalServerError)
+		return
+	}
+
+	result := newLibraryCard(target, merged)
+	s.publish(Event{
+		User:    auth.UserFrom(r.Context()),
+		Type:    "cards_merged",
+		Topics:  append(cardTopics(target.Source, target.ID, other.ID), SourceTopic(other.Source)),
+		Payload: CardsMergedPayload{Source: target.Source, Card: result, MergedID: other.ID},
+	})
+	writeJSON(w, result)
+}
+
+// scanForCardSources lists the library's cards by source, along with their
+// records by ID.
+func (s *Server) scanForCardSources(library *saver.Library) ([]CardSource, map[string]*saver.CardRecord, error) {
 	var sources []CardSource
+	records := make(map[string]*saver.CardRecord)
 
 	// Create the data directory if it doesn't exist.
-	if err := os.MkdirAll(s.DataDir, 0755); err != nil {
-		return nil, fmt.Errorf("failed to create data directory: %w", err)
+	if err := os.MkdirAll(library.Root, 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create data directory: %w", err)
 	}
 
 	// Ensure that the default source directories exist.
-	if err := os.MkdirAll(filepath.Join(s.DataDir, "SakuraFM"), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create sakura directory: %w", err)
+	if err := os.MkdirAll(filepath.Join(library.Root, "SakuraFM"), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create sakura directory: %w", err)
 	}
-	if err := os.MkdirAll(filepath.Join(s.DataDir, "JanitorAI"), 0755); err != nil {
-		return nil, fmt.Errorf("failed to create JanitorAI directory: %w", err)
+	if err := os.MkdirAll(filepath.Join(library.Root, "JanitorAI"), 0755); err != nil {
+		return nil, nil, fmt.Errorf("failed to create JanitorAI directory: %w", err)
 	}
 
-	sourceDirs, err := ioutil.ReadDir(s.DataDir)
+	sourceNames, err := library.Sources()
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
+	sort.Strings(sourceNames)
 
-	for _, sourceDir := range sourceDirs {
-		if !sourceDir.IsDir() {
-			continue
-		}
-
-		sourceName := sourceDir.Name()
-		sourcePath := filepath.Join(s.DataDir, sourceName)
-		cards, err := s.loadCardsFromSource(sourcePath)
+	for _, sourceName := range sourceNames {
+		cards, err := s.loadCardsFromSource(library, sourceName, records)
 		if err != nil {
-			log.Printf("Error loading cards from source %s: %v", sourceName, err)
+			slog.Error("Failed to load cards from source", "source", sourceName, "error", err)
 			continue
 		}
 
@@ -80,53 +213,135 @@ func (s *Server) scanForCardSources() ([]CardSource, error) {
 		}
 	}
 
-	return sources, nil
+	return sources, records, nil
 }
 
-func (s *Server) loadCardsFromSource(sourcePath string) ([]core.TavernCardV2, error) {
-	var cards []core.TavernCardV2
-	var files []os.FileInfo
-
-	err := filepath.Walk(sourcePath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && strings.HasSuffix(info.Name(), ".v2.json") {
-			files = append(files, info)
-		}
-		return nil
-	})
+// loadCardsFromSource loads the cards of one source, adding their records to records.
+func (s *Server) loadCardsFromSource(library *saver.Library, sourceName string, records map[string]*saver.CardRecord) ([]LibraryCard, error) {
+	listed, err := library.List(sourceName)
 	if err != nil {
 		return nil, err
 	}
 
-	sort.Slice(files, func(i, j int) bool {
-		return files[i].ModTime().After(files[j].ModTime())
-	})
-
-	for _, file := range files {
-		log.Printf("Loading card from file: %s", file.Name())
-		card, err := s.loadCard(filepath.Join(sourcePath, file.Name()))
+	cards := make([]LibraryCard, 0, len(listed))
+	for _, rec := range listed {
+		card, err := library.LoadCard(rec)
 		if err != nil {
-			log.Printf("Error loading card %s: %v", file.Name(), err)
+			slog.Error("Failed to load card", "card", rec.ID, "error", err)
 			continue
 		}
-		cards = append(cards, *card)
+		cards = append(cards, newLibraryCard(rec, card))
+		records[rec.ID] = rec
 	}
 
 	return cards, nil
 }
 
-func (s *Server) loadCard(cardPath string) (*core.TavernCardV2, error) {
-	data, err := ioutil.ReadFile(cardPath)
+func newLibraryCard(rec *saver.CardRecord, card *core.TavernCardV2) LibraryCard {
+	return LibraryCard{
+		ID:           rec.ID,
+		Source:       rec.Source,
+		Version:      rec.Version,
+		CreatedAt:    rec.CreatedAt,
+		UpdatedAt:    rec.UpdatedAt,
+		UserTags:     append([]string{}, rec.UserTags...),
+		TavernCardV2: *card,
+	}
+}
+
+// CardVersionsResponse is the structure for the GET /api/cards/{id}/versions response.
+type CardVersionsResponse struct {
+	ID       string              `json:"id"`
+	Versions []saver.VersionInfo `json:"versions"`
+}
+
+// CardDiffResponse is the structure for the GET /api/cards/{id}/diff response.
+type CardDiffResponse struct {
+	ID      string             `json:"id"`
+	From    int                `json:"from"`
+	To      int                `json:"to"`
+	Changes []core.FieldChange `json:"changes"`
+}
+
+func (s *Server) GetCardVersions(w http.ResponseWriter, r *http.Request) {
+	library := s.libraryFor(r)
+	rec, ok := s.lookupCard(w, library, r.PathValue("id"))
+	if !ok {
+		return
+	}
+	versions, err := library.Versions(rec)
 	if err != nil {
-		return nil, err
+		slog.ErrorContext(r.Context(), "Failed to list card versions", "card", rec.ID, "error", err)
+		http.Error(w, "Failed to list card versions", http.StatusInternalServerError)
+		return
 	}
+	writeJSON(w, CardVersionsResponse{ID: rec.ID, Versions: versions})
+}
 
-	var card core.TavernCardV2
-	if err := json.Unmarshal(data, &card); err != nil {
-		return nil, err
+// GetCardDiff compares two versions of a card. The "from" and "to" query parameters
+// default to the previous and the current version.
+func (s *Server) GetCardDiff(w http.ResponseWriter, r *http.Request) {
+	library := s.libraryFor(r)
+	rec, ok := s.lookupCard(w, library, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	to := rec.Version
+	if to < 1 {
+		to = 1
+	}
+	var err error
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid 'to' version", http.StatusBadRequest)
+			return
+		}
+	}
+	from := to - 1
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "Invalid 'from' version", http.StatusBadRequest)
+			return
+		}
+	}
+	if from < 1 {
+		http.Error(w, "No earlier version to compare against", http.StatusBadRequest)
+		return
 	}
 
-	return &card, nil
-}
\ No newline at end of file
+	oldCard, err := library.LoadVersion(rec, from)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	newCard, err := library.LoadVersion(rec, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, CardDiffResponse{ID: rec.ID, From: from, To: to, Changes: core.Diff(oldCard, newCard)})
+}
+
+// lookupCard resolves a card ID, writing an error response if it cannot be found.
+func (s *Server) lookupCard(w http.ResponseWriter, library *saver.Library, id string) (*saver.CardRecord, bool) {
+	rec, err := library.Get(id)
+	if errors.Is(err, saver.ErrNotFound) {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return nil, false
+	}
+	if err != nil {
+		slog.Error("Failed to look up card", "card", id, "error", err)
+		http.Error(w, "Failed to look up card", http.StatusInternalServerError)
+		return nil, false
+	}
+	return rec, true
+}
+
+// writeJSON encodes v as the JSON response body.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
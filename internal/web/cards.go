@@ -0,0 +1,237 @@
+package web
+
+import (
+	"charex/internal/auth"
+	"charex/internal/core"
+	"charex/internal/saver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// maxCardBodySize bounds the size of an uploaded card JSON document.
+const maxCardBodySize = 16 << 20
+
+// GetCard returns a single card with its library metadata.
+func (s *Server) GetCard(w http.ResponseWriter, r *http.Request) {
+	rec, card, ok := s.loadSourceCard(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, newLibraryCard(rec, card))
+}
+
+// GetCardPNG serves the card image with the card data embedded.
+func (s *Server) GetCardPNG(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.lookupSourceCard(w, r)
+	if !ok {
+		return
+	}
+	f, err := os.Open(rec.PNGPath())
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Card has no image", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to open card image", "card", rec.ID, "error", err)
+		http.Error(w, "Failed to read card image", http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		http.Error(w, "Failed to read card image", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/png")
+	setAttachment(w, r, rec, ".png")
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+// GetCardJSON serves the card as V2 (default) or V3 JSON, selected by the "spec" query parameter.
+func (s *Server) GetCardJSON(w http.ResponseWriter, r *http.Request) {
+	rec, card, ok := s.loadSourceCard(w, r)
+	if !ok {
+		return
+	}
+
+	var body interface{}
+	spec := r.URL.Query().Get("spec")
+	switch spec {
+	case "", "v2":
+		spec = "v2"
+		body = card
+	case "v3":
+		_, err := os.Stat(rec.PNGPath())
+		body = core.ToV3(card, rec.CreatedAt, rec.UpdatedAt, err == nil)
+	default:
+		http.Error(w, fmt.Sprintf("Unknown spec %q, expected v2 or v3", spec), http.StatusBadRequest)
+		return
+	}
+
+	data, err := json.MarshalIndent(body, "", "  ")
+	if err != nil {
+		http.Error(w, "Failed to encode card", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	setAttachment(w, r, rec, "."+spec+".json")
+	w.Write(data)
+}
+
+// GetCardRaw serves the raw data the card was extracted from.
+func (s *Server) GetCardRaw(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.lookupSourceCard(w, r)
+	if !ok {
+		return
+	}
+	data, err := os.ReadFile(rec.RawPath())
+	if errors.Is(err, os.ErrNotExist) {
+		http.Error(w, "Card has no raw data", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to read raw card data", "card", rec.ID, "error", err)
+		http.Error(w, "Failed to read raw data", http.StatusInternalServerError)
+		return
+	}
+
+	// Raw data is HTML for page scrapes and JSON for captured requests; never let
+	// a browser render scraped HTML in our origin.
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if json.Valid(data) {
+		w.Header().Set("Content-Type", "application/json")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(data)
+}
+
+// DeleteCard removes a card and tells every client about it.
+func (s *Server) DeleteCard(w http.ResponseWriter, r *http.Request) {
+	rec, ok := s.lookupSourceCard(w, r)
+	if !ok {
+		return
+	}
+	if err := s.libraryFor(r).Delete(r.Context(), rec); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete card", "card", rec.ID, "error", err)
+		http.Error(w, "Failed to delete card", http.StatusInternalServerError)
+		return
+	}
+	s.publish(Event{
+		User:    auth.UserFrom(r.Context()),
+		Type:    "card_deleted",
+		Topics:  cardTopics(rec.Source, rec.ID),
+		Payload: CardDeletedPayload{Source: rec.Source, ID: rec.ID},
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// lookupSourceCard resolves the {source} and {id} path values to a card record.
+func (s *Server) lookupSourceCard(w http.ResponseWriter, r *http.Request) (*saver.CardRecord, bool) {
+	rec, ok := s.lookupCard(w, s.libraryFor(r), r.PathValue("id"))
+	if !ok {
+		return nil, false
+	}
+	if rec.Source != r.PathValue("source") {
+		http.Error(w, "Card not found", http.StatusNotFound)
+		return nil, false
+	}
+	return rec, true
+}
+
+// loadSourceCard resolves the {source} and {id} path values and loads the card.
+func (s *Server) loadSourceCard(w http.ResponseWriter, r *http.Request) (*saver.CardRecord, *core.TavernCardV2, bool) {
+	rec, ok := s.lookupSourceCard(w, r)
+	if !ok {
+		return nil, nil, false
+	}
+	card, err := s.libraryFor(r).LoadCard(rec)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to load card", "card", rec.ID, "error", err)
+		http.Error(w, "Failed to load card", http.StatusInternalServerError)
+		return nil, nil, false
+	}
+	return rec, card, true
+}
+
+// setAttachment names the download after the character unless ?inline=1 is given.
+func setAttachment(w http.ResponseWriter, r *http.Request, rec *saver.CardRecord, ext string) {
+	if r.URL.Query().Get("inline") == "1" {
+		return
+	}
+	name := strings.Map(func(r rune) rune {
+		if r == '"' || r == '\\' || r < 0x20 {
+			return '_'
+		}
+		return r
+	}, rec.Name)
+	if name == "" {
+		name = rec.ID
+	}
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s%s"`, name, ext))
+}
+
+// publishCardUpdated tells the user's clients about an edited card. Only the
+// latest state of a card matters, so queued updates of it are coalesced.
+func (s *Server) publishCardUpdated(user string, card LibraryCard) {
+	s.publish(Event{
+		User:    user,
+		Type:    "card_updated",
+		Topics:  cardTopics(card.Source, card.ID),
+		Key:     "card_updated:" + card.ID,
+		Payload: NewCardPayload{Source: card.Source, Card: card},
+	})
+}
+
+// UpdateCardResponse is returned when an edited card fails validation.
+type UpdateCardResponse struct {
+	Error  string                 `json:"error"`
+	Issues []core.ValidationIssue `json:"issues"`
+}
+
+// UpdateCard replaces a card with an edited version, re-embedding its PNG and
+// recording a new version.
+func (s *Server) UpdateCard(w http.ResponseWriter, r *http.Request) {
+	library := s.libraryFor(r)
+	rec, ok := s.lookupCard(w, library, r.PathValue("id"))
+	if !ok {
+		return
+	}
+
+	var card core.TavernCardV2
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxCardBodySize)).Decode(&card); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid card JSON: %v", err), http.StatusBadRequest)
+		return
+	}
+	if card.Data.Extensions == nil {
+		card.Data.Extensions = make(map[string]interface{})
+	}
+	if card.Data.AlternateGreetings == nil {
+		card.Data.AlternateGreetings = []string{}
+	}
+	if card.Data.Tags == nil {
+		card.Data.Tags = []string{}
+	}
+
+	if issues := core.Validate(&card); core.HasErrors(issues) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(UpdateCardResponse{Error: "Card failed validation", Issues: issues})
+		return
+	}
+
+	if err := library.Update(r.Context(), rec, &card); err != nil {
+		slog.ErrorContext(r.Context(), "Failed to update card", "card", rec.ID, "error", err)
+		http.Error(w, "Failed to save card", http.StatusInternalServerError)
+		return
+	}
+
+	updated := newLibraryCard(rec, &card)
+	s.publishCardUpdated(auth.UserFrom(r.Context()), updated)
+	writeJSON(w, updated)
+}
@@ -0,0 +1,214 @@
+package web
+
+import (
+	"charex/internal/auth"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sseKeepAlive is how often an idle event stream sends a comment, so proxies
+// do not close it.
+const sseKeepAlive = 30 * time.Second
+
+// ExtractRequest is the body of a POST /api/extract request.
+type ExtractRequest struct {
+	Source string `json:"source"` // "SakuraFM" or "JanitorAI".
+	URL    string `json:"url"`
+}
+
+// GetEvents streams hub events as Server-Sent Events, for clients that cannot
+// use the WebSocket. The "topics" query parameter is a comma-separated list of
+// topics to follow; it defaults to cards, collections and jobs. Each event's ID
+// is "<epoch>:<seq>", and a reconnecting client that sends it back in the
+// Last-Event-ID header (or the last_event_id query parameter) gets the events
+// it missed replayed after a "hello" event, or a "resync" event when they are
+// no longer available.
+func (s *Server) GetEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+	// Event streams outlive any server write timeout.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	sub := s.hub.newSubscriber(auth.UserFrom(r.Context()))
+	if topics := r.URL.Query().Get("topics"); topics != "" {
+		sub.Unfollow(DefaultTopics...)
+		if err := sub.Follow(strings.Split(topics, ",")...); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		sub.Follow(TopicJobs)
+	}
+	s.hub.join(sub, resumeFrom(r))
+	defer s.hub.Unsubscribe(sub)
+	s.trackClient("sse", 1)
+	defer s.trackClient("sse", -1)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Disable proxy buffering in nginx.
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	epoch, _ := s.hub.Position()
+
+	ticker := time.NewTicker(sseKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case <-sub.Notify():
+			messages, ok := sub.Drain()
+			if !ok {
+				return
+			}
+			for _, data := range messages {
+				var msg struct {
+					Type    string          `json:"type"`
+					Seq     uint64          `json:"seq"`
+					Payload json.RawMessage `json:"payload"`
+				}
+				if err := json.Unmarshal(data, &msg); err != nil {
+					continue
+				}
+				id := ""
+				if msg.Seq > 0 {
+					id = fmt.Sprintf("%s:%d", epoch, msg.Seq)
+				} else if msg.Type == "resync" {
+					// Resume from the position the client reloads its state at.
+					var pos HelloPayload
+					if json.Unmarshal(msg.Payload, &pos) == nil {
+						id = fmt.Sprintf("%s:%d", pos.Epoch, pos.Seq)
+					}
+				}
+				if err := writeSSE(w, msg.Type, id, msg.Payload); err != nil {
+					return
+				}
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeSSE writes one event. JSON never contains raw newlines, so the payload
+// fits on a single data line.
+func writeSSE(w http.ResponseWriter, event, id string, payload interface{}) error {
+	data, ok := payload.(json.RawMessage)
+	if !ok {
+		var err error
+		if data, err = json.Marshal(payload); err != nil {
+			return err
+		}
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(w, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, data)
+	return err
+}
+
+// resumeFrom returns the position a reconnecting client resumes from, given
+// as an "<epoch>:<seq>" event ID in the Last-Event-ID header or the
+// last_event_id query parameter. It returns nil when the client gives none,
+// and an empty position, which is never replayed, when the ID is invalid.
+func resumeFrom(r *http.Request) *ResumePayload {
+	id := r.Header.Get("Last-Event-ID")
+	if id == "" {
+		id = r.URL.Query().Get("last_event_id")
+	}
+	if id == "" {
+		return nil
+	}
+	epoch, seq, err := parseEventID(id)
+	if err != nil {
+		return &ResumePayload{}
+	}
+	return &ResumePayload{Epoch: epoch, LastSeq: seq}
+}
+
+// parseEventID splits an "<epoch>:<seq>" event ID.
+func parseEventID(id string) (string, uint64, error) {
+	epoch, seq, ok := strings.Cut(id, ":")
+	if !ok {
+		return "", 0, fmt.Errorf("invalid event ID %q", id)
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid event ID %q: %w", id, err)
+	}
+	return epoch, n, nil
+}
+
+// Extract starts an extraction job over plain HTTP and returns its ID at once.
+// Progress is published as "job" events, which GET /api/events streams.
+func (s *Server) Extract(w http.ResponseWriter, r *http.Request) {
+	var req ExtractRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, s.limits.MaxMessageSize)).Decode(&req); err != nil {
+		http.Error(w, "Invalid extraction request", http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "Missing url", http.StatusBadRequest)
+		return
+	}
+	extractor := s.sakuraExtractor
+	switch req.Source {
+	case "", "SakuraFM":
+		req.Source = "SakuraFM"
+	case "JanitorAI":
+		extractor = s.janitorExtractor
+	default:
+		http.Error(w, fmt.Sprintf("Unknown source %q", req.Source), http.StatusBadRequest)
+		return
+	}
+
+	user := auth.UserFrom(r.Context())
+	// The job outlives the request, but keeps its correlation ID.
+	ctx := context.WithoutCancel(r.Context())
+	release, rejected := s.admitExtraction(ctx, s.client(clientKey(r)))
+	if rejected != nil {
+		if rejected.shutdown {
+			http.Error(w, rejected.message, http.StatusServiceUnavailable)
+		} else {
+			rateLimited(w, rejected.message, rejected.wait)
+		}
+		return
+	}
+	job := &JobPayload{ID: newJobID(), Source: req.Source, URL: req.URL, Status: "queued"}
+	go func() {
+		defer release()
+		s.runExtraction(ctx, user, job, extractor, nil)
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	if err := json.NewEncoder(w).Encode(job); err != nil {
+		slog.Error("Failed to encode response", "error", err)
+	}
+}
+
+// rateLimited writes a 429 response with the same status payload WebSocket clients get.
+func rateLimited(w http.ResponseWriter, message string, wait time.Duration) {
+	retryAfter := int(wait.Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(StatusPayload{Status: "rate_limited", Message: message, RetryAfter: retryAfter})
+}
@@ -0,0 +1,50 @@
+package web
+
+import (
+	"charex/internal/export"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// GetExport streams a zip of the selected cards. The archive is written as it is
+// generated, so errors after the first byte can only be logged.
+func (s *Server) GetExport(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	opts := export.Options{
+		Source:     q.Get("source"),
+		Tag:        q.Get("tag"),
+		Collection: q.Get("collection"),
+		Format:     q.Get("format"),
+		UserTags:   q.Get("user_tags") == "1" || q.Get("user_tags") == "true",
+	}
+	if opts.Format == "" {
+		opts.Format = export.FormatPNG
+	}
+	if err := export.ValidateFormat(opts.Format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	library := s.libraryFor(r)
+	if opts.Source != "" {
+		if err := library.CheckSource(opts.Source); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Large libraries take longer to stream than the server's write timeout allows.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	filename := fmt.Sprintf("charex-export-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+
+	manifest, err := export.WriteZip(w, library, opts)
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to export cards", "error", err)
+		return
+	}
+	slog.InfoContext(r.Context(), "Exported cards", "cards", len(manifest.Cards), "format", opts.Format)
+}
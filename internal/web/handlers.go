@@ -1,26 +1,79 @@
 package web
 
 import (
+	"charex/internal/auth"
 	"charex/internal/extractors"
+	"charex/internal/saver"
+	"log/slog"
 	"net/http"
+	"sync"
 )
 
 type Server struct {
 	hub              *Hub
 	DataDir          string
+	library          *saver.Library
 	sakuraExtractor  extractors.Extractor
 	janitorExtractor extractors.Extractor
+
+	limits        Limits
+	globalLimiter *rateLimiter
+	clientsMu     sync.Mutex
+	clients       map[string]*clientLimits // Limits of each client, by clientKey.
+
+	// Running extraction jobs, drained on shutdown.
+	jobsMu   sync.Mutex
+	jobs     sync.WaitGroup
+	draining bool
+
+	// userLibraries holds one library per user under DataDir/users/<user> when
+	// authentication is enabled.
+	librariesMu   sync.Mutex
+	userLibraries map[string]*saver.Library
+
+	metrics *serverMetrics
 }
 
 func NewServer(hub *Hub, dataDir string, sakura, janitor extractors.Extractor) *Server {
-	return &Server{
+	library := saver.NewLibrary(dataDir)
+	if err := library.MigrateLegacy(); err != nil {
+		slog.Error("Failed to migrate legacy cards", "error", err)
+	}
+	s := &Server{
 		hub:              hub,
 		DataDir:          dataDir,
+		library:          library,
 		sakuraExtractor:  sakura,
 		janitorExtractor: janitor,
+		userLibraries:    make(map[string]*saver.Library),
 	}
+	s.SetLimits(DefaultLimits())
+	s.initMetrics()
+	return s
 }
 
 func (s *Server) ServeWs(w http.ResponseWriter, r *http.Request) {
 	serveWs(s, w, r)
-}
\ No newline at end of file
+}
+
+// libraryFor returns the library of the request's user, or the shared library
+// when authentication is disabled.
+func (s *Server) libraryFor(r *http.Request) *saver.Library {
+	return s.userLibrary(auth.UserFrom(r.Context()))
+}
+
+// userLibrary returns the library stored under DataDir/users/<user>. The empty
+// user is the shared library at DataDir itself.
+func (s *Server) userLibrary(user string) *saver.Library {
+	if user == "" {
+		return s.library
+	}
+	s.librariesMu.Lock()
+	defer s.librariesMu.Unlock()
+	library, ok := s.userLibraries[user]
+	if !ok {
+		library = saver.NewLibrary(saver.UserRoot(s.DataDir, user))
+		s.userLibraries[user] = library
+	}
+	return library
+}
@@ -0,0 +1,482 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// historySize is the number of broadcast events kept for replay on resume.
+	historySize = 256
+
+	// queueSize is the number of events a subscriber may have waiting before
+	// further events are dropped and the subscriber is told to resync.
+	queueSize = 256
+
+	// directQueueSize is the number of direct replies a subscriber may have
+	// waiting. Replies cannot be dropped, so a client that keeps sending
+	// requests without reading the replies is disconnected instead.
+	directQueueSize = 64
+
+	// maxTopics is the number of topics a subscriber may follow.
+	maxTopics = 64
+)
+
+var (
+	// ErrTooManyTopics is returned when a subscriber would follow more than maxTopics topics.
+	ErrTooManyTopics = fmt.Errorf("at most %d topics may be followed", maxTopics)
+
+	errSubscriberClosed = errors.New("subscriber closed")
+)
+
+// Topics events are published on. Card events go to TopicCards and to the
+// topics of their source and card; extraction progress goes to TopicJobs and
+// the topic of the job.
+const (
+	TopicCards       = "cards"
+	TopicCollections = "collections"
+	TopicJobs        = "jobs"
+)
+
+// DefaultTopics are the topics a new subscriber starts with.
+var DefaultTopics = []string{TopicCards, TopicCollections}
+
+// SourceTopic is the topic of every card event of one source.
+func SourceTopic(source string) string { return "source:" + source }
+
+// CardTopic is the topic of every event about one card.
+func CardTopic(id string) string { return "card:" + id }
+
+// JobTopic is the topic of the progress events of one extraction job.
+func JobTopic(id string) string { return "job:" + id }
+
+// cardTopics returns the topics of an event about the given cards of a source.
+func cardTopics(source string, ids ...string) []string {
+	topics := []string{TopicCards, SourceTopic(source)}
+	for _, id := range ids {
+		topics = append(topics, CardTopic(id))
+	}
+	return topics
+}
+
+// Event is a message published to the subscribers of one user.
+type Event struct {
+	User   string   // Owner of the event; only their subscribers receive it.
+	Type   string   // Message type, e.g. "new_card".
+	Topics []string // Subscribers receive the event if they follow any of these.
+
+	// Key lets a newer event replace an older one still waiting in a slow
+	// subscriber's queue, e.g. successive updates of the same card. Empty keys
+	// never coalesce.
+	Key     string
+	Payload interface{}
+}
+
+// hubEvent is a sequenced event kept for replay.
+type hubEvent struct {
+	user   string
+	seq    uint64
+	topics []string
+	key    string
+	data   []byte
+}
+
+// HubStats describes the hub's subscribers and how well they keep up.
+type HubStats struct {
+	Subscribers   int    `json:"subscribers"`
+	Published     uint64 `json:"published"`
+	Coalesced     uint64 `json:"coalesced"`
+	Dropped       uint64 `json:"dropped"`
+	QueueDepth    int    `json:"queue_depth"`     // Events waiting across all subscribers.
+	MaxQueueDepth int    `json:"max_queue_depth"` // Events waiting for the slowest subscriber.
+}
+
+// Hub routes events to subscribers by user and topic. Publishing never blocks:
+// each subscriber has a bounded queue, and a subscriber that falls behind has
+// events coalesced or dropped rather than being disconnected.
+type Hub struct {
+	mutex       sync.Mutex
+	subscribers map[*Subscriber]bool
+	closed      bool
+
+	// epoch identifies this hub instance, so clients can tell that sequence
+	// numbers were reset by a server restart.
+	epoch   string
+	seq     uint64
+	history []hubEvent
+
+	coalesced uint64
+	dropped   uint64
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[*Subscriber]bool),
+		epoch:       strconv.FormatInt(time.Now().UnixNano(), 36),
+	}
+}
+
+// Position returns the hub epoch and the sequence number of the latest event.
+func (h *Hub) Position() (string, uint64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return h.epoch, h.seq
+}
+
+// Subscribe registers a subscriber for a user's events on the default topics.
+func (h *Hub) Subscribe(user string) *Subscriber {
+	sub := h.newSubscriber(user)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.addLocked(sub)
+	return sub
+}
+
+// newSubscriber returns an unregistered subscriber following the default
+// topics, so its topics can be changed before join.
+func (h *Hub) newSubscriber(user string) *Subscriber {
+	sub := &Subscriber{
+		hub:    h,
+		user:   user,
+		topics: make(map[string]bool),
+		notify: make(chan struct{}, 1),
+	}
+	sub.Follow(DefaultTopics...)
+	return sub
+}
+
+// join registers a subscriber and queues a "hello" message with the hub's
+// position for it. When resume is set, the events after it are queued behind
+// the greeting, or a "resync" message replaces the greeting when they can no
+// longer be replayed. Registration and replay happen under one lock, so no
+// live event can be queued twice or ahead of the replayed ones.
+func (h *Hub) join(sub *Subscriber, resume *ResumePayload) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if !h.addLocked(sub) {
+		return
+	}
+
+	greeting := "hello"
+	if resume != nil && !h.canReplayLocked(resume.Epoch, resume.LastSeq) {
+		greeting, resume = "resync", nil
+	}
+	data, err := json.Marshal(OutgoingMessage{Type: greeting, Payload: HelloPayload{Epoch: h.epoch, Seq: h.seq}})
+	if err != nil {
+		slog.Error("Failed to marshal greeting", "type", greeting, "error", err)
+		return
+	}
+	sub.Send(data)
+	if resume != nil {
+		h.replayLocked(sub, resume.LastSeq)
+	}
+}
+
+// addLocked registers a subscriber, or closes it if the hub is shutting down,
+// and reports whether it was registered. Callers hold h.mutex.
+func (h *Hub) addLocked(sub *Subscriber) bool {
+	if h.closed {
+		// Subscribers arriving during shutdown are closed at once.
+		sub.close()
+		return false
+	}
+	h.subscribers[sub] = true
+	return true
+}
+
+// Close disconnects every subscriber. Subscribers created afterwards start closed.
+func (h *Hub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	h.closed = true
+	for sub := range h.subscribers {
+		sub.close()
+		delete(h.subscribers, sub)
+	}
+}
+
+// Unsubscribe removes a subscriber and wakes its reader so it can exit.
+func (h *Hub) Unsubscribe(sub *Subscriber) {
+	h.mutex.Lock()
+	delete(h.subscribers, sub)
+	h.mutex.Unlock()
+	sub.close()
+}
+
+// Publish numbers an event, records it for replay and queues it for every
+// matching subscriber. Sequence numbers are shared by all users and topics, so
+// each subscriber sees only some of them; lost events are signalled by a
+// "resync" message rather than by a gap.
+func (h *Hub) Publish(e Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.seq++
+	data, err := json.Marshal(OutgoingMessage{Type: e.Type, Seq: h.seq, Payload: e.Payload})
+	if err != nil {
+		slog.Error("Failed to marshal event", "type", e.Type, "error", err)
+		return
+	}
+	event := hubEvent{user: e.User, seq: h.seq, topics: e.Topics, key: e.Key, data: data}
+	h.history = append(h.history, event)
+	if len(h.history) > historySize {
+		h.history = h.history[len(h.history)-historySize:]
+	}
+
+	for sub := range h.subscribers {
+		if sub.user == e.User && sub.wants(e.Topics) {
+			h.deliver(sub, event)
+		}
+	}
+}
+
+// deliver queues an event and counts what happened to it. Callers hold h.mutex.
+func (h *Hub) deliver(sub *Subscriber, event hubEvent) {
+	switch sub.enqueue(event.data, event.key, event.seq, true) {
+	case enqueueCoalesced:
+		h.coalesced++
+	case enqueueDropped:
+		h.dropped++
+	}
+}
+
+// canReplayLocked reports whether the events after lastSeq are still buffered.
+// They are not when too many events followed, or when they were sent by a
+// previous server instance, and the client has to reload its state instead.
+// Callers hold h.mutex.
+func (h *Hub) canReplayLocked(epoch string, lastSeq uint64) bool {
+	if epoch != h.epoch || lastSeq > h.seq {
+		return false
+	}
+	if len(h.history) > 0 && lastSeq+1 < h.history[0].seq {
+		return false
+	}
+	return len(h.history) > 0 || lastSeq == h.seq
+}
+
+// replayLocked queues the buffered events for a subscriber after lastSeq.
+// Callers hold h.mutex.
+func (h *Hub) replayLocked(sub *Subscriber, lastSeq uint64) {
+	for _, event := range h.history {
+		if event.seq > lastSeq && event.user == sub.user && sub.wants(event.topics) {
+			h.deliver(sub, event)
+		}
+	}
+}
+
+// Stats returns a snapshot of the hub's counters and queue depths.
+func (h *Hub) Stats() HubStats {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	stats := HubStats{
+		Subscribers: len(h.subscribers),
+		Published:   h.seq,
+		Coalesced:   h.coalesced,
+		Dropped:     h.dropped,
+	}
+	for sub := range h.subscribers {
+		depth := sub.depth()
+		stats.QueueDepth += depth
+		if depth > stats.MaxQueueDepth {
+			stats.MaxQueueDepth = depth
+		}
+	}
+	return stats
+}
+
+// GetHubStats reports subscriber counts and event queue depths.
+func (s *Server) GetHubStats(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, s.hub.Stats())
+}
+
+type enqueueResult int
+
+const (
+	enqueueAdded enqueueResult = iota
+	enqueueCoalesced
+	enqueueDropped
+)
+
+type queued struct {
+	key  string
+	data []byte
+}
+
+// Subscriber receives the events of one user on the topics it follows. Events
+// wait in a bounded queue until the subscriber's writer drains them.
+type Subscriber struct {
+	hub  *Hub
+	user string
+
+	mu      sync.Mutex
+	topics  map[string]bool
+	queue   []queued
+	direct  int    // Direct replies in queue.
+	lastSeq uint64 // Sequence number of the latest event queued for this subscriber.
+	dropped bool   // Events were dropped since the last drain.
+	closed  bool
+	notify  chan struct{}
+}
+
+// Follow adds topics to the subscription. "*" follows every topic. If that
+// would exceed maxTopics, no topic is added and ErrTooManyTopics is returned.
+func (s *Subscriber) Follow(topics ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	added := make(map[string]bool)
+	for _, t := range topics {
+		if t = strings.TrimSpace(t); t != "" && !s.topics[t] {
+			added[t] = true
+		}
+	}
+	if len(s.topics)+len(added) > maxTopics {
+		return ErrTooManyTopics
+	}
+	for t := range added {
+		s.topics[t] = true
+	}
+	return nil
+}
+
+// Unfollow removes topics from the subscription.
+func (s *Subscriber) Unfollow(topics ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, t := range topics {
+		delete(s.topics, strings.TrimSpace(t))
+	}
+}
+
+// Topics returns the followed topics.
+func (s *Subscriber) Topics() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	topics := make([]string, 0, len(s.topics))
+	for t := range s.topics {
+		topics = append(topics, t)
+	}
+	return topics
+}
+
+// Send queues a message addressed to this subscriber alone. Direct messages
+// are replies to the subscriber's own requests and are never dropped; when
+// directQueueSize of them are waiting the subscriber is closed instead, and
+// Send reports false.
+func (s *Subscriber) Send(data []byte) bool {
+	return s.enqueue(data, "", 0, false) != enqueueDropped
+}
+
+// Notify is signalled whenever the queue becomes non-empty or the subscriber closes.
+func (s *Subscriber) Notify() <-chan struct{} {
+	return s.notify
+}
+
+// Drain takes every queued message. When events were dropped it appends a
+// "resync" message so the client reloads its state. ok is false once the
+// subscriber is closed.
+func (s *Subscriber) Drain() (messages [][]byte, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return nil, false
+	}
+	for _, q := range s.queue {
+		messages = append(messages, q.data)
+	}
+	s.queue = s.queue[:0]
+	s.direct = 0
+	if s.dropped {
+		s.dropped = false
+		resync, err := json.Marshal(OutgoingMessage{Type: "resync", Payload: HelloPayload{Epoch: s.hub.epoch, Seq: s.lastSeq}})
+		if err == nil {
+			messages = append(messages, resync)
+		}
+	}
+	return messages, true
+}
+
+func (s *Subscriber) wants(topics []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(topics) == 0 || s.topics["*"] {
+		return true
+	}
+	for _, t := range topics {
+		if s.topics[t] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Subscriber) enqueue(data []byte, key string, seq uint64, droppable bool) enqueueResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed {
+		return enqueueDropped
+	}
+	if seq > s.lastSeq {
+		s.lastSeq = seq
+	}
+
+	result := enqueueAdded
+	if key != "" {
+		// Move a superseded event to the back rather than replacing it in place,
+		// so queued events stay in sequence order.
+		for i, q := range s.queue {
+			if q.key == key {
+				s.queue = append(s.queue[:i], s.queue[i+1:]...)
+				result = enqueueCoalesced
+				break
+			}
+		}
+	}
+	if droppable && result != enqueueCoalesced && len(s.queue)-s.direct >= queueSize {
+		s.dropped = true
+		return enqueueDropped
+	}
+	if !droppable {
+		if s.direct >= directQueueSize {
+			slog.Warn("Disconnecting subscriber that does not read its replies", "user", s.user, "queued", len(s.queue))
+			s.closeLocked()
+			return enqueueDropped
+		}
+		s.direct++
+	}
+	s.queue = append(s.queue, queued{key: key, data: data})
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+	return result
+}
+
+func (s *Subscriber) depth() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.queue)
+}
+
+func (s *Subscriber) close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closeLocked()
+}
+
+func (s *Subscriber) closeLocked() {
+	if !s.closed {
+		s.closed = true
+		close(s.notify)
+	}
+}
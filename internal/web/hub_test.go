@@ -0,0 +1,129 @@
+package web
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSubscriberDirectQueueLimit(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe("")
+	defer hub.Unsubscribe(sub)
+
+	for i := range directQueueSize {
+		if !sub.Send([]byte("reply")) {
+			t.Fatalf("Send %d refused before the limit", i)
+		}
+	}
+	// Broadcast events do not count against the limit on replies.
+	hub.Publish(Event{Type: "new_card", Topics: []string{TopicCards}})
+	if messages, ok := sub.Drain(); !ok || len(messages) != directQueueSize+1 {
+		t.Fatalf("Drain = %d messages, %v; want %d, true", len(messages), ok, directQueueSize+1)
+	}
+
+	for range directQueueSize {
+		sub.Send([]byte("reply"))
+	}
+	if sub.Send([]byte("reply")) {
+		t.Error("Send beyond the limit succeeded")
+	}
+	if _, ok := sub.Drain(); ok {
+		t.Error("subscriber still open after exceeding the reply limit")
+	}
+}
+
+func TestSubscriberFollowLimit(t *testing.T) {
+	hub := NewHub()
+	sub := hub.Subscribe("")
+	defer hub.Unsubscribe(sub)
+	sub.Unfollow(DefaultTopics...)
+
+	topics := make([]string, maxTopics)
+	for i := range topics {
+		topics[i] = fmt.Sprintf("card:%d", i)
+	}
+	if err := sub.Follow(topics...); err != nil {
+		t.Fatalf("Follow(%d topics): %v", len(topics), err)
+	}
+	// Topics already followed do not count twice.
+	if err := sub.Follow(topics[0], " "+topics[1]); err != nil {
+		t.Errorf("Follow of followed topics: %v", err)
+	}
+	if err := sub.Follow("card:extra"); !errors.Is(err, ErrTooManyTopics) {
+		t.Errorf("Follow beyond the limit: err = %v, want ErrTooManyTopics", err)
+	}
+	if got := len(sub.Topics()); got != maxTopics {
+		t.Errorf("following %d topics, want %d", got, maxTopics)
+	}
+}
+
+func TestJoinReplaysBeforeLiveEvents(t *testing.T) {
+	hub := NewHub()
+	for range 3 {
+		hub.Publish(Event{Type: "new_card", Topics: []string{TopicCards}})
+	}
+	epoch, _ := hub.Position()
+
+	tests := []struct {
+		name         string
+		resume       *ResumePayload
+		wantGreeting string
+		wantReplay   bool // Whether events 2 onwards are replayed.
+	}{
+		{"fresh", nil, "hello", false},
+		{"resumed", &ResumePayload{Epoch: epoch, LastSeq: 1}, "hello", true},
+		{"other epoch", &ResumePayload{Epoch: "old", LastSeq: 1}, "resync", false},
+		{"invalid ID", &ResumePayload{}, "resync", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub := hub.newSubscriber("")
+			_, before := hub.Position()
+			// Publish while joining: every event must arrive once, in order.
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for range 50 {
+					hub.Publish(Event{Type: "new_card", Topics: []string{TopicCards}})
+				}
+			}()
+			hub.join(sub, tt.resume)
+			<-done
+			defer hub.Unsubscribe(sub)
+			_, last := hub.Position()
+
+			messages, ok := sub.Drain()
+			if !ok || len(messages) == 0 {
+				t.Fatalf("Drain = %d messages, %v", len(messages), ok)
+			}
+			var greeting OutgoingMessage
+			if err := json.Unmarshal(messages[0], &greeting); err != nil || greeting.Type != tt.wantGreeting {
+				t.Fatalf("first message %s, want %s", messages[0], tt.wantGreeting)
+			}
+			var seqs []uint64
+			for _, data := range messages[1:] {
+				var msg OutgoingMessage
+				if err := json.Unmarshal(data, &msg); err != nil {
+					t.Fatal(err)
+				}
+				seqs = append(seqs, msg.Seq)
+			}
+			if tt.wantReplay && (len(seqs) == 0 || seqs[0] != 2) {
+				t.Fatalf("events %v, want a replay from 2", seqs)
+			}
+			if !tt.wantReplay && len(seqs) > 0 && seqs[0] <= before {
+				t.Fatalf("events %v, want none published before joining", seqs)
+			}
+			if len(seqs) > 0 && seqs[len(seqs)-1] != last {
+				t.Fatalf("events %v, want them to end at %d", seqs, last)
+			}
+			for i := 1; i < len(seqs); i++ {
+				if seqs[i] != seqs[i-1]+1 {
+					t.Fatalf("events %v are not in order without gaps or repeats", seqs)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,254 @@
+package web
+
+import (
+	"charex/internal/auth"
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limits bounds what a single WebSocket client, and all clients together, may ask of the server.
+type Limits struct {
+	// AllowedOrigins lists the origins (scheme://host[:port]) allowed to open a
+	// WebSocket. Empty means same-origin only; "*" allows every origin.
+	AllowedOrigins []string
+
+	// MaxMessageSize is the largest WebSocket frame accepted from a client, in bytes.
+	MaxMessageSize int64
+
+	// ClientRate and ClientBurst limit extraction requests per client, per minute.
+	ClientRate  float64
+	ClientBurst int
+
+	// GlobalRate and GlobalBurst limit extraction requests across all clients, per minute.
+	GlobalRate  float64
+	GlobalBurst int
+
+	// MaxClientExtractions caps the extractions one client may have running at once.
+	MaxClientExtractions int
+
+	// MaxClientConnections caps the WebSocket connections one client may have open at once.
+	MaxClientConnections int
+}
+
+// DefaultLimits returns the limits used unless configured otherwise.
+func DefaultLimits() Limits {
+	return Limits{
+		MaxMessageSize:       64 << 10,
+		ClientRate:           10,
+		ClientBurst:          5,
+		GlobalRate:           60,
+		GlobalBurst:          20,
+		MaxClientExtractions: 2,
+		MaxClientConnections: 8,
+	}
+}
+
+// SetLimits replaces the server's limits. It must be called before serving.
+func (s *Server) SetLimits(l Limits) {
+	s.limits = l
+	s.globalLimiter = newRateLimiter(l.GlobalRate, l.GlobalBurst)
+	s.clients = make(map[string]*clientLimits)
+}
+
+// maxClients bounds the number of idle clients whose limits are tracked.
+const maxClients = 10000
+
+// clientLimits holds the limits of one client, shared by its HTTP requests and
+// all of its WebSocket connections.
+type clientLimits struct {
+	limiter     *rateLimiter  // Extraction requests.
+	extractions chan struct{} // Semaphore bounding running extractions.
+	conns       int           // Open WebSocket connections, guarded by Server.clientsMu.
+}
+
+// clientKey identifies the client of a request: the user, or the remote
+// address when authentication is disabled.
+func clientKey(r *http.Request) string {
+	if user := auth.UserFrom(r.Context()); user != "" {
+		return user
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// client returns the limits of the client identified by key.
+func (s *Server) client(key string) *clientLimits {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	return s.clientLocked(key)
+}
+
+func (s *Server) clientLocked(key string) *clientLimits {
+	c, ok := s.clients[key]
+	if !ok {
+		if len(s.clients) >= maxClients {
+			// Forget idle clients rather than growing without bound.
+			for k, c := range s.clients {
+				if c.conns == 0 && len(c.extractions) == 0 {
+					delete(s.clients, k)
+				}
+			}
+		}
+		maxExtractions := s.limits.MaxClientExtractions
+		if maxExtractions < 1 {
+			maxExtractions = 1
+		}
+		c = &clientLimits{
+			limiter:     newRateLimiter(s.limits.ClientRate, s.limits.ClientBurst),
+			extractions: make(chan struct{}, maxExtractions),
+		}
+		s.clients[key] = c
+	}
+	return c
+}
+
+// connect counts a new WebSocket connection of a client. It reports false when
+// the client already has MaxClientConnections open.
+func (s *Server) connect(key string) (*clientLimits, bool) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	c := s.clientLocked(key)
+	if max := s.limits.MaxClientConnections; max > 0 && c.conns >= max {
+		return nil, false
+	}
+	c.conns++
+	return c, true
+}
+
+// disconnect releases a connection counted by connect.
+func (s *Server) disconnect(c *clientLimits) {
+	s.clientsMu.Lock()
+	defer s.clientsMu.Unlock()
+	c.conns--
+}
+
+// rejection tells a client why its extraction request was turned away.
+type rejection struct {
+	reason   string // Label of the rejections metric.
+	message  string
+	wait     time.Duration // When to retry.
+	shutdown bool          // The server is shutting down rather than rate limiting.
+}
+
+// admitExtraction checks an extraction request of client c against the limits.
+// If it is admitted, the caller must call release once the extraction ends;
+// otherwise nothing is held and rejected says why.
+func (s *Server) admitExtraction(ctx context.Context, c *clientLimits) (release func(), rejected *rejection) {
+	// 1. Per-client rate.
+	if ok, wait := c.limiter.allow(); !ok {
+		return nil, s.reject(rejection{reason: "client_rate", message: "Too many extraction requests, please slow down.", wait: wait})
+	}
+	// 2. Per-client concurrency.
+	select {
+	case c.extractions <- struct{}{}:
+	default:
+		c.limiter.refund()
+		return nil, s.reject(rejection{reason: "client_concurrency", message: fmt.Sprintf("At most %d extractions may run at once.", cap(c.extractions)), wait: time.Second})
+	}
+	// 3. Server-wide rate.
+	if ok, wait := s.globalLimiter.allow(); !ok {
+		<-c.extractions
+		c.limiter.refund()
+		slog.WarnContext(ctx, "Global extraction rate limit reached")
+		return nil, s.reject(rejection{reason: "global_rate", message: "The server is busy, please try again shortly.", wait: wait})
+	}
+	// 4. Shutdown.
+	if !s.startJob() {
+		<-c.extractions
+		c.limiter.refund()
+		s.globalLimiter.refund()
+		return nil, s.reject(rejection{reason: "shutting_down", message: "The server is shutting down, please try again shortly.", shutdown: true})
+	}
+	return func() {
+		<-c.extractions
+		s.finishJob()
+	}, nil
+}
+
+func (s *Server) reject(r rejection) *rejection {
+	s.metrics.rejections.Inc(r.reason)
+	return &r
+}
+
+// checkOrigin accepts requests without an Origin header (non-browser clients),
+// same-origin requests and the configured allowed origins.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range s.limits.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(strings.TrimRight(allowed, "/"), origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per minute, holding at
+// most burst tokens. A nil limiter or a non-positive rate allows everything.
+type rateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // Tokens per second.
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(perMinute float64, burst int) *rateLimiter {
+	if perMinute <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	return &rateLimiter{rate: perMinute / 60, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token if one is available. Otherwise it reports how long until
+// the next token.
+func (l *rateLimiter) allow() (bool, time.Duration) {
+	if l == nil {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+	if l.tokens >= 1 {
+		l.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+}
+
+// refund returns a token taken by allow, for requests rejected by a later limit.
+func (l *rateLimiter) refund() {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.tokens+1 <= l.burst {
+		l.tokens++
+	}
+}
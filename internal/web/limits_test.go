@@ -0,0 +1,124 @@
+package web
+
+import (
+	"charex/internal/auth"
+	"charex/internal/core"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestClientKey(t *testing.T) {
+	r := httptest.NewRequest("GET", "/ws", nil)
+	r.RemoteAddr = "192.0.2.1:1234"
+	if got := clientKey(r); got != "192.0.2.1" {
+		t.Errorf("clientKey without user = %q, want the remote address", got)
+	}
+	// Connections from other ports of the same address are the same client.
+	r.RemoteAddr = "192.0.2.1:5678"
+	if got := clientKey(r); got != "192.0.2.1" {
+		t.Errorf("clientKey from another port = %q", got)
+	}
+	r = r.WithContext(auth.WithUser(r.Context(), "alice"))
+	if got := clientKey(r); got != "alice" {
+		t.Errorf("clientKey with user = %q, want alice", got)
+	}
+}
+
+func TestClientConnections(t *testing.T) {
+	s := NewServer(NewHub(), t.TempDir(), nil, nil)
+	limits := DefaultLimits()
+	limits.ClientBurst = 1
+	limits.MaxClientConnections = 2
+	s.SetLimits(limits)
+
+	a, ok := s.connect("alice")
+	if !ok {
+		t.Fatal("first connection refused")
+	}
+	b, ok := s.connect("alice")
+	if !ok {
+		t.Fatal("second connection refused")
+	}
+	if a != b {
+		t.Error("connections of one client do not share their limits")
+	}
+	if _, ok := s.connect("alice"); ok {
+		t.Error("connection beyond the limit accepted")
+	}
+	if _, ok := s.connect("bob"); !ok {
+		t.Error("another client's connection refused")
+	}
+	s.disconnect(a)
+	if _, ok := s.connect("alice"); !ok {
+		t.Error("connection refused after another one closed")
+	}
+
+	// The burst is spent across connections, not per connection.
+	if ok, _ := a.limiter.allow(); !ok {
+		t.Fatal("first extraction refused")
+	}
+	if ok, _ := b.limiter.allow(); ok {
+		t.Error("second connection got a fresh rate limit")
+	}
+	if ok, _ := s.client("alice").limiter.allow(); ok {
+		t.Error("HTTP requests got a fresh rate limit")
+	}
+}
+
+// blockingExtractor fails every extraction once release is closed.
+type blockingExtractor struct{ release chan struct{} }
+
+func (e blockingExtractor) Extract(ctx context.Context, input []byte) (*core.TavernCardV2, []byte, []byte, error) {
+	<-e.release
+	return nil, nil, nil, errors.New("test extractor")
+}
+
+func TestExtractLimits(t *testing.T) {
+	extractor := blockingExtractor{release: make(chan struct{})}
+	s := NewServer(NewHub(), t.TempDir(), extractor, extractor)
+	limits := DefaultLimits()
+	limits.ClientRate, limits.ClientBurst = 600, 10
+	limits.GlobalRate, limits.GlobalBurst = 0.001, limits.MaxClientExtractions+1
+	s.SetLimits(limits)
+	defer func() {
+		close(extractor.release)
+		s.Shutdown(context.Background())
+	}()
+	post := func() int {
+		r := httptest.NewRequest("POST", "/api/extract", strings.NewReader(`{"url":"https://www.sakura.fm/chat/mira"}`))
+		r.RemoteAddr = "192.0.2.1:1234"
+		w := httptest.NewRecorder()
+		s.Extract(w, r)
+		return w.Code
+	}
+
+	for i := range limits.MaxClientExtractions {
+		if code := post(); code != http.StatusAccepted {
+			t.Fatalf("extraction %d: status %d, want %d", i+1, code, http.StatusAccepted)
+		}
+	}
+	// The REST endpoint shares the running extractions limit with WebSockets.
+	if code := post(); code != http.StatusTooManyRequests {
+		t.Errorf("extraction beyond the concurrency limit: status %d, want %d", code, http.StatusTooManyRequests)
+	}
+	if _, rejected := s.admitExtraction(context.Background(), s.client("192.0.2.1")); rejected == nil || rejected.reason != "client_concurrency" {
+		t.Errorf("WebSocket extraction beyond the concurrency limit: rejected = %+v", rejected)
+	}
+
+	// A request turned away by the server-wide rate keeps the client's token.
+	other := s.client("192.0.2.2")
+	release, rejected := s.admitExtraction(context.Background(), other)
+	if rejected != nil {
+		t.Fatalf("first extraction of another client rejected: %+v", rejected)
+	}
+	release()
+	for range limits.ClientBurst {
+		if _, rejected := s.admitExtraction(context.Background(), other); rejected == nil || rejected.reason != "global_rate" {
+			t.Fatalf("extraction beyond the global rate: rejected = %+v, want global_rate", rejected)
+		}
+	}
+}
@@ -1,7 +1,6 @@
 package web
 
 import (
-	"charex/internal/core"
 	"encoding/json"
 )
 
@@ -17,19 +16,70 @@ type ExtractURLPayload struct {
 }
 
 // OutgoingMessage is a generic structure for messages sent from the server to the client.
+//
+// Broadcasts carry a Seq that increases with every event the hub publishes,
+// for any user and topic. A client only receives the events of its user and
+// topics, so gaps between the sequence numbers it sees are normal and do not
+// mean events were lost. When events it should have received are lost, the
+// server tells it with a "resync" message instead.
 type OutgoingMessage struct {
 	Type    string      `json:"type"`
+	Seq     uint64      `json:"seq,omitempty"` // Set on broadcasts, see below.
 	Payload interface{} `json:"payload"`
 }
 
+// ResumePayload is the position a reconnecting client resumes from; the
+// broadcasts after LastSeq are replayed to it.
+type ResumePayload struct {
+	Epoch   string `json:"epoch"`
+	LastSeq uint64 `json:"last_seq"`
+}
+
+// HelloPayload tells a client the hub's current position. It is sent on connect,
+// and as a "resync" message when missed events can no longer be replayed.
+type HelloPayload struct {
+	Epoch string `json:"epoch"`
+	Seq   uint64 `json:"seq"`
+}
+
 // StatusPayload is used for sending status updates to the originating client.
 type StatusPayload struct {
-	Status  string `json:"status"` // e.g., "started", "completed", "error"
+	Status     string `json:"status"` // e.g., "started", "completed", "error", "rate_limited"
+	Message    string `json:"message"`
+	RetryAfter int    `json:"retry_after,omitempty"` // Seconds to wait before retrying, for "rate_limited".
+	JobID      string `json:"job_id,omitempty"`      // The extraction job the status belongs to.
+}
+
+// JobPayload is published on a job's topics as an extraction progresses.
+type JobPayload struct {
+	ID      string `json:"id"`
+	Source  string `json:"source"`
+	URL     string `json:"url"`
+	Status  string `json:"status"` // "started", "completed" or "error".
 	Message string `json:"message"`
+	CardID  string `json:"card_id,omitempty"` // Set once the card is saved.
+}
+
+// TopicsPayload lists topics to follow or unfollow, and the resulting subscription.
+type TopicsPayload struct {
+	Topics []string `json:"topics"`
 }
 
 // NewCardPayload is used for broadcasting a newly created card to all clients.
 type NewCardPayload struct {
-	Source string             `json:"source"` // e.g., "sakura", "janitor"
-	Card   core.TavernCardV2  `json:"card"`
-}
\ No newline at end of file
+	Source string      `json:"source"` // e.g., "sakura", "janitor"
+	Card   LibraryCard `json:"card"`
+}
+
+// CardsMergedPayload is broadcast when one card has been merged into another.
+type CardsMergedPayload struct {
+	Source   string      `json:"source"`
+	Card     LibraryCard `json:"card"`      // The surviving, merged card.
+	MergedID string      `json:"merged_id"` // The card that was removed.
+}
+
+// CardDeletedPayload is broadcast when a card has been removed from the library.
+type CardDeletedPayload struct {
+	Source string `json:"source"`
+	ID     string `json:"id"`
+}
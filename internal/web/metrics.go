@@ -0,0 +1,177 @@
+package web
+
+import (
+	"charex/internal/metrics"
+	"charex/internal/saver"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+)
+
+// storageUsageTTL bounds how often a scrape walks the data directory.
+const storageUsageTTL = 30 * time.Second
+
+// serverMetrics are the instruments updated as the server works.
+type serverMetrics struct {
+	registry          *metrics.Registry
+	extractions       *metrics.CounterVec
+	extractionSeconds *metrics.HistogramVec
+	rejections        *metrics.CounterVec
+
+	mu         sync.Mutex
+	wsClients  int
+	sseClients int
+
+	usageMu   sync.Mutex
+	usage     *saver.Usage
+	usageTime time.Time
+}
+
+// initMetrics registers the server's metrics.
+func (s *Server) initMetrics() {
+	r := metrics.NewRegistry()
+	m := &serverMetrics{registry: r}
+	m.extractions = r.Counter("charex_extractions_total",
+		"Extractions by source and outcome (success, extract_error, save_error).", "source", "outcome")
+	m.extractionSeconds = r.Histogram("charex_extraction_duration_seconds",
+		"Time taken to fetch, convert and save a card.", metrics.DefaultBuckets, "source", "outcome")
+	m.rejections = r.Counter("charex_extractions_rejected_total",
+		"Extraction requests rejected before starting, by reason.", "reason")
+
+	r.GaugeFunc("charex_clients", "Connected clients by transport.", func() []metrics.Sample {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		return []metrics.Sample{
+			{LabelValues: []string{"websocket"}, Value: float64(m.wsClients)},
+			{LabelValues: []string{"sse"}, Value: float64(m.sseClients)},
+		}
+	}, "transport")
+	r.GaugeFunc("charex_hub_subscribers", "Subscribers of the event hub.", func() []metrics.Sample {
+		return metrics.Value(float64(s.hub.Stats().Subscribers))
+	})
+	r.CounterFunc("charex_hub_published_total", "Events published since the hub started.", func() []metrics.Sample {
+		return metrics.Value(float64(s.hub.Stats().Published))
+	})
+	r.CounterFunc("charex_hub_coalesced_total", "Queued events replaced by a newer event for the same key.", func() []metrics.Sample {
+		return metrics.Value(float64(s.hub.Stats().Coalesced))
+	})
+	r.CounterFunc("charex_hub_dropped_total", "Events dropped because a subscriber's queue was full.", func() []metrics.Sample {
+		return metrics.Value(float64(s.hub.Stats().Dropped))
+	})
+	r.GaugeFunc("charex_hub_queue_depth", "Events waiting across all subscribers.", func() []metrics.Sample {
+		return metrics.Value(float64(s.hub.Stats().QueueDepth))
+	})
+	r.GaugeFunc("charex_hub_max_queue_depth", "Events waiting for the slowest subscriber.", func() []metrics.Sample {
+		return metrics.Value(float64(s.hub.Stats().MaxQueueDepth))
+	})
+	r.GaugeFunc("charex_storage_cards", "Cards stored, by source, across all libraries.", func() []metrics.Sample {
+		usage := s.storageUsage()
+		if usage == nil {
+			return nil
+		}
+		sources := make([]string, 0, len(usage.Cards))
+		for source := range usage.Cards {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+		samples := make([]metrics.Sample, 0, len(sources))
+		for _, source := range sources {
+			samples = append(samples, metrics.Sample{LabelValues: []string{source}, Value: float64(usage.Cards[source])})
+		}
+		return samples
+	}, "source")
+	r.GaugeFunc("charex_storage_bytes", "Bytes stored in the data directory.", func() []metrics.Sample {
+		usage := s.storageUsage()
+		if usage == nil {
+			return nil
+		}
+		return metrics.Value(float64(usage.Bytes))
+	})
+
+	s.metrics = m
+}
+
+// storageUsage measures the data directory, reusing a recent measurement.
+func (s *Server) storageUsage() *saver.Usage {
+	m := s.metrics
+	m.usageMu.Lock()
+	defer m.usageMu.Unlock()
+	if m.usage != nil && time.Since(m.usageTime) < storageUsageTTL {
+		return m.usage
+	}
+	usage, err := saver.DiskUsage(s.DataDir)
+	if err != nil {
+		slog.Error("Failed to measure storage", "error", err)
+		return m.usage
+	}
+	m.usage, m.usageTime = usage, time.Now()
+	return usage
+}
+
+// observeExtraction records the outcome of an extraction that started at start.
+func (s *Server) observeExtraction(source, outcome string, start time.Time) {
+	s.metrics.extractions.Inc(source, outcome)
+	s.metrics.extractionSeconds.Observe(time.Since(start).Seconds(), source, outcome)
+}
+
+// trackClient adjusts the connected client count of a transport by delta.
+func (s *Server) trackClient(transport string, delta int) {
+	s.metrics.mu.Lock()
+	defer s.metrics.mu.Unlock()
+	switch transport {
+	case "websocket":
+		s.metrics.wsClients += delta
+	case "sse":
+		s.metrics.sseClients += delta
+	}
+}
+
+// GetMetrics serves the metrics in the Prometheus text format.
+func (s *Server) GetMetrics(w http.ResponseWriter, r *http.Request) {
+	s.metrics.registry.ServeHTTP(w, r)
+}
+
+// Healthz reports whether the server can store cards.
+func (s *Server) Healthz(w http.ResponseWriter, r *http.Request) {
+	if err := s.checkDataDir(); err != nil {
+		slog.WarnContext(r.Context(), "Health check failed", "error", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	fmt.Fprintln(w, "ok")
+}
+
+// Readyz reports whether the server accepts new work: it fails once shutdown
+// has begun, so load balancers stop routing requests here.
+func (s *Server) Readyz(w http.ResponseWriter, r *http.Request) {
+	s.jobsMu.Lock()
+	draining := s.draining
+	s.jobsMu.Unlock()
+	if draining {
+		http.Error(w, "shutting down", http.StatusServiceUnavailable)
+		return
+	}
+	s.Healthz(w, r)
+}
+
+// checkDataDir verifies that the data directory exists and is writable.
+func (s *Server) checkDataDir() error {
+	if err := os.MkdirAll(s.DataDir, 0755); err != nil {
+		return fmt.Errorf("data directory unavailable: %w", err)
+	}
+	f, err := os.CreateTemp(s.DataDir, ".healthcheck-*")
+	if err != nil {
+		return fmt.Errorf("data directory not writable: %w", err)
+	}
+	name := f.Name()
+	f.Close()
+	if err := os.Remove(name); err != nil {
+		return fmt.Errorf("failed to remove health check file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,174 @@
+package web
+
+import (
+	"charex/internal/auth"
+	"charex/internal/config"
+	"charex/internal/extractors"
+	"charex/internal/logging"
+	"charex/internal/saver"
+	webui "charex/web"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+)
+
+// Run serves charex-web as configured until ctx is cancelled, then shuts down
+// gracefully. It is shared by charex-web and "charex serve".
+func Run(ctx context.Context, cfg *config.Config) error {
+	hub := NewHub()
+
+	// Instantiate the extractors.
+	sakuraExtractor := extractors.NewSakuraFMExtractor(cfg.ExtractorOptions())
+	janitorExtractor := extractors.NewJanitorAIExtractor(cfg.ExtractorOptions())
+
+	server := NewServer(hub, cfg.Storage.DataDir, sakuraExtractor, janitorExtractor)
+
+	// WebSocket limits. An empty origin list allows same-origin requests only.
+	server.SetLimits(Limits{
+		AllowedOrigins:       cfg.Server.AllowedOrigins,
+		MaxMessageSize:       cfg.Server.MaxMessageSize,
+		ClientRate:           cfg.Server.ExtractRateClient,
+		ClientBurst:          cfg.Server.ExtractBurstClient,
+		GlobalRate:           cfg.Server.ExtractRateGlobal,
+		GlobalBurst:          cfg.Server.ExtractBurstGlobal,
+		MaxClientExtractions: cfg.Server.MaxClientExtractions,
+		MaxClientConnections: cfg.Server.MaxClientConnections,
+	})
+
+	mux := http.NewServeMux()
+	server.routes(mux)
+	if cfg.Server.StaticDir != "" {
+		slog.Info("Serving the web UI from disk", "dir", cfg.Server.StaticDir)
+		mux.Handle("/", DevStaticHandler(cfg.Server.StaticDir))
+	} else {
+		static, err := NewStaticHandler(webui.Static())
+		if err != nil {
+			return fmt.Errorf("failed to load the web UI: %w", err)
+		}
+		mux.Handle("/", static)
+	}
+
+	// Authentication is optional: it is enabled by pointing auth.users_file at a users
+	// file managed with "charex user". Each user then gets a library under <data_dir>/users/<user>.
+	var handler http.Handler = mux
+	if authFile := cfg.Auth.UsersFile; authFile != "" {
+		store, err := auth.LoadStore(authFile)
+		if err != nil {
+			return fmt.Errorf("failed to load users: %w", err)
+		}
+		if len(store.Names()) == 0 {
+			return fmt.Errorf("no users in %s; add one with 'charex user add --file=%s <name>'", authFile, authFile)
+		}
+		for _, user := range store.Names() {
+			if err := saver.MigrateUserLibrary(cfg.Storage.DataDir, user); err != nil {
+				return err
+			}
+		}
+		if cfg.Watch.Dir != "" && !slices.Contains(store.Names(), cfg.Watch.User) {
+			return fmt.Errorf("watch.user must name a user of %s when watching a folder with authentication enabled", authFile)
+		}
+		authenticator := auth.NewAuthenticator(store)
+		mux.HandleFunc("POST /api/login", authenticator.Login)
+		mux.HandleFunc("POST /api/logout", authenticator.Logout)
+		handler = authenticator.Middleware(handler)
+		slog.Info("Authentication enabled", "users", len(store.Names()))
+	}
+	handler = logging.Middleware(handler)
+
+	// The watch folder feeds the library of watch.user, or the shared library.
+	// It stops with ctx, before the libraries are flushed.
+	var watchDone <-chan struct{}
+	if cfg.Watch.Dir != "" {
+		user := cfg.Watch.User
+		if cfg.Auth.UsersFile == "" {
+			user = ""
+		}
+		var err error
+		watchDone, err = server.StartWatch(ctx, cfg.Watch.Dir, user, time.Duration(cfg.Watch.Settle), cfg.ExtractorOptions())
+		if err != nil {
+			return err
+		}
+	}
+
+	// Timeouts guard against slow clients holding connections open. Long-lived
+	// responses (event streams, exports) lift the write deadline themselves.
+	port := cfg.Server.Port
+	httpServer := &http.Server{
+		Addr:              ":" + port,
+		Handler:           handler,
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	}
+	shutdownTimeout := time.Duration(cfg.Server.ShutdownTimeout)
+
+	errs := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", port)
+		errs <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return fmt.Errorf("could not listen on port %s: %w", port, err)
+	case <-ctx.Done():
+	}
+
+	// 1. Stop accepting extractions and let running ones finish.
+	// 2. Close WebSocket and event stream clients.
+	// 3. Stop the HTTP server, then flush the libraries to disk.
+	slog.Info("Shutting down", "timeout", shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to drain extractions", "error", err)
+	}
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Failed to shut down HTTP server", "error", err)
+	}
+	if err := <-errs; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("HTTP server failed", "error", err)
+	}
+	if watchDone != nil {
+		<-watchDone
+	}
+	if err := server.Sync(); err != nil {
+		slog.Error("Failed to flush libraries", "error", err)
+	}
+	slog.Info("Server stopped")
+	return nil
+}
+
+// routes registers the API, WebSocket and probe handlers on mux.
+func (s *Server) routes(mux *http.ServeMux) {
+	mux.HandleFunc("/ws", s.ServeWs)
+	mux.HandleFunc("GET /metrics", s.GetMetrics)
+	mux.HandleFunc("GET /healthz", s.Healthz)
+	mux.HandleFunc("GET /readyz", s.Readyz)
+	mux.HandleFunc("GET /api/me", auth.Me)
+	mux.HandleFunc("GET /api/hub", s.GetHubStats)
+	mux.HandleFunc("GET /api/events", s.GetEvents)
+	mux.HandleFunc("POST /api/extract", s.Extract)
+	mux.HandleFunc("/api/cards", s.GetCards)
+	mux.HandleFunc("POST /api/cards/merge", s.MergeCards)
+	mux.HandleFunc("GET /api/export", s.GetExport)
+	mux.HandleFunc("GET /api/tags", s.GetTags)
+	mux.HandleFunc("POST /api/tags", s.UpdateTags)
+	mux.HandleFunc("GET /api/collections", s.GetCollections)
+	mux.HandleFunc("PUT /api/collections/{name}", s.PutCollection)
+	mux.HandleFunc("POST /api/collections/{name}/cards", s.UpdateCollectionCards)
+	mux.HandleFunc("DELETE /api/collections/{name}", s.DeleteCollection)
+	mux.HandleFunc("GET /api/cards/{id}/versions", s.GetCardVersions)
+	mux.HandleFunc("GET /api/cards/{id}/diff", s.GetCardDiff)
+	mux.HandleFunc("PUT /api/cards/{id}", s.UpdateCard)
+	mux.HandleFunc("GET /api/cards/{source}/{id}", s.GetCard)
+	mux.HandleFunc("GET /api/cards/{source}/{id}/png", s.GetCardPNG)
+	mux.HandleFunc("GET /api/cards/{source}/{id}/json", s.GetCardJSON)
+	mux.HandleFunc("GET /api/cards/{source}/{id}/raw", s.GetCardRaw)
+	mux.HandleFunc("DELETE /api/cards/{source}/{id}", s.DeleteCard)
+}
@@ -0,0 +1,70 @@
+package web
+
+import (
+	"charex/internal/saver"
+	"context"
+	"fmt"
+	"log/slog"
+)
+
+// startJob registers a running extraction. It returns false once the server is
+// shutting down, in which case the job must not be started.
+func (s *Server) startJob() bool {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+	if s.draining {
+		return false
+	}
+	s.jobs.Add(1)
+	return true
+}
+
+// finishJob marks an extraction registered with startJob as done.
+func (s *Server) finishJob() {
+	s.jobs.Done()
+}
+
+// Shutdown stops accepting extraction jobs, waits for running ones to finish
+// or ctx to expire, and disconnects every WebSocket and event stream client.
+// Call it before shutting down the HTTP server, which otherwise waits on open
+// event streams, and call Sync afterwards.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.jobsMu.Lock()
+	s.draining = true
+	s.jobsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.jobs.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		slog.Info("All extraction jobs finished")
+	case <-ctx.Done():
+		err = fmt.Errorf("gave up waiting for extraction jobs: %w", ctx.Err())
+	}
+
+	s.hub.Close()
+	return err
+}
+
+// Sync flushes every library to disk.
+func (s *Server) Sync() error {
+	libraries := []*saver.Library{s.library}
+	s.librariesMu.Lock()
+	for _, l := range s.userLibraries {
+		libraries = append(libraries, l)
+	}
+	s.librariesMu.Unlock()
+
+	var firstErr error
+	for _, l := range libraries {
+		if err := l.Sync(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
@@ -0,0 +1,249 @@
+package web
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/brotli"
+)
+
+// staticAsset is a UI file held in memory with its precompressed variants.
+type staticAsset struct {
+	contentType string
+	hash        string // Hex prefix of the content's SHA-256, used in ETags and asset URLs.
+	plain       []byte
+	gzip        []byte // Nil when compression does not make the file smaller.
+	brotli      []byte
+}
+
+// StaticHandler serves the web UI from memory. Files are compressed once at
+// startup, and pages, scripts and stylesheets refer to the assets they load by
+// content hash so browsers can cache those indefinitely. Requests without the
+// current hash are always revalidated.
+type StaticHandler struct {
+	assets map[string]*staticAsset
+}
+
+// assetRefs match, by file extension, the references to other assets, with
+// the path as the submatch: script and stylesheet attributes in pages, script
+// and stylesheet string literals in scripts, and url() in stylesheets.
+var assetRefs = map[string]*regexp.Regexp{
+	".html": regexp.MustCompile(`(?:src|href)="([^":?#]+\.(?:js|css))"`),
+	".js":   regexp.MustCompile("['\"`]([^'\"`:?#\\s]+\\.(?:js|css))['\"`]"),
+	".css":  regexp.MustCompile(`url\(\s*['"]?([^'"():?#\s]+)['"]?\s*\)`),
+}
+
+// NewStaticHandler loads every file of fsys.
+func NewStaticHandler(fsys fs.FS) (*StaticHandler, error) {
+	h := &StaticHandler{assets: make(map[string]*staticAsset)}
+	contents := make(map[string][]byte)
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, p)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", p, err)
+		}
+		contents[p] = data
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load static assets: %w", err)
+	}
+
+	// 1. Point every file at the hashed URLs of the assets it references. A
+	// file is hashed only after its own references are rewritten, so a change
+	// to an asset changes the URL of everything that loads it.
+	hashes := make(map[string]string)
+	var resolve func(p string) string
+	resolve = func(p string) string {
+		if hash, ok := hashes[p]; ok {
+			return hash
+		}
+		if re, ok := assetRefs[path.Ext(p)]; ok {
+			hashes[p] = "" // A reference cycle leaves the inner reference unhashed.
+			contents[p] = rewriteAssetRefs(re, p, contents, resolve)
+		}
+		hashes[p] = contentHash(contents[p])
+		return hashes[p]
+	}
+	for p := range contents {
+		resolve(p)
+	}
+
+	// 2. Compress everything once.
+	for p, data := range contents {
+		asset := &staticAsset{
+			contentType: mime.TypeByExtension(path.Ext(p)),
+			hash:        contentHash(data),
+			plain:       data,
+		}
+		if asset.contentType == "" {
+			asset.contentType = http.DetectContentType(data)
+		}
+		if asset.gzip, err = compressGzip(data); err != nil {
+			return nil, fmt.Errorf("failed to compress %s: %w", p, err)
+		}
+		if asset.brotli, err = compressBrotli(data); err != nil {
+			return nil, fmt.Errorf("failed to compress %s: %w", p, err)
+		}
+		h.assets[p] = asset
+	}
+	return h, nil
+}
+
+func (h *StaticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "index.html"
+	}
+	asset, ok := h.assets[name]
+	if !ok {
+		if asset, ok = h.assets[path.Join(name, "index.html")]; !ok {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	header := w.Header()
+	header.Set("Content-Type", asset.contentType)
+	header.Set("Vary", "Accept-Encoding")
+	if v := r.URL.Query().Get("v"); v != "" && v == asset.hash {
+		// The URL names this exact content, so it never changes.
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "no-cache")
+	}
+
+	body, encoding := asset.plain, ""
+	switch {
+	case asset.brotli != nil && acceptsEncoding(r, "br"):
+		body, encoding = asset.brotli, "br"
+	case asset.gzip != nil && acceptsEncoding(r, "gzip"):
+		body, encoding = asset.gzip, "gzip"
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+		header.Set("ETag", fmt.Sprintf(`"%s-%s"`, asset.hash, encoding))
+	} else {
+		header.Set("ETag", fmt.Sprintf(`"%s"`, asset.hash))
+	}
+	http.ServeContent(w, r, name, time.Time{}, bytes.NewReader(body))
+}
+
+// rewriteAssetRefs returns the content of file p with "?v=<hash>" appended to
+// every reference re finds to another asset. Paths are relative to p's
+// directory unless they start with a slash; references to unknown files are
+// left alone.
+func rewriteAssetRefs(re *regexp.Regexp, p string, contents map[string][]byte, resolve func(string) string) []byte {
+	data := contents[p]
+	var out []byte
+	last := 0
+	for _, m := range re.FindAllSubmatchIndex(data, -1) {
+		start, end := m[2], m[3]
+		ref := string(data[start:end])
+		target := strings.TrimPrefix(ref, "/")
+		if !strings.HasPrefix(ref, "/") {
+			target = path.Join(path.Dir(p), ref)
+		}
+		if _, ok := contents[target]; !ok || target == p {
+			continue
+		}
+		hash := resolve(target)
+		if hash == "" {
+			continue
+		}
+		out = append(out, data[last:end]...)
+		out = append(out, "?v="+hash...)
+		last = end
+	}
+	if out == nil {
+		return data
+	}
+	return append(out, data[last:]...)
+}
+
+// DevStaticHandler serves the UI straight from dir without caching, so edits
+// show up on reload.
+func DevStaticHandler(dir string) http.Handler {
+	files := http.FileServer(http.Dir(dir))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+		files.ServeHTTP(w, r)
+	})
+}
+
+// acceptsEncoding reports whether the request's Accept-Encoding allows coding.
+func acceptsEncoding(r *http.Request, coding string) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), coding) {
+			continue
+		}
+		// An explicit quality of zero refuses the coding.
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// compressGzip returns the gzipped data, or nil when that is not smaller.
+func compressGzip(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := gzip.NewWriterLevel(&buf, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := zw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(data) {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
+
+// compressBrotli returns the brotli-compressed data, or nil when that is not smaller.
+func compressBrotli(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	bw := brotli.NewWriterLevel(&buf, brotli.BestCompression)
+	if _, err := bw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := bw.Close(); err != nil {
+		return nil, err
+	}
+	if buf.Len() >= len(data) {
+		return nil, nil
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,81 @@
+package web
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestStaticAssetHashes(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte(`<link rel="stylesheet" href="css/style.css"><script src="js/main.js"></script><a href="/api/export">Export</a>`)},
+		"js/main.js":     {Data: []byte(`loadScript('/js/editor.js'); window.location.href = '/login.html';`)},
+		"js/editor.js":   {Data: []byte(`console.log("editor");`)},
+		"css/style.css":  {Data: []byte(`body { background: url("../img/bg.png"); } .x { background: url(missing.png); }`)},
+		"img/bg.png":     {Data: []byte("png")},
+		"js/cycle-a.js":  {Data: []byte(`load('./cycle-b.js');`)},
+		"js/cycle-b.js":  {Data: []byte(`load('./cycle-a.js');`)},
+		"js/literals.js": {Data: []byte(`const re = /\.js$/;`)},
+	}
+	h, err := NewStaticHandler(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := func(url string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, url, nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: status %d", url, rec.Code)
+		}
+		return rec
+	}
+	hashed := regexp.MustCompile(`\?v=[0-9a-f]{16}`)
+
+	tests := []struct {
+		url      string
+		wantRefs []string // Substrings the body must contain, with hashes masked as ?v=H.
+	}{
+		{"/", []string{`href="css/style.css?v=H"`, `src="js/main.js?v=H"`, `href="/api/export"`}},
+		{"/js/main.js", []string{`'/js/editor.js?v=H'`, `'/login.html'`}},
+		{"/css/style.css", []string{`url("../img/bg.png?v=H")`, `url(missing.png)`}},
+		{"/js/cycle-a.js", []string{`'./cycle-b.js`}},
+		{"/js/literals.js", []string{`/\.js$/`}},
+	}
+	for _, tt := range tests {
+		body := hashed.ReplaceAllString(get(tt.url).Body.String(), "?v=H")
+		for _, want := range tt.wantRefs {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s = %s, want it to contain %s", tt.url, body, want)
+			}
+		}
+	}
+
+	// mainURL returns the query index.html loads main.js with.
+	mainURL := func() string {
+		page := get("/").Body.String()
+		return hashed.FindString(page[strings.Index(page, "js/main.js"):])
+	}
+
+	// Only URLs naming the current content are cached for good.
+	script := mainURL()
+	if got := get("/js/main.js" + script).Header().Get("Cache-Control"); !strings.Contains(got, "immutable") {
+		t.Errorf("hashed script Cache-Control = %q, want immutable", got)
+	}
+	for _, url := range []string{"/js/main.js", "/js/main.js?v=0123456789abcdef", "/"} {
+		if got := get(url).Header().Get("Cache-Control"); got != "no-cache" {
+			t.Errorf("GET %s Cache-Control = %q, want no-cache", url, got)
+		}
+	}
+
+	// A change to a script changes the URL of every file loading it.
+	fsys["js/editor.js"] = &fstest.MapFile{Data: []byte(`console.log("edited");`)}
+	if h, err = NewStaticHandler(fsys); err != nil {
+		t.Fatal(err)
+	}
+	if mainURL() == script {
+		t.Error("index.html loads main.js at the same URL after a script main.js loads changed")
+	}
+}
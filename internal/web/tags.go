@@ -0,0 +1,147 @@
+package web
+
+import (
+	"charex/internal/auth"
+	"charex/internal/saver"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+)
+
+// BulkTagRequest is the body of a POST /api/tags request.
+type BulkTagRequest struct {
+	IDs    []string `json:"ids"`
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// BulkTagResponse lists the cards whose tags were updated.
+type BulkTagResponse struct {
+	Updated []LibraryCard `json:"updated"`
+}
+
+// CollectionCardsRequest is the body of a POST /api/collections/{name}/cards request.
+type CollectionCardsRequest struct {
+	Add    []string `json:"add"`
+	Remove []string `json:"remove"`
+}
+
+// GetTags lists every tag with the number of cards carrying it.
+func (s *Server) GetTags(w http.ResponseWriter, r *http.Request) {
+	counts, err := s.libraryFor(r).TagCounts()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to count tags", "error", err)
+		http.Error(w, "Failed to count tags", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, counts)
+}
+
+// UpdateTags adds and removes user tags on many cards at once.
+func (s *Server) UpdateTags(w http.ResponseWriter, r *http.Request) {
+	var req BulkTagRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid tag request", http.StatusBadRequest)
+		return
+	}
+
+	library := s.libraryFor(r)
+	user := auth.UserFrom(r.Context())
+	response := BulkTagResponse{Updated: []LibraryCard{}}
+	for _, id := range req.IDs {
+		rec, err := library.Get(id)
+		if err != nil {
+			http.Error(w, "Card not found: "+id, http.StatusNotFound)
+			return
+		}
+		if err := library.SetUserTags(rec, req.Add, req.Remove); err != nil {
+			slog.ErrorContext(r.Context(), "Failed to tag card", "card", id, "error", err)
+			http.Error(w, "Failed to update tags", http.StatusInternalServerError)
+			return
+		}
+		card, err := library.LoadCard(rec)
+		if err != nil {
+			continue
+		}
+		updated := newLibraryCard(rec, card)
+		response.Updated = append(response.Updated, updated)
+		s.publishCardUpdated(user, updated)
+	}
+	writeJSON(w, response)
+}
+
+// GetCollections lists every collection.
+func (s *Server) GetCollections(w http.ResponseWriter, r *http.Request) {
+	collections, err := s.libraryFor(r).Collections()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to read collections", "error", err)
+		http.Error(w, "Failed to read collections", http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, collections)
+}
+
+// PutCollection creates or replaces a collection.
+func (s *Server) PutCollection(w http.ResponseWriter, r *http.Request) {
+	var c saver.Collection
+	if err := json.NewDecoder(r.Body).Decode(&c); err != nil {
+		http.Error(w, "Invalid collection", http.StatusBadRequest)
+		return
+	}
+	c.Name = r.PathValue("name")
+	if err := s.libraryFor(r).SaveCollection(&c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.publishCollections(r)
+	writeJSON(w, c)
+}
+
+// UpdateCollectionCards adds cards to and removes cards from a collection, creating it if needed.
+func (s *Server) UpdateCollectionCards(w http.ResponseWriter, r *http.Request) {
+	var req CollectionCardsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid collection request", http.StatusBadRequest)
+		return
+	}
+	c, err := s.libraryFor(r).UpdateCollection(r.PathValue("name"), req.Add, req.Remove)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.publishCollections(r)
+	writeJSON(w, c)
+}
+
+// DeleteCollection removes a collection without touching its cards.
+func (s *Server) DeleteCollection(w http.ResponseWriter, r *http.Request) {
+	err := s.libraryFor(r).DeleteCollection(r.PathValue("name"))
+	if errors.Is(err, saver.ErrCollectionNotFound) {
+		http.Error(w, "Collection not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to delete collection", "error", err)
+		http.Error(w, "Failed to delete collection", http.StatusInternalServerError)
+		return
+	}
+	s.publishCollections(r)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishCollections sends the current collections to the requesting user's clients.
+func (s *Server) publishCollections(r *http.Request) {
+	collections, err := s.libraryFor(r).Collections()
+	if err != nil {
+		slog.ErrorContext(r.Context(), "Failed to read collections", "error", err)
+		return
+	}
+	s.publish(Event{
+		User:    auth.UserFrom(r.Context()),
+		Type:    "collections_updated",
+		Topics:  []string{TopicCollections},
+		Key:     "collections_updated", // Only the latest list matters.
+		Payload: collections,
+	})
+}
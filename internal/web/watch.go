@@ -0,0 +1,40 @@
+package web
+
+import (
+	"charex/internal/extractors"
+	"charex/internal/watch"
+	"context"
+	"time"
+)
+
+// StartWatch ingests the files dropped into dir into user's library until ctx
+// is cancelled, publishing each new card to the user's clients as an
+// extraction would. The returned channel is closed once the watcher stops.
+func (s *Server) StartWatch(ctx context.Context, dir, user string, settle time.Duration, opts extractors.Options) (<-chan struct{}, error) {
+	w, err := watch.New(dir, s.userLibrary(user), opts)
+	if err != nil {
+		return nil, err
+	}
+	w.Settle = settle
+	w.OnResult = func(ctx context.Context, r watch.Result) {
+		if r.Record == nil {
+			return
+		}
+		s.publish(Event{
+			User:   user,
+			Type:   "new_card",
+			Topics: cardTopics(r.Source, r.Record.ID),
+			Payload: NewCardPayload{
+				Source: r.Source,
+				Card:   newLibraryCard(r.Record, r.Card),
+			},
+		})
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+	return done, nil
+}
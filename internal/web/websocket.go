@@ -1,108 +1,98 @@
 package web
 
 import (
+	"charex/internal/auth"
 	"charex/internal/extractors"
-	"charex/internal/saver"
+	"charex/internal/logging"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"net/http"
-	"sync"
+	"strings"
+	"time"
 
 	"github.com/gorilla/websocket"
 )
 
-var upgrader = websocket.Upgrader{
-	ReadBufferSize:  1024,
-	WriteBufferSize: 1024,
-	CheckOrigin: func(r *http.Request) bool {
-		return true // Allow all connections
-	},
-}
+const (
+	// writeWait is the time allowed to write a message to a client.
+	writeWait = 10 * time.Second
+
+	// pongWait is the time allowed to read the next pong from a client.
+	pongWait = 60 * time.Second
+
+	// pingPeriod must be shorter than pongWait so a healthy client never times out.
+	pingPeriod = pongWait * 9 / 10
+)
 
 type Client struct {
 	server *Server
-	hub    *Hub
 	conn   *websocket.Conn
-	send   chan []byte
+	sub    *Subscriber
+	user   string // The authenticated user, or "" when auth is disabled.
+
+	// ctx carries the correlation ID of the upgrade request; each message gets
+	// "<id>.<n>", so its logs can be traced back to the connection.
+	ctx      context.Context
+	messages int
+
+	limits *clientLimits // Shared with the client's other connections and HTTP requests.
 }
 
 func (c *Client) readPump() {
 	defer func() {
-		c.hub.unregister <- c
+		c.server.hub.Unsubscribe(c.sub)
+		c.server.disconnect(c.limits)
+		c.server.trackClient("websocket", -1)
 		c.conn.Close()
 	}()
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		return c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
 	for {
 		_, message, err := c.conn.ReadMessage()
 		if err != nil {
 			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
-				log.Printf("error: %v", err)
+				slog.WarnContext(c.ctx, "WebSocket closed unexpectedly", "error", err)
 			}
 			break
 		}
-		// Instead of broadcasting, we now handle the message.
-		go c.server.handleMessage(c, message)
+		c.messages++
+		ctx := logging.WithID(c.ctx, fmt.Sprintf("%s.%d", logging.ID(c.ctx), c.messages))
+		c.server.dispatch(ctx, c, message)
 	}
 }
 
 func (c *Client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
 	defer func() {
+		ticker.Stop()
 		c.conn.Close()
 	}()
 	for {
 		select {
-		case message, ok := <-c.send:
-			if !ok {
-				c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
 				return
 			}
-			c.conn.WriteMessage(websocket.TextMessage, message)
-		}
-	}
-}
-
-type Hub struct {
-	clients    map[*Client]bool
-	broadcast  chan []byte
-	register   chan *Client
-	unregister chan *Client
-	mutex      sync.Mutex
-}
-
-func NewHub() *Hub {
-	return &Hub{
-		broadcast:  make(chan []byte),
-		register:   make(chan *Client),
-		unregister: make(chan *Client),
-		clients:    make(map[*Client]bool),
-	}
-}
-
-func (h *Hub) Run() {
-	for {
-		select {
-		case client := <-h.register:
-			h.mutex.Lock()
-			h.clients[client] = true
-			h.mutex.Unlock()
-		case client := <-h.unregister:
-			h.mutex.Lock()
-			if _, ok := h.clients[client]; ok {
-				delete(h.clients, client)
-				close(client.send)
+		case <-c.sub.Notify():
+			messages, ok := c.sub.Drain()
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseGoingAway, "server closing connection"))
+				return
 			}
-			h.mutex.Unlock()
-		case message := <-h.broadcast:
-			h.mutex.Lock()
-			for client := range h.clients {
-				select {
-				case client.send <- message:
-				default:
-					close(client.send)
-					delete(h.clients, client)
+			for _, message := range messages {
+				if err := c.conn.WriteMessage(websocket.TextMessage, message); err != nil {
+					return
 				}
 			}
-			h.mutex.Unlock()
 		}
 	}
 }
@@ -113,7 +103,9 @@ func (c *Client) sendJSON(v interface{}) error {
 	if err != nil {
 		return fmt.Errorf("failed to marshal json: %w", err)
 	}
-	c.send <- msg
+	if !c.sub.Send(msg) {
+		return errSubscriberClosed
+	}
 	return nil
 }
 
@@ -128,75 +120,194 @@ func (c *Client) sendStatus(status, message string) {
 	})
 }
 
-// handleMessage is the central message processor.
-func (s *Server) handleMessage(c *Client, rawMessage []byte) {
+// sendRateLimited tells the client its request was rejected and when to retry.
+func (c *Client) sendRateLimited(message string, retryAfter time.Duration) {
+	c.sendJSON(OutgoingMessage{
+		Type: "status",
+		Payload: StatusPayload{
+			Status:     "rate_limited",
+			Message:    message,
+			RetryAfter: int(math.Ceil(retryAfter.Seconds())),
+		},
+	})
+}
+
+// dispatch runs on the client's read loop. Extraction requests are checked
+// against the rate limits before a goroutine is started for them, so a client
+// cannot queue up unbounded work.
+func (s *Server) dispatch(ctx context.Context, c *Client, rawMessage []byte) {
 	var msg WebSocketMessage
 	if err := json.Unmarshal(rawMessage, &msg); err != nil {
-		log.Printf("Error unmarshalling message: %v", err)
+		slog.WarnContext(ctx, "Invalid WebSocket message", "error", err)
 		c.sendStatus("error", "Invalid message format.")
 		return
 	}
 
+	var sourceName string
+	var extractor extractors.Extractor
 	switch msg.Type {
+	case "subscribe", "unsubscribe":
+		var topics TopicsPayload
+		if err := json.Unmarshal(msg.Payload, &topics); err != nil {
+			c.sendStatus("error", "Invalid payload for "+msg.Type+".")
+			return
+		}
+		if msg.Type == "subscribe" {
+			if err := c.sub.Follow(topics.Topics...); err != nil {
+				c.sendStatus("error", "Too many topics, "+err.Error()+".")
+				return
+			}
+		} else {
+			c.sub.Unfollow(topics.Topics...)
+		}
+		c.sendJSON(OutgoingMessage{Type: "subscribed", Payload: TopicsPayload{Topics: c.sub.Topics()}})
+		return
 	case "extract_sakura":
-		s.handleExtraction(c, msg.Payload, "SakuraFM", s.sakuraExtractor)
+		sourceName, extractor = "SakuraFM", s.sakuraExtractor
 	case "extract_janitor":
-		s.handleExtraction(c, msg.Payload, "JanitorAI", s.janitorExtractor)
+		sourceName, extractor = "JanitorAI", s.janitorExtractor
 	default:
-		log.Printf("Unknown message type: %s", msg.Type)
+		slog.WarnContext(ctx, "Unknown WebSocket message type", "type", msg.Type)
 		c.sendStatus("error", fmt.Sprintf("Unknown message type: %s", msg.Type))
+		return
+	}
+
+	release, rejected := s.admitExtraction(ctx, c.limits)
+	if rejected != nil {
+		if rejected.shutdown {
+			c.sendStatus("error", rejected.message)
+		} else {
+			c.sendRateLimited(rejected.message, rejected.wait)
+		}
+		return
 	}
+
+	go func() {
+		defer release()
+		s.handleExtraction(ctx, c, msg.Payload, sourceName, extractor)
+	}()
 }
 
-func (s *Server) handleExtraction(c *Client, payload json.RawMessage, sourceName string, extractor extractors.Extractor) {
+func (s *Server) handleExtraction(ctx context.Context, c *Client, payload json.RawMessage, sourceName string, extractor extractors.Extractor) {
 	var urlPayload ExtractURLPayload
 	if err := json.Unmarshal(payload, &urlPayload); err != nil {
 		c.sendStatus("error", "Invalid payload for extraction.")
 		return
 	}
-	log.Printf("Handling extraction for source: %s, URL: %s", sourceName, urlPayload.URL)
+	job := &JobPayload{ID: newJobID(), Source: sourceName, URL: urlPayload.URL}
+	s.runExtraction(ctx, c.user, job, extractor, func(status StatusPayload) {
+		c.sendJSON(OutgoingMessage{Type: "status", Payload: status})
+	})
+}
+
+// runExtraction extracts and saves a card, publishing the job's progress on its
+// topics. reply, if set, also receives each status, for the requesting client.
+// ctx carries the correlation ID of the request that started the job.
+func (s *Server) runExtraction(ctx context.Context, user string, job *JobPayload, extractor extractors.Extractor, reply func(StatusPayload)) {
+	slog.InfoContext(ctx, "Starting extraction", "job", job.ID, "source", job.Source, "user", user)
+
+	report := func(status, message string) {
+		job.Status, job.Message = status, message
+		if reply != nil {
+			reply(StatusPayload{Status: status, Message: message, JobID: job.ID})
+		}
+		s.publish(Event{User: user, Type: "job", Topics: []string{TopicJobs, JobTopic(job.ID)}, Key: JobTopic(job.ID), Payload: *job})
+	}
 
-	c.sendStatus("started", fmt.Sprintf("Starting extraction from %s...", urlPayload.URL))
+	report("started", fmt.Sprintf("Starting extraction from %s...", job.URL))
+	start := time.Now()
 
-	card, rawData, cardImage, err := extractor.Extract([]byte(urlPayload.URL))
+	card, rawData, cardImage, err := extractor.Extract(ctx, []byte(job.URL))
 	if err != nil {
-		log.Printf("Error during extraction: %v", err)
-		c.sendStatus("error", fmt.Sprintf("Extraction failed: %v", err))
+		slog.ErrorContext(ctx, "Extraction failed", "job", job.ID, "source", job.Source, "error", err)
+		s.observeExtraction(job.Source, "extract_error", start)
+		report("error", fmt.Sprintf("Extraction failed: %v", err))
 		return
 	}
 
-	if err := saver.SaveCard(card, rawData, cardImage, sourceName); err != nil {
-		log.Printf("Error saving card: %v", err)
-		c.sendStatus("error", fmt.Sprintf("Failed to save card: %v", err))
+	rec, err := s.userLibrary(user).Save(ctx, card, rawData, cardImage, job.Source, []byte(job.URL))
+	if err != nil {
+		slog.ErrorContext(ctx, "Failed to save card", "job", job.ID, "source", job.Source, "error", err)
+		s.observeExtraction(job.Source, "save_error", start)
+		report("error", fmt.Sprintf("Failed to save card: %v", err))
 		return
 	}
+	s.observeExtraction(job.Source, "success", start)
+	slog.InfoContext(ctx, "Extraction completed", "job", job.ID, "source", job.Source, "card", rec.ID, "duration", time.Since(start))
 
-	c.sendStatus("completed", fmt.Sprintf("Successfully extracted and saved %s.", card.Data.Name))
+	job.CardID = rec.ID
+	report("completed", fmt.Sprintf("Successfully extracted and saved %s.", card.Data.Name))
 
-	// Broadcast the new card to all clients
-	broadcastMessage, err := json.Marshal(OutgoingMessage{
-		Type: "new_card",
+	// Publish the new card to all of the user's clients
+	s.publish(Event{
+		User:   user,
+		Type:   "new_card",
+		Topics: cardTopics(job.Source, rec.ID),
 		Payload: NewCardPayload{
-			Source: sourceName,
-			Card:   *card,
+			Source: job.Source,
+			Card:   newLibraryCard(rec, card),
 		},
 	})
-	if err != nil {
-		log.Printf("Error marshalling broadcast message: %v", err)
-		return
-	}
-	c.hub.broadcast <- broadcastMessage
 }
 
+// publish sends an event to the subscribers of its user. Libraries are per
+// user, so other users never see each other's cards. The hub numbers every
+// event so reconnecting clients can resume where they left off.
+func (s *Server) publish(e Event) {
+	s.hub.Publish(e)
+}
+
+// newJobID returns a random identifier for an extraction job.
+func newJobID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// serveWs upgrades a request to a WebSocket. The "topics" query parameter is a
+// comma-separated list of topics to follow on top of the defaults, and a
+// reconnecting client passes the ID of the last event it saw as last_event_id
+// to have the events it missed replayed, as with GET /api/events.
 func serveWs(s *Server, w http.ResponseWriter, r *http.Request) {
+	user := auth.UserFrom(r.Context())
+	sub := s.hub.newSubscriber(user)
+	if topics := r.URL.Query().Get("topics"); topics != "" {
+		if err := sub.Follow(strings.Split(topics, ",")...); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	limits, ok := s.connect(clientKey(r))
+	if !ok {
+		slog.WarnContext(r.Context(), "Too many WebSocket connections", "remote", r.RemoteAddr)
+		rateLimited(w, fmt.Sprintf("At most %d connections may be open at once.", s.limits.MaxClientConnections), time.Second)
+		return
+	}
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  1024,
+		WriteBufferSize: 1024,
+		CheckOrigin:     s.checkOrigin,
+	}
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
-		log.Println(err)
+		slog.WarnContext(r.Context(), "WebSocket upgrade failed", "error", err)
+		s.disconnect(limits)
 		return
 	}
-	client := &Client{server: s, hub: s.hub, conn: conn, send: make(chan []byte, 256)}
-	client.hub.register <- client
+	conn.SetReadLimit(s.limits.MaxMessageSize)
+
+	client := &Client{
+		server: s,
+		conn:   conn,
+		sub:    sub,
+		user:   user,
+		ctx:    context.WithoutCancel(r.Context()),
+		limits: limits,
+	}
+	s.hub.join(sub, resumeFrom(r))
 
+	s.trackClient("websocket", 1)
 	go client.writePump()
 	go client.readPump()
-}
\ No newline at end of file
+}
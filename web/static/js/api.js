@@ -1,6 +1,10 @@
 async function fetchCards() {
     try {
         const response = await fetch('/api/cards');
+        if (response.status === 401) {
+            window.location.href = '/login.html';
+            return null;
+        }
         if (!response.ok) {
             throw new Error(`HTTP error! status: ${response.status}`);
         }
@@ -11,4 +15,71 @@ async function fetchCards() {
         errorMessage.textContent = 'Could not load character cards. Is the server running?';
         return null;
     }
-}
\ No newline at end of file
+}
+async function mergeCards(targetId, otherId) {
+    const response = await fetch('/api/cards/merge', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ target_id: targetId, other_id: otherId }),
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return await response.json();
+}
+
+function cardURL(card) {
+    return `/api/cards/${encodeURIComponent(card.source)}/${encodeURIComponent(card.id)}`;
+}
+
+async function deleteCard(card) {
+    const response = await fetch(cardURL(card), { method: 'DELETE' });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+}
+
+async function updateTags(ids, add, remove) {
+    const response = await fetch('/api/tags', {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ ids, add: add || [], remove: remove || [] }),
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return await response.json();
+}
+
+async function fetchCollections() {
+    const response = await fetch('/api/collections');
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return await response.json();
+}
+
+async function addToCollection(name, ids) {
+    const response = await fetch(`/api/collections/${encodeURIComponent(name)}/cards`, {
+        method: 'POST',
+        headers: { 'Content-Type': 'application/json' },
+        body: JSON.stringify({ add: ids }),
+    });
+    if (!response.ok) {
+        throw new Error(await response.text());
+    }
+    return await response.json();
+}
+
+async function fetchMe() {
+    const response = await fetch('/api/me');
+    if (!response.ok) {
+        return { username: '', auth_enabled: false };
+    }
+    return await response.json();
+}
+
+async function logout() {
+    await fetch('/api/logout', { method: 'POST' });
+    window.location.href = '/login.html';
+}
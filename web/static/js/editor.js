@@ -0,0 +1,226 @@
+window.editor = {
+    card: null,
+
+    TEXT_FIELDS: [
+        ['name', 'Name', 'input'],
+        ['creator', 'Creator', 'input'],
+        ['description', 'Description', 'textarea'],
+        ['personality', 'Personality', 'textarea'],
+        ['scenario', 'Scenario', 'textarea'],
+        ['first_mes', 'First message', 'textarea'],
+        ['mes_example', 'Example messages', 'textarea'],
+        ['creator_notes', 'Creator notes', 'textarea'],
+        ['system_prompt', 'System prompt', 'textarea'],
+        ['post_history_instructions', 'Post-history instructions', 'textarea'],
+    ],
+
+    open: function(card) {
+        // Work on a deep copy so cancelling leaves the gallery untouched.
+        this.card = JSON.parse(JSON.stringify(card));
+        this.render();
+        document.getElementById('editor').hidden = false;
+        document.getElementById('editor').scrollIntoView();
+    },
+
+    close: function() {
+        this.card = null;
+        document.getElementById('editor').hidden = true;
+        document.getElementById('editor-form').innerHTML = '';
+    },
+
+    render: function() {
+        const form = document.getElementById('editor-form');
+        form.innerHTML = '';
+        const data = this.card.data;
+
+        const title = document.createElement('h2');
+        title.textContent = `Editing ${data.name} (version ${data.character_version})`;
+        form.appendChild(title);
+
+        this.TEXT_FIELDS.forEach(([key, label, kind]) => {
+            form.appendChild(this._field(label, kind, data[key] || '', value => { data[key] = value; }));
+        });
+
+        form.appendChild(this._field('Tags (comma-separated)', 'input', (data.tags || []).join(', '), value => {
+            data.tags = value.split(',').map(t => t.trim()).filter(t => t);
+        }));
+
+        form.appendChild(this._list('Alternate greetings', data.alternate_greetings || (data.alternate_greetings = [])));
+        form.appendChild(this._book());
+
+        const extensions = typeof data.extensions === 'string' ? data.extensions : JSON.stringify(data.extensions || {}, null, 2);
+        form.appendChild(this._field('Extensions (JSON)', 'textarea', extensions, value => {
+            data.extensions = value;
+        }));
+
+        const errors = document.createElement('ul');
+        errors.id = 'editor-errors';
+        errors.className = 'error';
+        form.appendChild(errors);
+
+        const buttons = document.createElement('div');
+        buttons.className = 'editor-buttons';
+        const save = document.createElement('button');
+        save.type = 'submit';
+        save.textContent = 'Save';
+        const cancel = document.createElement('button');
+        cancel.type = 'button';
+        cancel.textContent = 'Cancel';
+        cancel.addEventListener('click', () => this.close());
+        buttons.appendChild(save);
+        buttons.appendChild(cancel);
+        form.appendChild(buttons);
+    },
+
+    save: async function() {
+        const errors = document.getElementById('editor-errors');
+        errors.innerHTML = '';
+
+        const { id, source, version, created_at, updated_at, user_tags, possible_duplicates, ...card } = this.card;
+        if (typeof card.data.extensions === 'string') {
+            try {
+                card.data.extensions = JSON.parse(card.data.extensions || '{}');
+            } catch (error) {
+                this._showErrors([{ field: 'data.extensions', message: `invalid JSON: ${error.message}` }]);
+                return;
+            }
+        }
+
+        const response = await fetch(`/api/cards/${encodeURIComponent(id)}`, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify(card),
+        });
+        if (response.status === 422) {
+            const body = await response.json();
+            this._showErrors(body.issues.filter(i => i.severity === 'error'));
+            return;
+        }
+        if (!response.ok) {
+            this._showErrors([{ field: 'card', message: await response.text() }]);
+            return;
+        }
+        this.close();
+    },
+
+    _showErrors: function(issues) {
+        const errors = document.getElementById('editor-errors');
+        issues.forEach(issue => {
+            const item = document.createElement('li');
+            item.textContent = `${issue.field}: ${issue.message}`;
+            errors.appendChild(item);
+        });
+    },
+
+    _field: function(label, kind, value, onChange) {
+        const wrapper = document.createElement('label');
+        wrapper.className = 'editor-field';
+        wrapper.textContent = label;
+        const input = document.createElement(kind);
+        if (kind === 'textarea') {
+            input.rows = Math.min(12, Math.max(3, String(value).split('\n').length + 1));
+        }
+        input.value = value;
+        input.addEventListener('input', () => onChange(input.value));
+        wrapper.appendChild(input);
+        return wrapper;
+    },
+
+    _checkbox: function(label, checked, onChange) {
+        const wrapper = document.createElement('label');
+        wrapper.className = 'editor-checkbox';
+        const input = document.createElement('input');
+        input.type = 'checkbox';
+        input.checked = !!checked;
+        input.addEventListener('change', () => onChange(input.checked));
+        wrapper.appendChild(input);
+        wrapper.appendChild(document.createTextNode(label));
+        return wrapper;
+    },
+
+    _list: function(label, items) {
+        const fieldset = document.createElement('fieldset');
+        const legend = document.createElement('legend');
+        legend.textContent = label;
+        fieldset.appendChild(legend);
+
+        items.forEach((item, index) => {
+            const row = document.createElement('div');
+            row.className = 'editor-row';
+            row.appendChild(this._field(`#${index + 1}`, 'textarea', item, value => { items[index] = value; }));
+            row.appendChild(this._button('Remove', () => { items.splice(index, 1); this.render(); }));
+            fieldset.appendChild(row);
+        });
+        fieldset.appendChild(this._button('Add greeting', () => { items.push(''); this.render(); }));
+        return fieldset;
+    },
+
+    _book: function() {
+        const data = this.card.data;
+        const fieldset = document.createElement('fieldset');
+        const legend = document.createElement('legend');
+        legend.textContent = 'Lorebook';
+        fieldset.appendChild(legend);
+
+        if (!data.character_book) {
+            fieldset.appendChild(this._button('Add lorebook', () => {
+                data.character_book = { extensions: {}, entries: [] };
+                this.render();
+            }));
+            return fieldset;
+        }
+
+        const book = data.character_book;
+        fieldset.appendChild(this._field('Name', 'input', book.name || '', v => { book.name = v; }));
+        fieldset.appendChild(this._field('Description', 'textarea', book.description || '', v => { book.description = v; }));
+        fieldset.appendChild(this._field('Scan depth', 'input', book.scan_depth || 0, v => { book.scan_depth = parseInt(v, 10) || 0; }));
+        fieldset.appendChild(this._field('Token budget', 'input', book.token_budget || 0, v => { book.token_budget = parseInt(v, 10) || 0; }));
+        fieldset.appendChild(this._checkbox('Recursive scanning', book.recursive_scanning, v => { book.recursive_scanning = v; }));
+
+        (book.entries || (book.entries = [])).forEach((entry, index) => {
+            const entrySet = document.createElement('fieldset');
+            entrySet.className = 'editor-entry';
+            const entryLegend = document.createElement('legend');
+            entryLegend.textContent = `Entry ${index + 1}${entry.name ? ': ' + entry.name : ''}`;
+            entrySet.appendChild(entryLegend);
+
+            const splitKeys = v => v.split(',').map(k => k.trim()).filter(k => k);
+            entrySet.appendChild(this._field('Name', 'input', entry.name || '', v => { entry.name = v; }));
+            entrySet.appendChild(this._field('Keys (comma-separated)', 'input', (entry.keys || []).join(', '), v => { entry.keys = splitKeys(v); }));
+            entrySet.appendChild(this._field('Secondary keys (comma-separated)', 'input', (entry.secondary_keys || []).join(', '), v => { entry.secondary_keys = splitKeys(v); }));
+            entrySet.appendChild(this._field('Content', 'textarea', entry.content || '', v => { entry.content = v; }));
+            entrySet.appendChild(this._field('Comment', 'input', entry.comment || '', v => { entry.comment = v; }));
+            entrySet.appendChild(this._field('Insertion order', 'input', entry.insertion_order || 0, v => { entry.insertion_order = parseInt(v, 10) || 0; }));
+            entrySet.appendChild(this._field('Priority', 'input', entry.priority || 0, v => { entry.priority = parseInt(v, 10) || 0; }));
+            entrySet.appendChild(this._field('Position (before_char or after_char)', 'input', entry.position || '', v => { entry.position = v.trim(); }));
+            entrySet.appendChild(this._checkbox('Enabled', entry.enabled, v => { entry.enabled = v; }));
+            entrySet.appendChild(this._checkbox('Constant', entry.constant, v => { entry.constant = v; }));
+            entrySet.appendChild(this._checkbox('Selective', entry.selective, v => { entry.selective = v; }));
+            entrySet.appendChild(this._checkbox('Case sensitive', entry.case_sensitive, v => { entry.case_sensitive = v; }));
+            entrySet.appendChild(this._button('Remove entry', () => { book.entries.splice(index, 1); this.render(); }));
+            fieldset.appendChild(entrySet);
+        });
+
+        fieldset.appendChild(this._button('Add entry', () => {
+            book.entries.push({ keys: [], content: '', extensions: {}, enabled: true, insertion_order: book.entries.length });
+            this.render();
+        }));
+        fieldset.appendChild(this._button('Remove lorebook', () => { delete data.character_book; this.render(); }));
+        return fieldset;
+    },
+
+    _button: function(label, onClick) {
+        const button = document.createElement('button');
+        button.type = 'button';
+        button.textContent = label;
+        button.addEventListener('click', onClick);
+        return button;
+    },
+};
+
+document.addEventListener('DOMContentLoaded', () => {
+    document.getElementById('editor-form').addEventListener('submit', (e) => {
+        e.preventDefault();
+        window.editor.save();
+    });
+});
@@ -0,0 +1,22 @@
+document.addEventListener('DOMContentLoaded', () => {
+    const form = document.getElementById('login-form');
+    const error = document.getElementById('login-error');
+
+    form.addEventListener('submit', async (e) => {
+        e.preventDefault();
+        error.textContent = '';
+        const response = await fetch('/api/login', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({
+                username: document.getElementById('login-username').value.trim(),
+                password: document.getElementById('login-password').value,
+            }),
+        });
+        if (!response.ok) {
+            error.textContent = await response.text();
+            return;
+        }
+        window.location.href = '/';
+    });
+});
@@ -1,15 +1,125 @@
 document.addEventListener('DOMContentLoaded', () => {
     let allCards = [];
-    let currentSort = { key: 'create_date', direction: 'desc' };
+    let collections = [];
+    let currentSort = { key: 'created_at', direction: 'desc' };
+    let currentFilter = { tag: '', collection: '' };
 
     const cardContainer = document.getElementById('card-container');
     const urlForm = document.getElementById('url-form');
     const urlInput = document.getElementById('url-input');
     const errorMessage = document.getElementById('error-message');
+    const tagFilter = document.getElementById('tag-filter');
+    const collectionFilter = document.getElementById('collection-filter');
+
+    function cardTags(card) {
+        const tags = [...(card.data.tags || [])];
+        (card.user_tags || []).forEach(tag => {
+            if (!tags.some(t => t.toLowerCase() === tag.toLowerCase())) {
+                tags.push(tag);
+            }
+        });
+        return tags;
+    }
+
+    function matchesFilter(card) {
+        if (currentFilter.tag && !cardTags(card).some(t => t.toLowerCase() === currentFilter.tag.toLowerCase())) {
+            return false;
+        }
+        if (currentFilter.collection) {
+            const collection = collections.find(c => c.name === currentFilter.collection);
+            if (!collection || !collection.card_ids.includes(card.id)) {
+                return false;
+            }
+        }
+        return true;
+    }
+
+    function fillSelect(select, values) {
+        const selected = select.value;
+        select.innerHTML = '<option value="">All</option>';
+        values.forEach(value => {
+            const option = document.createElement('option');
+            option.value = value;
+            option.textContent = value;
+            select.appendChild(option);
+        });
+        select.value = values.includes(selected) ? selected : '';
+    }
+
+    function renderFilters() {
+        const tags = [];
+        allCards.forEach(card => cardTags(card).forEach(tag => {
+            if (!tags.some(t => t.toLowerCase() === tag.toLowerCase())) {
+                tags.push(tag);
+            }
+        }));
+        fillSelect(tagFilter, tags.sort((a, b) => a.localeCompare(b)));
+        fillSelect(collectionFilter, collections.map(c => c.name));
+        currentFilter = { tag: tagFilter.value, collection: collectionFilter.value };
+
+        // Exports follow the gallery filters.
+        document.querySelectorAll('#export-controls a').forEach(link => {
+            const params = new URLSearchParams({ format: link.dataset.format });
+            if (currentFilter.tag) params.set('tag', currentFilter.tag);
+            if (currentFilter.collection) params.set('collection', currentFilter.collection);
+            link.href = `/api/export?${params}`;
+        });
+    }
+
+    function createTagsElement(card) {
+        const tagsDiv = document.createElement('div');
+        tagsDiv.className = 'card-tags';
+        (card.data.tags || []).forEach(tag => {
+            const chip = document.createElement('span');
+            chip.className = 'tag';
+            chip.textContent = tag;
+            tagsDiv.appendChild(chip);
+        });
+        (card.user_tags || []).forEach(tag => {
+            const chip = document.createElement('span');
+            chip.className = 'tag user-tag';
+            chip.textContent = tag;
+            const remove = document.createElement('button');
+            remove.textContent = '×';
+            remove.title = 'Remove tag';
+            remove.addEventListener('click', () => {
+                updateTags([card.id], [], [tag]).catch(error => {
+                    errorMessage.textContent = `Tagging failed: ${error.message}`;
+                });
+            });
+            chip.appendChild(remove);
+            tagsDiv.appendChild(chip);
+        });
+
+        const form = document.createElement('form');
+        form.className = 'tag-form';
+        const input = document.createElement('input');
+        input.placeholder = 'Add tag';
+        form.appendChild(input);
+        form.addEventListener('submit', (e) => {
+            e.preventDefault();
+            const tags = input.value.split(',').map(t => t.trim()).filter(t => t);
+            if (tags.length === 0) {
+                return;
+            }
+            updateTags([card.id], tags, []).catch(error => {
+                errorMessage.textContent = `Tagging failed: ${error.message}`;
+            });
+        });
+        tagsDiv.appendChild(form);
+        return tagsDiv;
+    }
 
     function createCardElement(card) {
         const cardDiv = document.createElement('div');
         cardDiv.className = 'card';
+        cardDiv.dataset.id = card.id;
+
+        const image = document.createElement('img');
+        image.src = `${cardURL(card)}/png?inline=1`;
+        image.alt = card.data.name;
+        image.addEventListener('error', () => image.remove());
+        cardDiv.appendChild(image);
 
         const name = document.createElement('h3');
         name.textContent = card.data.name;
@@ -25,12 +135,81 @@ document.addEventListener('DOMContentLoaded', () => {
         description.textContent = card.data.description;
         cardDiv.appendChild(description);
 
+        cardDiv.appendChild(createTagsElement(card));
+
+        (card.possible_duplicates || []).forEach(dupId => {
+            const dup = allCards.find(c => c.id === dupId);
+            if (!dup) {
+                return;
+            }
+            const notice = document.createElement('div');
+            notice.className = 'duplicate-notice';
+            notice.textContent = `Possible duplicate of ${dup.data.name} (${dup.source}) `;
+
+            const mergeButton = document.createElement('button');
+            mergeButton.textContent = 'Merge into this card';
+            mergeButton.addEventListener('click', async () => {
+                try {
+                    await mergeCards(card.id, dupId);
+                } catch (error) {
+                    errorMessage.textContent = `Merge failed: ${error.message}`;
+                }
+            });
+            notice.appendChild(mergeButton);
+            cardDiv.appendChild(notice);
+        });
+
+        const actions = document.createElement('div');
+        actions.className = 'card-actions';
+        [['PNG', 'png'], ['V2 JSON', 'json?spec=v2'], ['V3 JSON', 'json?spec=v3'], ['Raw', 'raw']].forEach(([label, path]) => {
+            const link = document.createElement('a');
+            link.href = `${cardURL(card)}/${path}`;
+            link.textContent = label;
+            actions.appendChild(link);
+        });
+
+        const editButton = document.createElement('button');
+        editButton.textContent = 'Edit';
+        editButton.addEventListener('click', () => window.editor.open(card));
+        actions.appendChild(editButton);
+
+        const collectButton = document.createElement('button');
+        collectButton.textContent = 'Add to collection';
+        collectButton.addEventListener('click', async () => {
+            const name = prompt('Collection name', currentFilter.collection);
+            if (!name || !name.trim()) {
+                return;
+            }
+            try {
+                await addToCollection(name.trim(), [card.id]);
+            } catch (error) {
+                errorMessage.textContent = `Adding to collection failed: ${error.message}`;
+            }
+        });
+        actions.appendChild(collectButton);
+
+        const deleteButton = document.createElement('button');
+        deleteButton.textContent = 'Delete';
+        deleteButton.addEventListener('click', async () => {
+            if (!confirm(`Delete ${card.data.name}? This also removes its version history.`)) {
+                return;
+            }
+            try {
+                await deleteCard(card);
+            } catch (error) {
+                errorMessage.textContent = `Delete failed: ${error.message}`;
+            }
+        });
+        actions.appendChild(deleteButton);
+        cardDiv.appendChild(actions);
+
         return cardDiv;
     }
 
     function renderCards() {
+        renderFilters();
         cardContainer.innerHTML = '';
-        const groupedBySource = allCards.reduce((acc, card) => {
+        const groupedBySource = allCards.filter(matchesFilter).reduce((acc, card) => {
             const source = card.source || 'unknown';
             if (!acc[source]) {
                 acc[source] = [];
@@ -54,10 +233,10 @@ document.addEventListener('DOMContentLoaded', () => {
 
             // Sorting logic
             cards.sort((a, b) => {
-                let valA = a[currentSort.key];
-                let valB = b[currentSort.key];
+                let valA = currentSort.key === 'name' ? a.data.name : a[currentSort.key];
+                let valB = currentSort.key === 'name' ? b.data.name : b[currentSort.key];
 
-                if (currentSort.key === 'create_date') {
+                if (currentSort.key === 'created_at') {
                     valA = new Date(valA).getTime();
                     valB = new Date(valB).getTime();
                 }
@@ -76,24 +255,45 @@ document.addEventListener('DOMContentLoaded', () => {
         });
     }
 
-    async function initialize() {
-        console.log("Initializing application");
+    async function loadCards() {
         const data = await fetchCards();
-        if (data && data.sources) {
-            allCards = data.sources.flatMap(s => s.cards.map(c => ({...c, data: c.data, source: s.name })));
+        try {
+            collections = await fetchCollections();
+        } catch (error) {
+            console.warn('Failed to load collections:', error);
+        }
+        if (data) {
+            allCards = (data.sources || []).flatMap(s => s.cards.map(c => ({...c, data: c.data, source: s.name })));
+            window.ws.setPosition(data.epoch, data.seq);
             renderCards();
-            console.log("Cards loaded, connecting to WebSocket.");
         } else {
             console.warn("Failed to load initial card data.");
-            // Optionally, display a user-friendly message here
         }
+    }
+
+    async function initialize() {
+        console.log("Initializing application");
+        const me = await fetchMe();
+        if (me.auth_enabled) {
+            document.getElementById('user-name').textContent = `Signed in as ${me.username}`;
+            document.getElementById('user-controls').hidden = false;
+        }
+        await loadCards();
+        console.log("Cards loaded, connecting to WebSocket.");
         window.ws.connect();
+
+        window.ws.on('resync', () => {
+            console.log('Missed events could not be replayed, reloading cards.');
+            loadCards();
+        });
         
         window.ws.on('status', (payload) => {
             console.log('Status update:', payload);
             // You could display these status messages in a dedicated area if you wish.
             if (payload.status === 'error') {
                 errorMessage.textContent = payload.message;
+            } else if (payload.status === 'rate_limited') {
+                errorMessage.textContent = `${payload.message} Try again in ${payload.retry_after || 1}s.`;
             } else {
                 errorMessage.textContent = payload.message; // Or a different element
             }
@@ -102,10 +302,40 @@ document.addEventListener('DOMContentLoaded', () => {
         window.ws.on('new_card', (payload) => {
             errorMessage.textContent = ''; // Clear previous errors
             const newCard = {...payload.card, data: payload.card.data, source: payload.source};
+            // Re-extracting a card updates it in place rather than adding a duplicate.
+            allCards = allCards.filter(c => c.id !== newCard.id);
             allCards.unshift(newCard); // Add to the beginning of the list
             renderCards();
         });
 
+        window.ws.on('cards_merged', (payload) => {
+            const merged = {...payload.card, data: payload.card.data, source: payload.source};
+            allCards = allCards.filter(c => c.id !== payload.merged_id && c.id !== merged.id);
+            allCards.forEach(c => {
+                if (c.possible_duplicates) {
+                    c.possible_duplicates = c.possible_duplicates.filter(id => id !== payload.merged_id);
+                }
+            });
+            allCards.unshift(merged);
+            renderCards();
+        });
+
+        window.ws.on('card_updated', (payload) => {
+            const updated = {...payload.card, data: payload.card.data, source: payload.source};
+            allCards = allCards.map(c => c.id === updated.id ? updated : c);
+            renderCards();
+        });
+
+        window.ws.on('card_deleted', (payload) => {
+            allCards = allCards.filter(c => c.id !== payload.id);
+            renderCards();
+        });
+
+        window.ws.on('collections_updated', (payload) => {
+            collections = payload || [];
+            renderCards();
+        });
+
         window.ws.on('error', (payload) => {
             errorMessage.textContent = payload.message;
         });
@@ -127,8 +357,12 @@ document.addEventListener('DOMContentLoaded', () => {
 
     document.getElementById('sort-name-asc').addEventListener('click', () => setSort('name', 'asc'));
     document.getElementById('sort-name-desc').addEventListener('click', () => setSort('name', 'desc'));
-    document.getElementById('sort-date-asc').addEventListener('click', () => setSort('create_date', 'asc'));
-    document.getElementById('sort-date-desc').addEventListener('click', () => setSort('create_date', 'desc'));
+    document.getElementById('sort-date-asc').addEventListener('click', () => setSort('created_at', 'asc'));
+    document.getElementById('sort-date-desc').addEventListener('click', () => setSort('created_at', 'desc'));
+
+    document.getElementById('logout-button').addEventListener('click', logout);
+    tagFilter.addEventListener('change', renderCards);
+    collectionFilter.addEventListener('change', renderCards);
 
 
     initialize();
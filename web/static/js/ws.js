@@ -1,6 +1,16 @@
 window.ws = {
     socket: null,
     _handlers: {},
+    // Position in the server's event stream, used to resume after a reconnect.
+    epoch: null,
+    lastSeq: null,
+    // Topics followed on top of the server defaults; re-sent after reconnecting.
+    topics: [],
+
+    setPosition: function(epoch, seq) {
+        this.epoch = epoch;
+        this.lastSeq = seq;
+    },
 
     on: function(eventType, handler) {
         if (!this._handlers[eventType]) {
@@ -21,25 +31,48 @@ window.ws = {
         }
     },
 
+    // After this many WebSocket attempts fail without ever opening, fall back
+    // to Server-Sent Events, e.g. behind proxies that break upgrades.
+    MAX_SOCKET_FAILURES: 3,
+    EVENT_TYPES: ['hello', 'resync', 'new_card', 'cards_merged', 'card_updated', 'card_deleted', 'collections_updated', 'job'],
+    failures: 0,
+    events: null,
+
     connect: function() {
         const wsProtocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        const wsUrl = `${wsProtocol}//${window.location.host}/ws`;
+        // The server follows the topics and replays missed events before any live ones.
+        const params = new URLSearchParams();
+        if (this.topics.length > 0) {
+            params.set('topics', this.topics.join(','));
+        }
+        if (this.lastSeq !== null) {
+            params.set('last_event_id', `${this.epoch}:${this.lastSeq}`);
+        }
+        const wsUrl = `${wsProtocol}//${window.location.host}/ws?${params}`;
 
         this.socket = new WebSocket(wsUrl);
+        let opened = false;
 
         this.socket.onopen = () => {
             console.log('WebSocket connection established');
+            opened = true;
+            this.failures = 0;
             this._emit('open');
         };
 
         this.socket.onmessage = (event) => {
-            const message = JSON.parse(event.data);
-            this._emit(message.type, message.payload);
+            this._handle(JSON.parse(event.data));
         };
 
         this.socket.onclose = () => {
-            console.log('WebSocket connection closed. Reconnecting in 2 seconds...');
             this._emit('close');
+            if (!opened && ++this.failures >= this.MAX_SOCKET_FAILURES) {
+                console.log('WebSocket unavailable, falling back to Server-Sent Events.');
+                this.socket = null;
+                this.connectEvents();
+                return;
+            }
+            console.log('WebSocket connection closed. Reconnecting in 2 seconds...');
             setTimeout(() => this.connect(), 2000);
         };
 
@@ -49,7 +82,72 @@ window.ws = {
         };
     },
 
+    connectEvents: function() {
+        const params = new URLSearchParams();
+        params.set('topics', ['cards', 'collections', 'jobs', ...this.topics].join(','));
+        if (this.lastSeq !== null) {
+            params.set('last_event_id', `${this.epoch}:${this.lastSeq}`);
+        }
+        // EventSource reconnects by itself, sending the last event ID it saw.
+        this.events = new EventSource(`/api/events?${params}`);
+        this.EVENT_TYPES.forEach(type => {
+            this.events.addEventListener(type, (event) => {
+                const seq = event.lastEventId ? parseInt(event.lastEventId.split(':')[1], 10) : 0;
+                this._handle({ type, seq: type === 'resync' ? 0 : seq, payload: JSON.parse(event.data) });
+            });
+        });
+        this.events.onopen = () => this._emit('open');
+    },
+
+    _handle: function(message) {
+        if (message.type === 'hello') {
+            // A resumed connection replays the missed events after the greeting.
+            if (this.lastSeq === null) {
+                this.setPosition(message.payload.epoch, message.payload.seq);
+            }
+            return;
+        }
+        if (message.type === 'resync') {
+            // Missed events are gone; listeners reload their state.
+            this.setPosition(message.payload.epoch, message.payload.seq);
+            this._emit('resync', message.payload);
+            return;
+        }
+        if (message.seq) {
+            // Skip events already reflected in a card listing the position came from.
+            if (this.lastSeq !== null && message.seq <= this.lastSeq) {
+                return;
+            }
+            this.lastSeq = message.seq;
+        }
+        if (message.type === 'job' && this.events) {
+            // Without a socket there are no direct status replies; job events stand in for them.
+            this._emit('status', { status: message.payload.status, message: message.payload.message, job_id: message.payload.id });
+        }
+        this._emit(message.type, message.payload);
+    },
+
+    subscribe: function(topics) {
+        this.topics = [...new Set([...this.topics, ...topics])];
+        this._send('subscribe', { topics });
+    },
+
+    unsubscribe: function(topics) {
+        this.topics = this.topics.filter(t => !topics.includes(t));
+        this._send('unsubscribe', { topics });
+    },
+
+    _send: function(type, payload) {
+        if (this.socket && this.socket.readyState === WebSocket.OPEN) {
+            this.socket.send(JSON.stringify({ type, payload }));
+        }
+    },
+
     sendURLForExtraction: function(url) {
+        if (this.events) {
+            this._extractOverHTTP('SakuraFM', url);
+            return;
+        }
         if (this.socket && this.socket.readyState === WebSocket.OPEN) {
             const message = {
                 type: 'extract_sakura',
@@ -60,5 +158,18 @@ window.ws = {
             console.error('WebSocket is not connected.');
             this._emit('error', { message: 'Cannot send message. WebSocket is not connected.' });
         }
+    },
+
+    _extractOverHTTP: async function(source, url) {
+        const response = await fetch('/api/extract', {
+            method: 'POST',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ source, url }),
+        });
+        if (response.status === 429) {
+            this._emit('status', await response.json());
+        } else if (!response.ok) {
+            this._emit('error', { message: await response.text() });
+        }
     }
-};
\ No newline at end of file
+};
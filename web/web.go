@@ -0,0 +1,19 @@
+// Package web embeds the browser UI served by charex-web.
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed static
+var static embed.FS
+
+// Static returns the UI's files, rooted at the static directory.
+func Static() fs.FS {
+	sub, err := fs.Sub(static, "static")
+	if err != nil {
+		panic(err) // The directory is embedded above, so this cannot happen.
+	}
+	return sub
+}